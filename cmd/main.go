@@ -14,6 +14,7 @@ func main() {
 	nodeFunc := nm.DefaultNewNode
 
 	rootCmd.AddCommand(VersionCmd)
+	rootCmd.AddCommand(OpenRPCCmd)
 	// Create & start node
 	rootCmd.AddCommand(NewRunNodeCmd(nodeFunc))
 
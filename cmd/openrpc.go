@@ -0,0 +1,32 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/lianxiangcloud/lkdex/rpc"
+	"github.com/spf13/cobra"
+)
+
+// OpenRPCCmd dumps the OpenRPC document of the node apis, as served by rpc_discover over IPC
+var OpenRPCCmd = &cobra.Command{
+	Use:   "openrpc",
+	Short: "Dump the OpenRPC document of the RPC apis",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		b, err := json.MarshalIndent(rpc.OpenRPC(), "", "  ")
+		if err != nil {
+			return err
+		}
+		out, _ := cmd.Flags().GetString("out")
+		if out == "" {
+			fmt.Println(string(b))
+			return nil
+		}
+		return ioutil.WriteFile(out, append(b, '\n'), 0644)
+	},
+}
+
+func init() {
+	OpenRPCCmd.Flags().StringP("out", "o", "", "File to write the document to instead of stdout")
+}
@@ -45,7 +45,7 @@ func ParseConfig() (*cfg.Config, error) {
 	if err != nil {
 		return nil, err
 	}
-	// conf.SetRoot(conf.RootDir)
+	conf.SetRoot(conf.RootDir)
 	// cfg.EnsureRoot(conf.RootDir, conf)
 	return conf, err
 }
@@ -57,6 +57,9 @@ var RootCmd = &cobra.Command{
 		// if cmd.Name() == VersionCmd.Name() {
 		// 	return nil
 		// }
+		if cmd.Name() == OpenRPCCmd.Name() {
+			return nil
+		}
 		// if cmd.Name() == NewConsoleCommand().Name() {
 		// 	return nil
 		// }
@@ -76,11 +79,12 @@ var RootCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
-		logger.SetHandler(rotateHandler)
-		logger, err = log.ParseLogLevel(config.LogLevel, logger, cfg.DefaultLogLevel())
+		// the levels can be changed by admin_setLogLevel
+		levelHandler, err := cfg.NewLevelHandler(config.LogLevel, rotateHandler)
 		if err != nil {
 			return err
 		}
+		logger.SetHandler(levelHandler)
 		if viper.GetBool(cli.TraceFlag) {
 			logger = log.NewTracingLogger(logger)
 		}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/lianxiangcloud/linkchain/types"
+	cfg "github.com/lianxiangcloud/lkdex/config"
 	nm "github.com/lianxiangcloud/lkdex/node"
 	"github.com/spf13/cobra"
 )
@@ -13,17 +14,37 @@ import (
 func AddNodeFlags(cmd *cobra.Command) {
 	// bind flags
 	cmd.Flags().Bool("detach", config.BaseConfig.Detach, "Run as daemon")
-	cmd.Flags().Int("max_concurrency", config.BaseConfig.MaxConcurrency, "Max number of threads to use for a parallel job")
+	cmd.Flags().Int("max_concurrency", config.BaseConfig.MaxConcurrency, "Max number of RPC requests served at the same time over HTTP/WS, 0 for no limit")
 	// cmd.Flags().String("pidfile", config.BaseConfig.Pidfile, "File path to write the daemon's PID to")
 	cmd.Flags().String("log_level", config.BaseConfig.LogLevel, "0-4 or categories")
 	cmd.Flags().String("home", config.BaseConfig.RootDir, "home")
 	cmd.Flags().String("log_dir", config.BaseConfig.LogPath, "log_dir")
 	cmd.Flags().Bool("test_net", config.BaseConfig.TestNet, "signparam will be set to 29154 if this flag is set")
 
+	cmd.Flags().String("keystore_file", config.BaseConfig.KeystoreFile, "keystore file of the account signing the orders and txs instead of the wallet daemon")
+	cmd.Flags().String("password_file", config.BaseConfig.PasswordFile, "file holding the password of keystore_file")
+
 	cmd.Flags().String("contract_addr", config.BaseConfig.ContractAddr, "dexcontract contract address")
+	cmd.Flags().Uint64("order_ttl", config.BaseConfig.OrderTTL, "default order lifetime in seconds when expires is omitted")
+	cmd.Flags().Uint64("max_sync_lag", config.BaseConfig.MaxSyncLag, "blocks the index may lag behind the chain head before /readyz fails")
 	cmd.Flags().String("daemon.peer_rpc", config.Daemon.PeerRPC, "peer rpc url")
 	cmd.Flags().String("daemon.peer_ws", config.Daemon.PeerWS, "peer ws url")
 	cmd.Flags().String("wallet_daemon.peer_rpc", config.WalletDaemon.PeerRPC, "wallet rpc url")
+	cmd.Flags().StringSlice("daemon.peer_rpcs", config.Daemon.PeerRPCs, "peer rpc urls failed over to after daemon.peer_rpc")
+	cmd.Flags().StringSlice("daemon.peer_wss", config.Daemon.PeerWSs, "peer ws urls failed over to after daemon.peer_ws")
+	cmd.Flags().StringSlice("wallet_daemon.peer_rpcs", config.WalletDaemon.PeerRPCs, "wallet rpc urls failed over to after wallet_daemon.peer_rpc")
+	cmd.Flags().Int("daemon.timeout", config.Daemon.Timeout, "seconds a request to the peer may take, 0 for no limit")
+	cmd.Flags().Int("wallet_daemon.timeout", config.WalletDaemon.Timeout, "seconds a request to the wallet may take, 0 for no limit")
+	cmd.Flags().String("daemon.login", config.Daemon.Login, "peer login, user:password for basic auth or a bearer token")
+	cmd.Flags().String("daemon.ca_file", config.Daemon.CAFile, "PEM CA bundle verifying the https/wss peer urls")
+	cmd.Flags().String("daemon.cert_file", config.Daemon.CertFile, "PEM client certificate of mutual TLS with the peer")
+	cmd.Flags().String("daemon.key_file", config.Daemon.KeyFile, "PEM key of daemon.cert_file")
+	cmd.Flags().String("daemon.nc", config.Daemon.NC, "nc header of the peer requests, empty to not send it")
+	cmd.Flags().String("wallet_daemon.login", config.WalletDaemon.Login, "wallet login, user:password for basic auth or a bearer token")
+	cmd.Flags().String("wallet_daemon.ca_file", config.WalletDaemon.CAFile, "PEM CA bundle verifying the https wallet urls")
+	cmd.Flags().String("wallet_daemon.cert_file", config.WalletDaemon.CertFile, "PEM client certificate of mutual TLS with the wallet")
+	cmd.Flags().String("wallet_daemon.key_file", config.WalletDaemon.KeyFile, "PEM key of wallet_daemon.cert_file")
+	cmd.Flags().String("wallet_daemon.nc", config.WalletDaemon.NC, "nc header of the wallet requests, empty to not send it")
 
 	// rpc flags
 	cmd.Flags().StringSlice("rpc.http_modules", config.RPC.HTTPModules, "API's offered over the HTTP-RPC interface")
@@ -32,6 +53,26 @@ func AddNodeFlags(cmd *cobra.Command) {
 	cmd.Flags().StringSlice("rpc.ws_modules", config.RPC.WSModules, "API's offered over the WS-RPC interface")
 	cmd.Flags().Bool("rpc.ws_expose_all", config.RPC.WSExposeAll, "Enable the WS-RPC server to expose all APIs")
 	cmd.Flags().String("rpc.ipc_endpoint", config.RPC.IpcEndpoint, "Filename for IPC socket/pipe within the datadir (explicit paths escape it)")
+	cmd.Flags().StringSlice("rpc.auth_modules", config.RPC.AuthModules, "API's requiring an api key or jwt over HTTP/WS")
+	cmd.Flags().StringSlice("rpc.api_keys", config.RPC.APIKeys, "API keys accepted by the HTTP/WS endpoints")
+	cmd.Flags().String("rpc.jwt_secret", config.RPC.JWTSecret, "HS256 secret of the jwts accepted by the HTTP/WS endpoints")
+	cmd.Flags().StringSlice("rpc.ipc_only_modules", config.RPC.IPCOnlyModules, "API's only offered over the IPC endpoint")
+	cmd.Flags().Float64("rpc.rate_limit", config.RPC.RateLimit, "Requests per second allowed to a HTTP/WS client, 0 for no limit")
+	cmd.Flags().Int("rpc.rate_burst", config.RPC.RateBurst, "Requests a HTTP/WS client may burst over rpc.rate_limit")
+	cmd.Flags().Int("rpc.call_timeout", config.RPC.CallTimeout, "Seconds a RPC call may wait for the daemons, 0 for no limit")
+	cmd.Flags().Int("rpc.max_batch_queries", config.RPC.MaxBatchQueries, "Queries of a dex_getDepositAmounts, dex_availableVolumes or REST balances call, 0 for no limit")
+	cmd.Flags().Bool("rpc.rest", config.RPC.REST, "Enable the REST market data api under /v1/ of the HTTP-RPC endpoint")
+
+	// gas flags
+	cmd.Flags().String("gas.strategy", config.Gas.Strategy, "Gas price strategy of the txs: fixed, suggested or multiplier")
+	cmd.Flags().Uint64("gas.price", config.Gas.Price, "Gas price in wei of the fixed strategy")
+	cmd.Flags().Float64("gas.multiplier", config.Gas.Multiplier, "Factor of the gas price suggested by the node of the multiplier strategy")
+	cmd.Flags().Uint64("gas.max_price", config.Gas.MaxPrice, "Cap of the gas price suggested by the node, 0 for no cap")
+	cmd.Flags().Uint64("gas.limit_margin", config.Gas.LimitMargin, "Percent added to the estimated gas of the txs")
+
+	// instrumentation flags
+	cmd.Flags().Bool("instrumentation.prometheus", config.Instrumentation.Prometheus, "Serve the Prometheus metrics under /metrics")
+	cmd.Flags().String("instrumentation.prometheus_listen_addr", config.Instrumentation.PrometheusListenAddr, "Prometheus metrics listen address. Port required")
 
 }
 
@@ -46,8 +87,33 @@ func NewRunNodeCmd(nodeProvider nm.NodeProvider) *cobra.Command {
 			if err != nil {
 				panic(err)
 			}
-			logger.Info("NewRunNodeCmd", "base", config.BaseConfig, "daemon", config.Daemon, "wallet", config.WalletDaemon, "rpc", config.RPC, "log", config.Log, "dexContractAddr", config.ContractAddr)
-			fmt.Printf("conf:%v\n", *config)
+			conf := *config
+			if conf.Password != "" {
+				conf.Password = "***"
+			}
+			daemonConf, walletConf := *config.Daemon, *config.WalletDaemon
+			if daemonConf.Login != "" {
+				daemonConf.Login = "***"
+			}
+			if walletConf.Login != "" {
+				walletConf.Login = "***"
+			}
+			rpcConf := *config.RPC
+			rpcConf.APIKeys = make([]string, len(config.RPC.APIKeys))
+			for i := range rpcConf.APIKeys {
+				rpcConf.APIKeys[i] = "***"
+			}
+			if rpcConf.JWTSecret != "" {
+				rpcConf.JWTSecret = "***"
+			}
+			// a policy subject may be an api key
+			rpcConf.WalletPolicies = make([]cfg.WalletPolicy, len(config.RPC.WalletPolicies))
+			for i, policy := range config.RPC.WalletPolicies {
+				policy.Subject = "***"
+				rpcConf.WalletPolicies[i] = policy
+			}
+			logger.Info("NewRunNodeCmd", "base", conf.BaseConfig, "daemon", daemonConf, "wallet", walletConf, "rpc", rpcConf, "log", config.Log, "dexContractAddr", config.ContractAddr)
+			fmt.Printf("conf:%v\n", conf)
 
 			types.InitSignParam(config.TestNet)
 
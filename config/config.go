@@ -2,8 +2,10 @@ package config
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/lianxiangcloud/linkchain/libs/log"
 )
@@ -15,6 +17,31 @@ var (
 	defaultLogDir      = "logs"
 	defaultLogFileName = "dex.log"
 	defaultPidFile     = "dex.pid"
+	defaultOrderTTL    = uint64(24 * 60 * 60)
+	defaultMaxSyncLag  = uint64(10)
+	defaultConcurrency = 64
+	defaultRateLimit   = float64(100)
+	defaultRateBurst   = 200
+	defaultCallTimeout = 60
+
+	defaultMaxBatchQueries = 100
+
+	defaultHealthCheckInterval = 10
+	defaultDaemonTimeout       = 30
+	defaultDaemonRetries       = 2
+	defaultBreakerThreshold    = 5
+	defaultBreakerCooldown     = 10
+	defaultNC                  = "IN"
+)
+
+// DefaultGasPrice is the gas price in wei of the fixed gas price strategy unless gas.price is set
+const DefaultGasPrice = uint64(1e11)
+
+// Gas price strategies of a GasPolicy
+const (
+	GasPriceFixed      = "fixed"      // the gas price is price
+	GasPriceSuggested  = "suggested"  // the gas price is eth_gasPrice of the node, at most max_price
+	GasPriceMultiplier = "multiplier" // the gas price is eth_gasPrice times multiplier, at most max_price
 )
 
 // BaseConfig define
@@ -41,6 +68,10 @@ type BaseConfig struct {
 	LogFile      string `mapstructure:"log_file"`
 	TestNet      bool   `mapstructure:"test_net"`
 	ContractAddr string `mapstructure:"contract_addr"`
+	// OrderTTL default order lifetime in seconds when expires is omitted
+	OrderTTL uint64 `mapstructure:"order_ttl"`
+	// MaxSyncLag blocks the index may lag behind the chain head while the node is ready
+	MaxSyncLag uint64 `mapstructure:"max_sync_lag"`
 }
 
 // DefaultBaseConfig return default config
@@ -49,12 +80,14 @@ func DefaultBaseConfig() BaseConfig {
 		Password:       "",
 		KdfRounds:      1,
 		Detach:         false,
-		MaxConcurrency: 1,
+		MaxConcurrency: defaultConcurrency,
 		LogLevel:       "debug",
 		DBBackend:      "leveldb",
 		DBPath:         defaultDataDir,
 		LogPath:        defaultLogDir,
 		Pidfile:        defaultPidFile,
+		OrderTTL:       defaultOrderTTL,
+		MaxSyncLag:     defaultMaxSyncLag,
 	}
 }
 
@@ -73,6 +106,23 @@ func (cfg BaseConfig) KeyStoreDir() string {
 	return rootify(cfg.KeyStorePath, cfg.RootDir)
 }
 
+// KeystoreFilePath returns the full path to the keystore file, "" if none is set
+func (cfg BaseConfig) KeystoreFilePath() string {
+	return rootifyFile(cfg.KeystoreFile, cfg.RootDir)
+}
+
+// KeystorePassword returns the password of the keystore file, read from PasswordFile if it is set
+func (cfg BaseConfig) KeystorePassword() (string, error) {
+	if cfg.PasswordFile == "" {
+		return cfg.Password, nil
+	}
+	b, err := ioutil.ReadFile(rootify(cfg.PasswordFile, cfg.RootDir))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
 // PidFileDir returns the full path to the pid file directory
 func (cfg BaseConfig) PidFileDir() string {
 	return rootify(cfg.Pidfile, cfg.RootDir)
@@ -86,6 +136,14 @@ func rootify(path, root string) string {
 	return filepath.Join(root, path)
 }
 
+// rootifyFile is rootify keeping an unset path empty
+func rootifyFile(path, root string) string {
+	if path == "" {
+		return ""
+	}
+	return rootify(path, root)
+}
+
 func (cfg BaseConfig) SavePid() error {
 	pidFilePath := cfg.PidFileDir()
 
@@ -115,6 +173,62 @@ type DaemonConfig struct {
 	Login     string `mapstructure:"login"`
 	Trusted   bool   `mapstructure:"trusted"`
 	Testnet   bool   `mapstructure:"testnet"`
+
+	PeerRPCs            []string `mapstructure:"peer_rpcs"`             // rpc urls failed over to after peer_rpc
+	PeerWSs             []string `mapstructure:"peer_wss"`              // ws urls failed over to after peer_ws
+	HealthCheckInterval int      `mapstructure:"health_check_interval"` // seconds between the checks of failed rpc urls
+
+	Timeout          int `mapstructure:"timeout"`           // seconds a request to a rpc url may take, 0 for no limit
+	Retries          int `mapstructure:"retries"`           // retries of the read methods when the daemon is not reachable
+	BreakerThreshold int `mapstructure:"breaker_threshold"` // calls in a row not reaching the daemon which open the circuit breaker, 0 disables it
+	BreakerCooldown  int `mapstructure:"breaker_cooldown"`  // seconds the open circuit breaker fails the calls fast
+
+	NC       string `mapstructure:"nc"`        // nc header of the rpc requests, not sent if empty
+	CAFile   string `mapstructure:"ca_file"`   // PEM CA bundle verifying the https/wss daemons instead of the system roots
+	CertFile string `mapstructure:"cert_file"` // PEM client certificate of mutual TLS
+	KeyFile  string `mapstructure:"key_file"`  // PEM key of cert_file
+
+	// The root directory of the relative file paths, set by Config.SetRoot
+	RootDir string `mapstructure:"home"`
+}
+
+// CAFilePath returns the full path to the CA bundle, "" if none is set
+func (cfg *DaemonConfig) CAFilePath() string {
+	return rootifyFile(cfg.CAFile, cfg.RootDir)
+}
+
+// CertFilePath returns the full path to the client certificate, "" if none is set
+func (cfg *DaemonConfig) CertFilePath() string {
+	return rootifyFile(cfg.CertFile, cfg.RootDir)
+}
+
+// KeyFilePath returns the full path to the key of the client certificate, "" if none is set
+func (cfg *DaemonConfig) KeyFilePath() string {
+	return rootifyFile(cfg.KeyFile, cfg.RootDir)
+}
+
+// RPCEndpoints returns PeerRPC followed by PeerRPCs
+func (cfg *DaemonConfig) RPCEndpoints() []string {
+	return endpoints(cfg.PeerRPC, cfg.PeerRPCs)
+}
+
+// WSEndpoints returns PeerWS followed by PeerWSs
+func (cfg *DaemonConfig) WSEndpoints() []string {
+	return endpoints(cfg.PeerWS, cfg.PeerWSs)
+}
+
+// endpoints returns the urls in order without the empty and repeated ones
+func endpoints(first string, more []string) []string {
+	urls := make([]string, 0, len(more)+1)
+	seen := make(map[string]bool)
+	for _, url := range append([]string{first}, more...) {
+		if url == "" || seen[url] {
+			continue
+		}
+		seen[url] = true
+		urls = append(urls, url)
+	}
+	return urls
 }
 
 // RPCConfig rpc config
@@ -128,6 +242,129 @@ type RPCConfig struct {
 	WSModules    []string `mapstructure:"ws_modules"`
 	WSOrigins    []string `mapsturcture:"ws_origins"`
 	WSExposeAll  bool     `mapstructure:"ws_expose_all"`
+
+	AuthModules    []string `mapstructure:"auth_modules"`     // modules needing an api key or jwt over HTTP/WS
+	APIKeys        []string `mapstructure:"api_keys"`         // accepted api keys
+	JWTSecret      string   `mapstructure:"jwt_secret"`       // HS256 secret of accepted jwts
+	IPCOnlyModules []string `mapstructure:"ipc_only_modules"` // modules only served over IPC
+
+	WalletPolicies []WalletPolicy `mapstructure:"wallet_policies"` // wlt restrictions of credentials
+
+	RateLimit        float64            `mapstructure:"rate_limit"`         // requests per second of a client, 0 for no limit
+	RateBurst        int                `mapstructure:"rate_burst"`         // requests a client may burst over rate_limit
+	MethodRateLimits map[string]float64 `mapstructure:"method_rate_limits"` // requests per second of a client per method
+
+	CallTimeout    int            `mapstructure:"call_timeout"`    // seconds a call may wait for the daemons, 0 for no limit
+	MethodTimeouts map[string]int `mapstructure:"method_timeouts"` // call_timeout per method
+
+	REST bool `mapstructure:"rest"` // serve the REST market data api under /v1/ of the HTTP endpoint
+
+	MaxBatchQueries int `mapstructure:"max_batch_queries"` // queries of a dex_getDepositAmounts, dex_availableVolumes or REST balances call, 0 for no limit
+}
+
+// WalletPolicy restricts the wlt api of a credential to some accounts and methods.
+// Credentials without a policy are not restricted.
+type WalletPolicy struct {
+	Subject   string   `mapstructure:"subject"`   // api key or jwt subject
+	Addresses []string `mapstructure:"addresses"` // allowed account addresses, empty allows all
+	Methods   []string `mapstructure:"methods"`   // allowed wlt methods, empty allows all
+}
+
+// GasPolicy chooses the gas price of a tx
+type GasPolicy struct {
+	Strategy   string  `mapstructure:"strategy"`   // fixed, suggested or multiplier
+	Price      uint64  `mapstructure:"price"`      // gas price in wei of the fixed strategy
+	Multiplier float64 `mapstructure:"multiplier"` // factor of the suggested gas price of the multiplier strategy
+	MaxPrice   uint64  `mapstructure:"max_price"`  // cap of the suggested gas price, 0 for no cap
+}
+
+// GasConfig is the gas policy of the txs the node sends
+type GasConfig struct {
+	GasPolicy `mapstructure:",squash"`
+
+	Methods     map[string]GasPolicy `mapstructure:"methods"`      // policy per contract method, unset fields are those of the top level
+	LimitMargin uint64               `mapstructure:"limit_margin"` // percent added to the estimated gas of a tx
+}
+
+// Policy returns the gas policy of the txs calling contract method, "" for the txs without a method
+func (cfg *GasConfig) Policy(method string) GasPolicy {
+	if cfg == nil {
+		return GasPolicy{Strategy: GasPriceFixed, Price: DefaultGasPrice}
+	}
+	policy := cfg.GasPolicy
+	for m, p := range cfg.Methods {
+		if method == "" || !strings.EqualFold(m, method) {
+			continue
+		}
+		if p.Strategy != "" {
+			policy.Strategy = p.Strategy
+		}
+		if p.Price != 0 {
+			policy.Price = p.Price
+		}
+		if p.Multiplier != 0 {
+			policy.Multiplier = p.Multiplier
+		}
+		if p.MaxPrice != 0 {
+			policy.MaxPrice = p.MaxPrice
+		}
+		break
+	}
+	return policy
+}
+
+// GasLimit returns gas plus LimitMargin percent of it
+func (cfg *GasConfig) GasLimit(gas uint64) uint64 {
+	if cfg == nil || cfg.LimitMargin == 0 {
+		return gas
+	}
+	return gas + gas*cfg.LimitMargin/100
+}
+
+// ValidateBasic checks the strategies of the top level and of the methods
+func (cfg *GasConfig) ValidateBasic() error {
+	if cfg == nil {
+		return nil
+	}
+	if err := cfg.Policy("").validate(); err != nil {
+		return fmt.Errorf("gas: %v", err)
+	}
+	for m := range cfg.Methods {
+		if err := cfg.Policy(m).validate(); err != nil {
+			return fmt.Errorf("gas.methods.%s: %v", m, err)
+		}
+	}
+	return nil
+}
+
+func (p GasPolicy) validate() error {
+	switch p.Strategy {
+	case GasPriceFixed:
+		if p.Price == 0 {
+			return fmt.Errorf("price of the %s strategy must be set", p.Strategy)
+		}
+	case GasPriceSuggested:
+	case GasPriceMultiplier:
+		if p.Multiplier <= 0 {
+			return fmt.Errorf("multiplier of the %s strategy must be positive", p.Strategy)
+		}
+	default:
+		return fmt.Errorf("unknown gas price strategy %q", p.Strategy)
+	}
+	return nil
+}
+
+// InstrumentationConfig defines the configuration for metrics reporting.
+type InstrumentationConfig struct {
+	// When true, Prometheus metrics are served under /metrics on
+	// PrometheusListenAddr.
+	Prometheus bool `mapstructure:"prometheus"`
+
+	// Address to listen for Prometheus collector(s) connections.
+	PrometheusListenAddr string `mapstructure:"prometheus_listen_addr"`
+
+	// Namespace of the metrics, they are named <namespace>_<subsystem>_<name>.
+	Namespace string `mapstructure:"namespace"`
 }
 
 // DefaultDaemonConfig returns default daemon config
@@ -138,6 +375,13 @@ func DefaultDaemonConfig() *DaemonConfig {
 		Login:     "",
 		Trusted:   true,
 		Testnet:   true,
+		NC:        defaultNC,
+
+		HealthCheckInterval: defaultHealthCheckInterval,
+		Timeout:             defaultDaemonTimeout,
+		Retries:             defaultDaemonRetries,
+		BreakerThreshold:    defaultBreakerThreshold,
+		BreakerCooldown:     defaultBreakerCooldown,
 	}
 }
 
@@ -148,21 +392,55 @@ func DefaultWalletDaemonConfig() *DaemonConfig {
 		Login:     "",
 		Trusted:   true,
 		Testnet:   true,
+		NC:        defaultNC,
+
+		HealthCheckInterval: defaultHealthCheckInterval,
+		Timeout:             defaultDaemonTimeout,
+		Retries:             defaultDaemonRetries,
+		BreakerThreshold:    defaultBreakerThreshold,
+		BreakerCooldown:     defaultBreakerCooldown,
 	}
 }
 
 // DefaultRPCConfig returns default rpc config
 func DefaultRPCConfig() *RPCConfig {
 	return &RPCConfig{
-		IpcEndpoint:  "dex.ipc",
-		HTTPEndpoint: "127.0.0.1:18804",
-		HTTPModules:  []string{"wlt", "dex"},
-		HTTPCores:    []string{"*"},
-		VHosts:       []string{"*"},
-		WSEndpoint:   "127.0.0.1:18805",
-		WSModules:    []string{"wlt", "dex"},
-		WSExposeAll:  true,
-		WSOrigins:    []string{"*"},
+		IpcEndpoint:    "dex.ipc",
+		HTTPEndpoint:   "127.0.0.1:18804",
+		HTTPModules:    []string{"wlt", "dex"},
+		HTTPCores:      []string{"*"},
+		VHosts:         []string{"*"},
+		WSEndpoint:     "127.0.0.1:18805",
+		WSModules:      []string{"wlt", "dex"},
+		WSExposeAll:    true,
+		WSOrigins:      []string{"*"},
+		AuthModules:    []string{"wlt", "admin"},
+		IPCOnlyModules: []string{"admin"},
+		RateLimit:      defaultRateLimit,
+		RateBurst:      defaultRateBurst,
+		CallTimeout:    defaultCallTimeout,
+		REST:           true,
+
+		MaxBatchQueries: defaultMaxBatchQueries,
+	}
+}
+
+// DefaultGasConfig returns the fixed gas price DefaultGasPrice without a gas limit margin
+func DefaultGasConfig() *GasConfig {
+	return &GasConfig{
+		GasPolicy: GasPolicy{
+			Strategy: GasPriceFixed,
+			Price:    DefaultGasPrice,
+		},
+	}
+}
+
+// DefaultInstrumentationConfig returns a default configuration for metrics reporting.
+func DefaultInstrumentationConfig() *InstrumentationConfig {
+	return &InstrumentationConfig{
+		Prometheus:           false,
+		PrometheusListenAddr: "127.0.0.1:18806",
+		Namespace:            "lkdex",
 	}
 }
 
@@ -178,6 +456,14 @@ func DefaultRotateConfig() *log.RotateConfig {
 	}
 }
 
+// SetRoot sets the root directory of cfg and of its daemon configs
+func (cfg *Config) SetRoot(root string) *Config {
+	cfg.BaseConfig.RootDir = root
+	cfg.Daemon.RootDir = root
+	cfg.WalletDaemon.RootDir = root
+	return cfg
+}
+
 func (cfg *Config) IPCFile() string {
 	return rootify(cfg.RPC.IpcEndpoint, cfg.RootDir)
 }
@@ -190,6 +476,9 @@ type Config struct {
 	WalletDaemon *DaemonConfig     `mapstructure:"wallet_daemon"`
 	RPC          *RPCConfig        `mapstructure:"rpc"`
 	Log          *log.RotateConfig `mapstructure:"log"`
+	Gas          *GasConfig        `mapstructure:"gas"`
+
+	Instrumentation *InstrumentationConfig `mapstructure:"instrumentation"`
 }
 
 // DefaultConfig returns a default configuration
@@ -200,6 +489,9 @@ func DefaultConfig() *Config {
 		WalletDaemon: DefaultWalletDaemonConfig(),
 		RPC:          DefaultRPCConfig(),
 		Log:          DefaultRotateConfig(),
+		Gas:          DefaultGasConfig(),
+
+		Instrumentation: DefaultInstrumentationConfig(),
 	}
 }
 
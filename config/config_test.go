@@ -0,0 +1,58 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeystorePassword(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lkdex")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	cfg := DefaultBaseConfig()
+	cfg.RootDir = dir
+	cfg.Password = "secret"
+	password, err := cfg.KeystorePassword()
+	assert.Nil(t, err)
+	assert.Equal(t, "secret", password)
+	assert.Equal(t, "", cfg.KeystoreFilePath())
+
+	cfg.KeystoreFile = "keystore/key.json"
+	assert.Equal(t, filepath.Join(dir, "keystore/key.json"), cfg.KeystoreFilePath())
+
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "password"), []byte("from file\n"), 0600))
+	cfg.PasswordFile = "password"
+	password, err = cfg.KeystorePassword()
+	assert.Nil(t, err)
+	assert.Equal(t, "from file", password)
+
+	cfg.PasswordFile = "missing"
+	_, err = cfg.KeystorePassword()
+	assert.NotNil(t, err)
+}
+
+func TestGasConfig(t *testing.T) {
+	cfg := DefaultGasConfig()
+	assert.Nil(t, cfg.ValidateBasic())
+	assert.Equal(t, GasPolicy{Strategy: GasPriceFixed, Price: DefaultGasPrice}, cfg.Policy("trade"))
+	assert.Equal(t, uint64(21000), cfg.GasLimit(21000))
+
+	cfg.LimitMargin = 10
+	assert.Equal(t, uint64(23100), cfg.GasLimit(21000))
+
+	cfg.MaxPrice = 5e10
+	cfg.Methods = map[string]GasPolicy{"trade": {Strategy: GasPriceMultiplier, Multiplier: 1.2}}
+	assert.Nil(t, cfg.ValidateBasic())
+	assert.Equal(t, GasPolicy{Strategy: GasPriceMultiplier, Price: DefaultGasPrice, Multiplier: 1.2, MaxPrice: 5e10}, cfg.Policy("Trade"))
+	assert.Equal(t, cfg.GasPolicy, cfg.Policy(""))
+
+	cfg.Methods["withdraw"] = GasPolicy{Strategy: GasPriceMultiplier}
+	assert.NotNil(t, cfg.ValidateBasic())
+	cfg.Methods["withdraw"] = GasPolicy{Strategy: "cheapest"}
+	assert.NotNil(t, cfg.ValidateBasic())
+}
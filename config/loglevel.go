@@ -0,0 +1,115 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/lianxiangcloud/linkchain/libs/log"
+)
+
+const (
+	defaultLogLevelKey = "*"
+	lvlNone            = log.Lvl(-1)
+)
+
+// LevelHandler filters the log records by the level of their module, the levels
+// can be changed while the node runs. They are given like the log_level option:
+// a level for all modules, or "module:level" pairs with "*" for the other modules.
+type LevelHandler struct {
+	next log.Handler
+
+	mu      sync.RWMutex
+	level   string
+	def     log.Lvl
+	modules map[string]log.Lvl
+}
+
+// NewLevelHandler returns a LevelHandler writing the records allowed by level to next
+func NewLevelHandler(level string, next log.Handler) (*LevelHandler, error) {
+	h := &LevelHandler{next: next}
+	if err := h.SetLevel(level); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// SetLevel changes the levels of the modules
+func (h *LevelHandler) SetLevel(level string) error {
+	def, modules, err := parseLogLevel(level)
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.level, h.def, h.modules = level, def, modules
+	return nil
+}
+
+// Level returns the levels of the modules as given to SetLevel
+func (h *LevelHandler) Level() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.level
+}
+
+// Log implements log.Handler
+func (h *LevelHandler) Log(r *log.Record) error {
+	h.mu.RLock()
+	lvl := h.def
+	if len(h.modules) > 0 {
+		// the module of a record is its last module key
+		for i := len(r.Ctx) - 2; i >= 0; i -= 2 {
+			if r.Ctx[i] == "module" {
+				if l, ok := h.modules[fmt.Sprint(r.Ctx[i+1])]; ok {
+					lvl = l
+				}
+				break
+			}
+		}
+	}
+	h.mu.RUnlock()
+
+	if r.Lvl > lvl {
+		return nil
+	}
+	return h.next.Log(r)
+}
+
+func parseLogLevel(level string) (log.Lvl, map[string]log.Lvl, error) {
+	if level == "" {
+		return 0, nil, fmt.Errorf("empty log level")
+	}
+	if !strings.Contains(level, ":") {
+		level = defaultLogLevelKey + ":" + level
+	}
+
+	def, err := parseLvl(DefaultLogLevel())
+	if err != nil {
+		return 0, nil, err
+	}
+	modules := make(map[string]log.Lvl)
+	for _, item := range strings.Split(level, ",") {
+		moduleAndLevel := strings.Split(item, ":")
+		if len(moduleAndLevel) != 2 {
+			return 0, nil, fmt.Errorf("expected \"module:level\" pairs, given pair %s", item)
+		}
+		lvl, err := parseLvl(moduleAndLevel[1])
+		if err != nil {
+			return 0, nil, err
+		}
+		if moduleAndLevel[0] == defaultLogLevelKey {
+			def = lvl
+		} else {
+			modules[moduleAndLevel[0]] = lvl
+		}
+	}
+	return def, modules, nil
+}
+
+func parseLvl(level string) (log.Lvl, error) {
+	if level == "none" {
+		return lvlNone, nil
+	}
+	return log.LvlFromString(level)
+}
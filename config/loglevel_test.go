@@ -0,0 +1,44 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/lianxiangcloud/linkchain/libs/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLevelHandler(t *testing.T) {
+	var msgs []string
+	next := log.FuncHandler(func(r *log.Record) error {
+		msgs = append(msgs, r.Msg)
+		return nil
+	})
+	h, err := NewLevelHandler("info", next)
+	assert.Nil(t, err)
+	logger := log.New("module", "main")
+	logger.SetHandler(h)
+	dexLogger := logger.With("module", "dex")
+
+	logger.Debug("main debug")
+	logger.Info("main info")
+	dexLogger.Debug("dex debug")
+	assert.Equal(t, []string{"main info"}, msgs)
+
+	assert.Nil(t, h.SetLevel("dex:trace,*:warn"))
+	assert.Equal(t, "dex:trace,*:warn", h.Level())
+	msgs = nil
+	logger.Info("main info")
+	logger.Warn("main warn")
+	dexLogger.Trace("dex trace")
+	assert.Equal(t, []string{"main warn", "dex trace"}, msgs)
+
+	assert.Nil(t, h.SetLevel("none"))
+	msgs = nil
+	logger.Error("main error")
+	assert.Empty(t, msgs)
+
+	assert.NotNil(t, h.SetLevel("dex:loud"))
+	assert.NotNil(t, h.SetLevel("dex:info:x"))
+	assert.NotNil(t, h.SetLevel(""))
+	assert.Equal(t, "none", h.Level())
+}
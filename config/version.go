@@ -0,0 +1,7 @@
+package config
+
+// GitCommit and GitBranch are the version of the build, set by the Makefile
+var (
+	GitCommit string
+	GitBranch string
+)
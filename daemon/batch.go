@@ -0,0 +1,89 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+// maxBatchSize is the number of calls sent in one request, BatchCall splits larger batches
+const maxBatchSize = 100
+
+// ErrNoResponse is set as the error of a call the daemon did not answer in a batch response
+var ErrNoResponse = errors.New("no response to the call in the batch")
+
+// BatchElem is a call of a batch request
+type BatchElem struct {
+	Method string
+	Params []interface{}
+	// Result is decoded from the result of the call, it may be nil
+	Result interface{}
+	// Error is the error of the call, as Call would return it
+	Error error
+}
+
+// BatchCall sends the calls of batch in requests of at most maxBatchSize calls and sets the
+// Result or the Error of each call. An error is returned if a request fails, the calls of it
+// and of the following requests are not answered then.
+// A batch of idempotent methods is retried like a single call of them.
+func (c *DaemonClient) BatchCall(ctx context.Context, batch []BatchElem) error {
+	for start := 0; start < len(batch); start += maxBatchSize {
+		end := start + maxBatchSize
+		if end > len(batch) {
+			end = len(batch)
+		}
+		if err := c.batchCall(ctx, batch[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// batchCall sends the calls of batch in one request, the id of a call is its index in batch
+func (c *DaemonClient) batchCall(ctx context.Context, batch []BatchElem) error {
+	msgs := make([]map[string]interface{}, len(batch))
+	idempotent := true
+	for i, elem := range batch {
+		params := elem.Params
+		if params == nil {
+			params = []interface{}{}
+		}
+		msgs[i] = requestMessage(i, elem.Method, params)
+		idempotent = idempotent && idempotentMethods[elem.Method]
+	}
+	data, err := json.Marshal(msgs)
+	if err != nil {
+		return err
+	}
+	body, err := c.request(ctx, "batch", batch[0].Method, data, idempotent)
+	if err != nil {
+		return err
+	}
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return ErrEmptyResponse
+	}
+
+	var resps []*response
+	if err := json.Unmarshal(body, &resps); err != nil {
+		// a daemon rejecting the whole batch answers a single error response
+		var res response
+		if json.Unmarshal(body, &res) == nil && res.Error != nil && res.Error.Code != 0 {
+			return res.Error
+		}
+		return ErrInvalidResponse
+	}
+	for i := range batch {
+		batch[i].Error = ErrNoResponse
+	}
+	for _, res := range resps {
+		id, err := strconv.Atoi(string(bytes.Trim(res.ID, `"`)))
+		if err != nil || id < 0 || id >= len(batch) {
+			continue
+		}
+		batch[id].Error = res.decode(batch[id].Result)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDaemonClientBatchCall(t *testing.T) {
+	var requests int
+	var reply func(reqs []map[string]interface{}) string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, _ := ioutil.ReadAll(r.Body)
+		var reqs []map[string]interface{}
+		json.Unmarshal(body, &reqs)
+		w.Write([]byte(reply(reqs)))
+	}))
+	defer srv.Close()
+
+	client := NewDaemonClient([]string{srv.URL}, srv.Client())
+
+	Convey("test DaemonClient.BatchCall", t, func() {
+		requests = 0
+
+		Convey("results are matched by id", func() {
+			reply = func(reqs []map[string]interface{}) string {
+				return `[{"jsonrpc":"2.0","id":2,"result":"0x2"},
+					{"jsonrpc":"2.0","id":0,"result":"0x0"},
+					{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"execution reverted"}}]`
+			}
+			results := make([]string, 4)
+			batch := make([]BatchElem, 4)
+			for i := range batch {
+				batch[i] = BatchElem{Method: "eth_call", Params: []interface{}{i}, Result: &results[i]}
+			}
+			So(client.BatchCall(context.Background(), batch), ShouldBeNil)
+			So(requests, ShouldEqual, 1)
+			So(batch[0].Error, ShouldBeNil)
+			So(results[0], ShouldEqual, "0x0")
+			So(batch[1].Error, ShouldResemble, &RPCError{Code: -32000, Message: "execution reverted"})
+			So(batch[2].Error, ShouldBeNil)
+			So(results[2], ShouldEqual, "0x2")
+			So(batch[3].Error, ShouldEqual, ErrNoResponse)
+		})
+		Convey("large batches are split", func() {
+			reply = func(reqs []map[string]interface{}) string {
+				resps := make([]string, len(reqs))
+				for i, req := range reqs {
+					resps[i] = fmt.Sprintf(`{"jsonrpc":"2.0","id":%v,"result":%v}`, req["id"], req["params"].([]interface{})[0])
+				}
+				return "[" + strings.Join(resps, ",") + "]"
+			}
+			results := make([]int, maxBatchSize+10)
+			batch := make([]BatchElem, len(results))
+			for i := range batch {
+				batch[i] = BatchElem{Method: "eth_call", Params: []interface{}{i}, Result: &results[i]}
+			}
+			So(client.BatchCall(context.Background(), batch), ShouldBeNil)
+			So(requests, ShouldEqual, 2)
+			for i := range batch {
+				So(batch[i].Error, ShouldBeNil)
+				So(results[i], ShouldEqual, i)
+			}
+		})
+		Convey("a rejected batch", func() {
+			reply = func(reqs []map[string]interface{}) string {
+				return `{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"invalid request"}}`
+			}
+			err := client.BatchCall(context.Background(), []BatchElem{{Method: "eth_call"}})
+			So(err, ShouldResemble, &RPCError{Code: -32600, Message: "invalid request"})
+		})
+		Convey("an invalid response", func() {
+			reply = func(reqs []map[string]interface{}) string {
+				return `not json`
+			}
+			So(client.BatchCall(context.Background(), []BatchElem{{Method: "eth_call"}}), ShouldEqual, ErrInvalidResponse)
+		})
+		Convey("an empty batch", func() {
+			So(client.BatchCall(context.Background(), nil), ShouldBeNil)
+			So(requests, ShouldEqual, 0)
+		})
+	})
+}
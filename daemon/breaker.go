@@ -0,0 +1,88 @@
+package daemon
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/lianxiangcloud/linkchain/libs/log"
+)
+
+// ErrCircuitOpen is returned without calling the daemon while its circuit breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker open: daemon unavailable")
+
+// breaker fails the calls fast once threshold calls in a row could not reach the
+// daemon. After cooldown a single call is let through, which closes it again on success.
+type breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+// newBreaker returns a breaker, nil if threshold is not positive which lets every call through
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	if threshold <= 0 {
+		return nil
+	}
+	return &breaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow reports whether a call may be sent to the daemon
+func (b *breaker) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.probing || time.Now().Before(b.openUntil) {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// success records a call which reached the daemon
+func (b *breaker) success() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures >= b.threshold {
+		log.Info("Daemon circuit breaker closed")
+	}
+	b.failures, b.probing = 0, false
+}
+
+// failure records a call which could not reach the daemon
+func (b *breaker) failure() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.failures >= b.threshold {
+		if b.failures == b.threshold || b.probing {
+			log.Warn("Daemon circuit breaker open", "failures", b.failures, "cooldown", b.cooldown)
+		}
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+	b.probing = false
+}
+
+// release records a call given up by its caller, which says nothing about the daemon
+func (b *breaker) release() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
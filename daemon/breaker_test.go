@@ -0,0 +1,52 @@
+package daemon
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBreaker(t *testing.T) {
+	Convey("test breaker", t, func() {
+		b := newBreaker(2, 20*time.Millisecond)
+
+		Convey("opens after threshold failures in a row", func() {
+			b.failure()
+			So(b.allow(), ShouldBeTrue)
+			b.success()
+			b.failure()
+			So(b.allow(), ShouldBeTrue)
+			b.failure()
+			So(b.allow(), ShouldBeFalse)
+		})
+		Convey("lets a single call through after cooldown", func() {
+			b.failure()
+			b.failure()
+			time.Sleep(30 * time.Millisecond)
+			So(b.allow(), ShouldBeTrue)
+			So(b.allow(), ShouldBeFalse)
+
+			b.failure()
+			So(b.allow(), ShouldBeFalse)
+			time.Sleep(30 * time.Millisecond)
+			So(b.allow(), ShouldBeTrue)
+			b.success()
+			So(b.allow(), ShouldBeTrue)
+			So(b.allow(), ShouldBeTrue)
+		})
+		Convey("a released probe lets the next call through", func() {
+			b.failure()
+			b.failure()
+			time.Sleep(30 * time.Millisecond)
+			So(b.allow(), ShouldBeTrue)
+			b.release()
+			So(b.allow(), ShouldBeTrue)
+		})
+		Convey("disabled", func() {
+			b := newBreaker(0, time.Second)
+			b.failure()
+			So(b.allow(), ShouldBeTrue)
+		})
+	})
+}
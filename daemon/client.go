@@ -0,0 +1,70 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrEmptyResponse is returned by Call when the daemon answers without a body
+	ErrEmptyResponse = errors.New("empty response body")
+	// ErrInvalidResponse is returned by Call when the daemon answers something else than a JSON-RPC response
+	ErrInvalidResponse = errors.New("invalid JSON-RPC response")
+	// ErrInvalidResult is returned by Call when the result of the response does not decode into the result argument
+	ErrInvalidResult = errors.New("invalid JSON-RPC result")
+)
+
+// RPCError is the error object of a daemon response
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("json-rpc error %d: %s", e.Code, e.Message)
+}
+
+// Call calls method of the daemon with params and decodes the result into result, which may be nil.
+// The error object of the response is returned as *RPCError, a response which can not be
+// decoded as ErrInvalidResponse or ErrInvalidResult, any other error means the daemon is not reachable.
+func (c *DaemonClient) Call(ctx context.Context, method string, result interface{}, params ...interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+	body, err := c.callJSONRPC(ctx, method, params)
+	if err != nil {
+		return err
+	}
+	if len(body) == 0 {
+		return ErrEmptyResponse
+	}
+
+	var res response
+	if err := json.Unmarshal(body, &res); err != nil {
+		return ErrInvalidResponse
+	}
+	return res.decode(result)
+}
+
+// response is a JSON-RPC response of the daemon
+type response struct {
+	ID     json.RawMessage `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *RPCError       `json:"error"`
+}
+
+// decode returns the error object of r, or decodes its result into result, which may be nil
+func (r *response) decode(result interface{}) error {
+	if r.Error != nil && r.Error.Code != 0 {
+		return r.Error
+	}
+	if result == nil || len(r.Result) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(r.Result, result); err != nil {
+		return ErrInvalidResult
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDaemonClientCall(t *testing.T) {
+	var reply string
+	var request map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &request)
+		w.Write([]byte(reply))
+	}))
+	defer srv.Close()
+
+	client := NewDaemonClient([]string{srv.URL}, srv.Client())
+
+	Convey("test DaemonClient.Call", t, func() {
+		Convey("result", func() {
+			reply = `{"jsonrpc":"2.0","id":1,"result":"0xc0b"}`
+			var n string
+			err := client.Call(context.Background(), "eth_blockNumber", &n, "latest", false)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, "0xc0b")
+			So(request["method"], ShouldEqual, "eth_blockNumber")
+			So(request["params"], ShouldResemble, []interface{}{"latest", false})
+		})
+		Convey("no params", func() {
+			reply = `{"jsonrpc":"2.0","id":1,"result":null}`
+			err := client.Call(context.Background(), "eth_blockNumber", nil)
+			So(err, ShouldBeNil)
+			So(request["params"], ShouldResemble, []interface{}{})
+		})
+		Convey("error object", func() {
+			reply = `{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"execution reverted"}}`
+			err := client.Call(context.Background(), "eth_call", nil)
+			So(err, ShouldResemble, &RPCError{Code: -32000, Message: "execution reverted"})
+		})
+		Convey("invalid response", func() {
+			reply = `not json`
+			So(client.Call(context.Background(), "eth_call", nil), ShouldEqual, ErrInvalidResponse)
+		})
+		Convey("invalid result", func() {
+			reply = `{"jsonrpc":"2.0","id":1,"result":"0xc0b"}`
+			var n int
+			So(client.Call(context.Background(), "eth_blockNumber", &n), ShouldEqual, ErrInvalidResult)
+		})
+		Convey("empty response", func() {
+			reply = ``
+			So(client.Call(context.Background(), "eth_blockNumber", nil), ShouldEqual, ErrEmptyResponse)
+		})
+		Convey("canceled context", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			So(client.Call(ctx, "eth_blockNumber", nil), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestDaemonClientFailover(t *testing.T) {
+	handler := func(result string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"` + result + `"}`))
+		})
+	}
+	down := httptest.NewServer(handler("down"))
+	down.Close()
+	backup := httptest.NewServer(handler("backup"))
+	defer backup.Close()
+
+	client := NewDaemonClient([]string{down.URL, backup.URL}, http.DefaultClient)
+
+	Convey("test DaemonClient failover", t, func() {
+		var result string
+		So(client.Call(context.Background(), "eth_blockNumber", &result), ShouldBeNil)
+		So(result, ShouldEqual, "backup")
+		So(client.Endpoints.Current(), ShouldEqual, backup.URL)
+		So(client.Endpoints.Down(), ShouldResemble, []string{down.URL})
+
+		So(client.healthy(down.URL, healthCheckMethod), ShouldBeFalse)
+		So(client.healthy(backup.URL, healthCheckMethod), ShouldBeTrue)
+	})
+}
+
+func TestDaemonClientSendFailover(t *testing.T) {
+	var slowRequests, backupRequests int32
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&slowRequests, 1)
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer slow.Close()
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&backupRequests, 1)
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	defer backup.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	Convey("test DaemonClient failover of the methods that are not idempotent", t, func() {
+		slowRequests, backupRequests = 0, 0
+
+		Convey("a timed out send is not sent again", func() {
+			client := NewDaemonClient([]string{slow.URL, backup.URL}, http.DefaultClient, WithTimeout(10*time.Millisecond))
+			So(client.Call(context.Background(), "eth_sendRawTx", nil), ShouldNotBeNil)
+			So(slowRequests, ShouldEqual, 1)
+			So(backupRequests, ShouldEqual, 0)
+		})
+		Convey("a timed out read fails over", func() {
+			client := NewDaemonClient([]string{slow.URL, backup.URL}, http.DefaultClient, WithTimeout(10*time.Millisecond))
+			So(client.Call(context.Background(), "eth_call", nil), ShouldBeNil)
+			So(backupRequests, ShouldEqual, 1)
+		})
+		Convey("a send that could not connect fails over", func() {
+			client := NewDaemonClient([]string{down.URL, backup.URL}, http.DefaultClient)
+			So(client.Call(context.Background(), "eth_sendRawTx", nil), ShouldBeNil)
+			So(backupRequests, ShouldEqual, 1)
+		})
+	})
+}
+
+func TestDaemonClientRetry(t *testing.T) {
+	var requests, failures int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.AddInt32(&failures, -1) >= 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	defer srv.Close()
+
+	Convey("test DaemonClient retries", t, func() {
+		requests = 0
+		client := NewDaemonClient([]string{srv.URL}, srv.Client(), WithRetries(2), WithCircuitBreaker(2, time.Minute))
+
+		Convey("idempotent methods are retried", func() {
+			failures = 2
+			So(client.Call(context.Background(), "eth_call", nil), ShouldBeNil)
+			So(requests, ShouldEqual, 3)
+		})
+		Convey("other methods are not", func() {
+			failures = 1
+			So(client.Call(context.Background(), "eth_sendRawTx", nil), ShouldNotBeNil)
+			So(requests, ShouldEqual, 1)
+		})
+		Convey("the breaker fails fast", func() {
+			failures = 2
+			So(client.Call(context.Background(), "eth_sendRawTx", nil), ShouldNotBeNil)
+			So(client.Call(context.Background(), "eth_sendRawTx", nil), ShouldNotBeNil)
+			So(client.Call(context.Background(), "eth_call", nil), ShouldEqual, ErrCircuitOpen)
+			So(requests, ShouldEqual, 2)
+		})
+	})
+}
+
+func TestDaemonClientTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	Convey("test DaemonClient timeout", t, func() {
+		client := NewDaemonClient([]string{srv.URL}, srv.Client(), WithTimeout(10*time.Millisecond))
+		start := time.Now()
+		So(client.Call(context.Background(), "eth_sendRawTx", nil), ShouldNotBeNil)
+		So(time.Since(start), ShouldBeLessThan, 90*time.Millisecond)
+	})
+}
@@ -5,10 +5,13 @@ import (
 	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"math/rand"
 	"net"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/lianxiangcloud/linkchain/libs/log"
@@ -16,54 +19,141 @@ import (
 )
 
 type DaemonClient struct {
-	Addr string
+	Endpoints  *Endpoints
 	HttpClient *http.Client
+	quit       chan struct{}
+	timeout    time.Duration // of a request to a url, 0 for none
+	retries    int           // of the idempotent methods when the daemon is not reachable
+	breaker    *breaker
+	header     http.Header // added to the requests
 }
 
-//Daemon connect the linkchain node
-var gDaemonClient *DaemonClient
+// ClientOption sets an option of a DaemonClient
+type ClientOption func(*DaemonClient)
 
-//Wallet Daemon connect to the wallet node
-var gWalletDaemonClient *DaemonClient
+// WithTimeout bounds each request to a url of the daemon by timeout
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(c *DaemonClient) {
+		c.timeout = timeout
+	}
+}
+
+// WithRetries retries the idempotent methods up to retries times when the daemon is not reachable
+func WithRetries(retries int) ClientOption {
+	return func(c *DaemonClient) {
+		c.retries = retries
+	}
+}
+
+// WithCircuitBreaker fails the calls fast for cooldown once threshold calls in a row
+// could not reach the daemon, a threshold of 0 disables it
+func WithCircuitBreaker(threshold int, cooldown time.Duration) ClientOption {
+	return func(c *DaemonClient) {
+		c.breaker = newBreaker(threshold, cooldown)
+	}
+}
+
+// WithHeader adds header to the requests to the daemon
+func WithHeader(header http.Header) ClientOption {
+	return func(c *DaemonClient) {
+		c.header = header
+	}
+}
+
+// idempotentMethods are the read methods retried when the daemon is not reachable
+var idempotentMethods = map[string]bool{
+	"eth_call":                  true,
+	"eth_estimateGas":           true,
+	"eth_gasPrice":              true,
+	"ltk_estimateGas":           true,
+	"eth_getTransactionCount":   true,
+	"ltk_getTransactionCount":   true,
+	"eth_blockNumber":           true,
+	"eth_genesisBlockNumber":    true,
+	"eth_getBlockByNumber":      true,
+	"eth_getTransactionReceipt": true,
+	"ltk_status":                true,
+}
+
+var errNoEndpoint = errors.New("no daemon url configured")
+
+// dialError is the error of a request that could not connect to the daemon, it was not sent
+type dialError struct {
+	err error
+}
+
+func (e *dialError) Error() string {
+	return fmt.Sprintf("client.Do: %v", e.err)
+}
+
+// isDialError reports whether err of http.Client.Do failed to connect
+func isDialError(err error) bool {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	opErr, ok := err.(*net.OpError)
+	return ok && opErr.Op == "dial"
+}
 
 const (
 	defaultDialTimeout = 10 * time.Second
 	keepAliveInterval  = 30 * time.Second
+	healthCheckTimeout = 5 * time.Second
+	minRetryDelay      = 100 * time.Millisecond
+	maxRetryDelay      = 2 * time.Second
+
+	// methods called to check a failed url of the daemons
+	healthCheckMethod       = "eth_blockNumber"
+	walletHealthCheckMethod = "ltk_status"
 )
 
-func InitWalletDaemonClient(daemonConfig *config.DaemonConfig) {
-	gWalletDaemonClient = &DaemonClient{
-		Addr: daemonConfig.PeerRPC,
+// NewDaemonClient returns a client of the daemon at urls using httpClient
+func NewDaemonClient(urls []string, httpClient *http.Client, options ...ClientOption) *DaemonClient {
+	c := &DaemonClient{
+		Endpoints:  NewEndpoints(urls),
+		HttpClient: httpClient,
+		quit:       make(chan struct{}),
 	}
-
-	transport := &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: false,
-		},
-		ResponseHeaderTimeout: 2 * time.Minute,
-		DisableCompression:    true,
-		DisableKeepAlives:     false,
-		IdleConnTimeout:       2 * time.Minute,
-		MaxIdleConns:          4,
-		MaxIdleConnsPerHost:   2,
-		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
-			dialer := &net.Dialer{Timeout: defaultDialTimeout, KeepAlive: keepAliveInterval}
-			return dialer.DialContext(ctx, network, addr)
-		},
+	for _, option := range options {
+		option(c)
 	}
-	gWalletDaemonClient.HttpClient = &http.Client{
-		Transport: transport,
+	return c
+}
+
+// NewNodeClient returns a client of the linkchain node of daemonConfig, Close stops its health check.
+// An error is returned if the CA bundle or the client certificate can not be loaded.
+func NewNodeClient(daemonConfig *config.DaemonConfig) (*DaemonClient, error) {
+	return newConfigClient(daemonConfig, healthCheckMethod)
+}
+
+// NewWalletClient returns a client of the wallet node of daemonConfig, Close stops its health check.
+// An error is returned if the CA bundle or the client certificate can not be loaded.
+func NewWalletClient(daemonConfig *config.DaemonConfig) (*DaemonClient, error) {
+	return newConfigClient(daemonConfig, walletHealthCheckMethod)
+}
+
+func newConfigClient(daemonConfig *config.DaemonConfig, healthMethod string) (*DaemonClient, error) {
+	tlsConfig, err := TLSConfig(daemonConfig)
+	if err != nil {
+		return nil, err
 	}
+	c := NewDaemonClient(daemonConfig.RPCEndpoints(), newHTTPClient(tlsConfig), clientOptions(daemonConfig)...)
+	c.startHealthCheck(healthMethod, daemonConfig.HealthCheckInterval)
+	return c, nil
 }
-func InitDaemonClient(daemonConfig *config.DaemonConfig) {
-	gDaemonClient = &DaemonClient{
-		Addr: daemonConfig.PeerRPC,
+
+func clientOptions(daemonConfig *config.DaemonConfig) []ClientOption {
+	return []ClientOption{
+		WithTimeout(time.Duration(daemonConfig.Timeout) * time.Second),
+		WithRetries(daemonConfig.Retries),
+		WithCircuitBreaker(daemonConfig.BreakerThreshold, time.Duration(daemonConfig.BreakerCooldown)*time.Second),
+		WithHeader(RequestHeader(daemonConfig)),
 	}
+}
 
+func newHTTPClient(tlsConfig *tls.Config) *http.Client {
 	transport := &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: false,
-		},
+		TLSClientConfig:       tlsConfig,
 		ResponseHeaderTimeout: 2 * time.Minute,
 		DisableCompression:    true,
 		DisableKeepAlives:     false,
@@ -75,51 +165,205 @@ func InitDaemonClient(daemonConfig *config.DaemonConfig) {
 			return dialer.DialContext(ctx, network, addr)
 		},
 	}
-	gDaemonClient.HttpClient = &http.Client{
+	return &http.Client{
 		Transport: transport,
 	}
 }
-func CallJSONRPC(method string, params interface{}) ([]byte, error) {
-	return callJSONRPC(gDaemonClient, method, params)
+
+// Close stops the health check of c
+func (c *DaemonClient) Close() {
+	if c == nil {
+		return
+	}
+	select {
+	case <-c.quit:
+	default:
+		close(c.quit)
+	}
+}
+
+// startHealthCheck calls method on the failed urls every interval seconds
+// and marks them up when they answer. Nothing is checked with a single url.
+func (c *DaemonClient) startHealthCheck(method string, interval int) {
+	if c.Endpoints.Len() < 2 || interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				for _, url := range c.Endpoints.Down() {
+					if c.healthy(url, method) {
+						c.Endpoints.Up(url)
+						c.breaker.success()
+					}
+				}
+			case <-c.quit:
+				return
+			}
+		}
+	}()
 }
 
-func WalletCallJSONRPC(method string, params interface{}) ([]byte, error) {
-	return callJSONRPC(gWalletDaemonClient, method, params)
+// healthy reports whether the daemon at url answers a call of method
+func (c *DaemonClient) healthy(url, method string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+	data, err := requestData(method, []interface{}{})
+	if err != nil {
+		return false
+	}
+	body, err := post(ctx, c.HttpClient, c.header, url, method, data)
+	if err != nil {
+		log.Debug("Daemon health check", "url", url, "err", err)
+		return false
+	}
+	return json.Valid(body)
 }
 
-// CallJSONRPC call  /json_rpc func
+// callJSONRPC call  /json_rpc func
 // curl -X POST http://127.0.0.1:18081/json_rpc -d '{"jsonrpc":"2.0","id":"0","method":"get_block","params":{"height":912345}}' -H 'Content-Type: application/json'
-func callJSONRPC(daemonClient *DaemonClient, method string, params interface{}) ([]byte, error) {
-	urlPath := ""
-	if len(method) >= 4 {
-		urlPath = method[4:]
+func (c *DaemonClient) callJSONRPC(ctx context.Context, method string, params interface{}) ([]byte, error) {
+	data, err := requestData(method, params)
+	if err != nil {
+		return nil, err
 	}
+	return c.request(ctx, method, method, data, idempotentMethods[method])
+}
+
+// request posts the request data to the url path of method and returns the response body,
+// label names the request in the metrics. An idempotent request is retried with a jittered
+// backoff when no url of c is reachable.
+func (c *DaemonClient) request(ctx context.Context, label string, method string, data []byte, idempotent bool) ([]byte, error) {
+	start := time.Now()
+	status := "unavailable"
+	defer func() {
+		daemonMetrics.Calls.With("method", label, "status", status).Add(1)
+		daemonMetrics.CallDuration.With("method", label).Observe(time.Since(start).Seconds())
+	}()
 
-	url := fmt.Sprintf("%s/%s", daemonClient.Addr, urlPath)
+	if !c.breaker.allow() {
+		status = "circuit_open"
+		return nil, ErrCircuitOpen
+	}
+	attempts := 1
+	if idempotent {
+		attempts += c.retries
+	}
+	var err error
+	for attempt := 0; ; attempt++ {
+		var body []byte
+		if body, err = c.send(ctx, method, data, idempotent); err == nil {
+			c.breaker.success()
+			status = responseStatus(body)
+			return body, nil
+		}
+		if ctx.Err() != nil || attempt+1 >= attempts {
+			break
+		}
+		delay := retryDelay(attempt)
+		log.Debug("CallJSONRPC retry", "method", label, "attempt", attempt+1, "delay", delay, "err", err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+	}
+	if ctx.Err() != nil {
+		c.breaker.release()
+		return nil, ctx.Err()
+	}
+	c.breaker.failure()
+	return nil, err
+}
 
+// send posts data to the selected url of c, the other urls are tried when it fails.
+// A request that is not idempotent is only sent to another url if it could not connect:
+// the daemon may have run it when it timed out or answered with an error status.
+func (c *DaemonClient) send(ctx context.Context, method string, data []byte, idempotent bool) ([]byte, error) {
+	err := errNoEndpoint
+	for i := 0; i < c.Endpoints.Len(); i++ {
+		addr := c.Endpoints.Current()
+		var body []byte
+		if body, err = c.post(ctx, addr, method, data); err == nil {
+			return body, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		c.Endpoints.Failed(addr, err)
+		if _, ok := err.(*dialError); !ok && !idempotent {
+			break
+		}
+	}
+	return nil, err
+}
+
+// post sends data to addr within the timeout of c
+func (c *DaemonClient) post(ctx context.Context, addr string, method string, data []byte) ([]byte, error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+	return post(ctx, c.HttpClient, c.header, addr, method, data)
+}
+
+// retryDelay returns the jittered delay before retry attempt+1, doubling from minRetryDelay up to maxRetryDelay
+func retryDelay(attempt int) time.Duration {
+	delay := maxRetryDelay
+	if attempt < 5 {
+		if d := minRetryDelay << uint(attempt); d < maxRetryDelay {
+			delay = d
+		}
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+func requestData(method string, params interface{}) ([]byte, error) {
+	return json.Marshal(requestMessage(1, method, params))
+}
+
+// requestMessage returns the JSON-RPC request id of method with params
+func requestMessage(id int, method string, params interface{}) map[string]interface{} {
 	requestData := make(map[string]interface{})
 
 	requestData["jsonrpc"] = "2.0"
-	requestData["id"] = 1
+	requestData["id"] = id
 	requestData["method"] = method
 	requestData["params"] = params
 
-	client := daemonClient.HttpClient
-	data, err := json.Marshal(requestData)
-	if err != nil {
-		return nil, err
+	return requestData
+}
+
+// post sends the JSON-RPC request data of method with header to the daemon at addr and returns the response body
+func post(ctx context.Context, client *http.Client, header http.Header, addr string, method string, data []byte) ([]byte, error) {
+	urlPath := ""
+	if len(method) >= 4 {
+		urlPath = method[4:]
 	}
+
+	url := fmt.Sprintf("%s/%s", addr, urlPath)
+
 	log.Debug("CallJSONRPC", "url", url, "data", string(data))
 	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
 	if err != nil {
 		return nil, fmt.Errorf("NewRequest: err=%v", err)
 	}
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("nc", "IN")
-	req = req.WithContext(context.Background())
+	for key, values := range header {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req = req.WithContext(ctx)
 	resp, err := client.Do(req)
 	if err != nil {
 		// log.Error("CallJSONRPC client.Do", "err", err)
+		if isDialError(err) {
+			return nil, &dialError{err}
+		}
 		return nil, fmt.Errorf("client.Do: %v", err)
 	}
 	defer resp.Body.Close()
@@ -135,3 +379,16 @@ func callJSONRPC(daemonClient *DaemonClient, method string, params interface{})
 	log.Debug("CallJSONRPC", "return", string(body))
 	return body, nil
 }
+
+// responseStatus returns "error" if body is a JSON-RPC error response, "ok" otherwise
+func responseStatus(body []byte) string {
+	var res struct {
+		Error *struct {
+			Code int `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &res); err == nil && res.Error != nil && res.Error.Code != 0 {
+		return "error"
+	}
+	return "ok"
+}
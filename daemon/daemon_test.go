@@ -1,170 +1,78 @@
-//go test -gcflags=-l -v
-
 package daemon
 
 import (
-	"encoding/json"
-	"fmt"
-	"io"
+	"context"
 	"io/ioutil"
 	"net/http"
-	"reflect"
-	"strings"
+	"net/http/httptest"
 	"testing"
 
-	. "github.com/bouk/monkey"
-	cfg "github.com/lianxiangcloud/lkdex/config"
 	"github.com/lianxiangcloud/linkchain/libs/log"
 	. "github.com/smartystreets/goconvey/convey"
-	"gopkg.in/h2non/gock.v1"
 )
 
 func TestCallJSONRPC(t *testing.T) {
-	defer gock.Off()
-	config := cfg.DefaultConfig()
-	config.Daemon.PeerRPC = "http://127.0.0.1:15000"
-
-	InitDaemonClient(config.Daemon)
 	log.ParseLogLevel("*:error", log.Root(), "info")
 
-	host := "http://127.0.0.1:15000/blockNumber"
-	matchType := "application/json"
-	bodyOK := `{"jsonrpc":"2.0","id":"0","method":"eth_blockNumber","params":[]}`
-	replyOK := 200
-	replyServerErr := 500
-	replyNotFound := 404
+	bodyOK := `{"id":1,"jsonrpc":"2.0","method":"eth_blockNumber","params":[]}`
 	bodyReturnOK := `{"jsonrpc":"2.0","id":"0","result":"0xc0b"}`
 
-	Convey("test daemon.CallJSONRPC", t, func() {
+	var status int
+	var path, contentType, request string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		path, contentType, request = r.URL.Path, r.Header.Get("Content-Type"), string(body)
+		w.WriteHeader(status)
+		w.Write([]byte(bodyReturnOK))
+	}))
+	defer srv.Close()
+
+	client := NewDaemonClient([]string{srv.URL}, srv.Client())
+	ctx := context.Background()
+	p := make([]interface{}, 0)
+
+	Convey("test DaemonClient.callJSONRPC", t, func() {
 		Convey("http status 200", func() {
-			gock.New(host).
-				// Post("").
-				MatchType(matchType).
-				BodyString(bodyOK).
-				Reply(replyOK).
-				BodyString(bodyReturnOK)
-
-			gock.InterceptClient(gDaemonClient.HttpClient)
-
-			p := make([]interface{}, 0)
-			body, err := CallJSONRPC("eth_blockNumber", p)
-			log.Debug("TestCallJSONRPC", "body", string(body), "err", err)
-			//several So assert
-			So(strings.Compare(string(body), bodyReturnOK) == 0 && err == nil, ShouldBeTrue)
+			status = http.StatusOK
+			body, err := client.callJSONRPC(ctx, "eth_blockNumber", p)
+			So(err, ShouldBeNil)
+			So(string(body), ShouldEqual, bodyReturnOK)
+			So(path, ShouldEqual, "/blockNumber")
+			So(contentType, ShouldEqual, "application/json")
+			So(request, ShouldEqual, bodyOK)
 		})
-
 		Convey("http status 500", func() {
-			gock.New(host).
-				// Post("").
-				MatchType(matchType).
-				BodyString(bodyOK).
-				Reply(replyServerErr).
-				BodyString(bodyReturnOK)
-
-			gock.InterceptClient(gDaemonClient.HttpClient)
-
-			p := make([]interface{}, 0)
-			_, err := CallJSONRPC("eth_blockNumber", p)
-			So(err != nil, ShouldBeTrue)
+			status = http.StatusInternalServerError
+			_, err := client.callJSONRPC(ctx, "eth_blockNumber", p)
+			So(err, ShouldNotBeNil)
 		})
 		Convey("http status 404", func() {
-			gock.New(host).
-				// Post("").
-				MatchType(matchType).
-				BodyString(bodyOK).
-				Reply(replyNotFound).
-				BodyString(bodyReturnOK)
-
-			gock.InterceptClient(gDaemonClient.HttpClient)
-
-			p := make([]interface{}, 0)
-			_, err := CallJSONRPC("eth_blockNumber", p)
-			So(err != nil, ShouldBeTrue)
+			status = http.StatusNotFound
+			_, err := client.callJSONRPC(ctx, "eth_blockNumber", p)
+			So(err, ShouldNotBeNil)
 		})
 		Convey("client.Do err", func() {
-			gock.New(host).
-				// Post("").
-				MatchType(matchType).
-				BodyString(bodyOK).
-				Reply(replyOK).
-				BodyString(bodyReturnOK)
-
-			client := gDaemonClient.HttpClient
-
-			guard := PatchInstanceMethod(reflect.TypeOf(client), "Do", func(*http.Client, *http.Request) (*http.Response, error) {
-				return nil, fmt.Errorf("client do err")
-			})
-			defer guard.Unpatch()
-
-			gock.InterceptClient(client)
-
-			p := make([]interface{}, 0)
-			_, err := CallJSONRPC("eth_blockNumber", p)
-			So(err != nil, ShouldBeTrue)
+			closed := httptest.NewServer(http.NotFoundHandler())
+			closed.Close()
+			_, err := NewDaemonClient([]string{closed.URL}, srv.Client()).callJSONRPC(ctx, "eth_blockNumber", p)
+			So(err, ShouldNotBeNil)
 		})
 		Convey("ioutil.ReadAll err", func() {
-			gock.New(host).
-				// Post("").
-				MatchType(matchType).
-				BodyString(bodyOK).
-				Reply(replyOK).
-				BodyString(bodyReturnOK)
-
-			client := gDaemonClient.HttpClient
-
-			guard := Patch(ioutil.ReadAll, func(r io.Reader) ([]byte, error) {
-				return nil, fmt.Errorf("ioutil.ReadAll err")
-			})
-			defer guard.Unpatch()
-
-			gock.InterceptClient(client)
-
-			p := make([]interface{}, 0)
-			_, err := CallJSONRPC("eth_blockNumber", p)
-			So(err != nil, ShouldBeTrue)
+			short := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Length", "100")
+				w.Write([]byte(bodyReturnOK))
+			}))
+			defer short.Close()
+			_, err := NewDaemonClient([]string{short.URL}, short.Client()).callJSONRPC(ctx, "eth_blockNumber", p)
+			So(err, ShouldNotBeNil)
 		})
 		Convey("http.NewRequest err", func() {
-			gock.New(host).
-				// Post("").
-				MatchType(matchType).
-				BodyString(bodyOK).
-				Reply(replyOK).
-				BodyString(bodyReturnOK)
-
-			client := gDaemonClient.HttpClient
-
-			guard := Patch(http.NewRequest, func(method, url string, body io.Reader) (*http.Request, error) {
-				return nil, fmt.Errorf("http.NewRequest err")
-			})
-			defer guard.Unpatch()
-
-			gock.InterceptClient(client)
-
-			p := make([]interface{}, 0)
-			_, err := CallJSONRPC("eth_blockNumber", p)
-			So(err != nil, ShouldBeTrue)
+			_, err := NewDaemonClient([]string{"http://127.0.0.1:15000\x7f"}, srv.Client()).callJSONRPC(ctx, "eth_blockNumber", p)
+			So(err, ShouldNotBeNil)
 		})
-
 		Convey("json.Marshal err", func() {
-			gock.New(host).
-				// Post("").
-				MatchType(matchType).
-				BodyString(bodyOK).
-				Reply(replyOK).
-				BodyString(bodyReturnOK)
-
-			client := gDaemonClient.HttpClient
-
-			guard := Patch(json.Marshal, func(v interface{}) ([]byte, error) {
-				return nil, fmt.Errorf("json.Marshal err")
-			})
-			defer guard.Unpatch()
-
-			gock.InterceptClient(client)
-
-			p := make([]interface{}, 0)
-			_, err := CallJSONRPC("eth_blockNumber", p)
-			So(err != nil, ShouldBeTrue)
+			_, err := client.callJSONRPC(ctx, "eth_blockNumber", []interface{}{make(chan int)})
+			So(err, ShouldNotBeNil)
 		})
 	})
 }
@@ -0,0 +1,100 @@
+package daemon
+
+import (
+	"sync"
+
+	"github.com/lianxiangcloud/linkchain/libs/log"
+)
+
+// Endpoints are the urls of a daemon. The current url is kept until it fails,
+// then the next url not known to be down is selected.
+type Endpoints struct {
+	mu      sync.Mutex
+	urls    []string
+	down    []bool
+	current int
+}
+
+// NewEndpoints returns the endpoints of urls, starting with the first one
+func NewEndpoints(urls []string) *Endpoints {
+	return &Endpoints{
+		urls: urls,
+		down: make([]bool, len(urls)),
+	}
+}
+
+// Len returns the number of urls
+func (e *Endpoints) Len() int {
+	return len(e.urls)
+}
+
+// Current returns the selected url, empty if there is none
+func (e *Endpoints) Current() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.urls) == 0 {
+		return ""
+	}
+	return e.urls[e.current]
+}
+
+// Failed marks url down. If url is the selected one the next url which is not
+// down is selected, or just the next one when all of them are down.
+func (e *Endpoints) Failed(url string, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	i := e.index(url)
+	if i < 0 {
+		return
+	}
+	e.down[i] = true
+	if i != e.current || len(e.urls) == 1 {
+		return
+	}
+	next := (i + 1) % len(e.urls)
+	for j := 1; j < len(e.urls); j++ {
+		if k := (i + j) % len(e.urls); !e.down[k] {
+			next = k
+			break
+		}
+	}
+	e.current = next
+	log.Warn("Daemon endpoint failed", "url", url, "err", err, "next", e.urls[next])
+}
+
+// Up marks url reachable again, it is selected if the selected url is down
+func (e *Endpoints) Up(url string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	i := e.index(url)
+	if i < 0 || !e.down[i] {
+		return
+	}
+	e.down[i] = false
+	if e.down[e.current] {
+		e.current = i
+	}
+	log.Info("Daemon endpoint is up", "url", url)
+}
+
+// Down returns the urls marked down
+func (e *Endpoints) Down() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var urls []string
+	for i, down := range e.down {
+		if down {
+			urls = append(urls, e.urls[i])
+		}
+	}
+	return urls
+}
+
+func (e *Endpoints) index(url string) int {
+	for i, u := range e.urls {
+		if u == url {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,46 @@
+package daemon
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEndpoints(t *testing.T) {
+	errDown := errors.New("down")
+
+	Convey("test Endpoints", t, func() {
+		e := NewEndpoints([]string{"a", "b", "c"})
+		So(e.Current(), ShouldEqual, "a")
+
+		Convey("a failed url is left for the next one", func() {
+			e.Failed("a", errDown)
+			So(e.Current(), ShouldEqual, "b")
+			So(e.Down(), ShouldResemble, []string{"a"})
+		})
+		Convey("the selection is sticky", func() {
+			e.Failed("a", errDown)
+			e.Up("a")
+			So(e.Current(), ShouldEqual, "b")
+			So(e.Down(), ShouldBeEmpty)
+		})
+		Convey("the urls known down are skipped", func() {
+			e.Failed("c", errDown)
+			So(e.Current(), ShouldEqual, "a")
+			e.Failed("a", errDown)
+			So(e.Current(), ShouldEqual, "b")
+		})
+		Convey("all urls down", func() {
+			e.Failed("a", errDown)
+			e.Failed("b", errDown)
+			e.Failed("c", errDown)
+			So(e.Current(), ShouldEqual, "a")
+			e.Up("b")
+			So(e.Current(), ShouldEqual, "b")
+		})
+		Convey("no url", func() {
+			So(NewEndpoints(nil).Current(), ShouldEqual, "")
+		})
+	})
+}
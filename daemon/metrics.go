@@ -0,0 +1,53 @@
+package daemon
+
+import (
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+
+	prometheus "github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+)
+
+// MetricsSubsystem is the subsystem of the daemon metrics
+const MetricsSubsystem = "daemon"
+
+// Metrics contains metrics exposed by this package.
+type Metrics struct {
+	// Number of calls to the daemons, by method ("batch" for a batch request) and status ("ok", "error", "unavailable" or "circuit_open").
+	Calls metrics.Counter
+	// Time of a call to the daemons in seconds, by method.
+	CallDuration metrics.Histogram
+}
+
+// PrometheusMetrics returns Metrics build using Prometheus client library.
+func PrometheusMetrics(namespace string) *Metrics {
+	return &Metrics{
+		Calls: prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: MetricsSubsystem,
+			Name:      "calls_total",
+			Help:      "Number of calls to the daemons.",
+		}, []string{"method", "status"}),
+		CallDuration: prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: MetricsSubsystem,
+			Name:      "call_duration_seconds",
+			Help:      "Time of a call to the daemons in seconds.",
+		}, []string{"method"}),
+	}
+}
+
+// NopMetrics returns no-op Metrics.
+func NopMetrics() *Metrics {
+	return &Metrics{
+		Calls:        discard.NewCounter(),
+		CallDuration: discard.NewHistogram(),
+	}
+}
+
+var daemonMetrics = NopMetrics()
+
+// SetMetrics sets the metrics of the calls to the daemons
+func SetMetrics(m *Metrics) {
+	daemonMetrics = m
+}
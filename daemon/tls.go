@@ -0,0 +1,68 @@
+package daemon
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/lianxiangcloud/lkdex/config"
+)
+
+// TLSConfig returns the tls config of the https and wss connections of daemonConfig: the
+// daemon certificates are verified with the CA bundle if it is set, and the client certificate
+// is presented for mutual TLS if it is set.
+func TLSConfig(daemonConfig *config.DaemonConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+	if path := daemonConfig.CAFilePath(); path != "" {
+		pem, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate in CA file %s", path)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if daemonConfig.CertFile != "" || daemonConfig.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(daemonConfig.CertFilePath(), daemonConfig.KeyFilePath())
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// RequestHeader returns the header of the requests to the daemon of daemonConfig:
+// the nc header and the Authorization of its login
+func RequestHeader(daemonConfig *config.DaemonConfig) http.Header {
+	header := make(http.Header)
+	if daemonConfig.NC != "" {
+		header.Set("nc", daemonConfig.NC)
+	}
+	if auth := Authorization(daemonConfig.Login); auth != "" {
+		header.Set("Authorization", auth)
+	}
+	return header
+}
+
+// Authorization returns the Authorization header of login: "user:password" is sent with
+// basic auth, "Bearer <token>" and a token without ':' with bearer auth, "" is not sent
+func Authorization(login string) string {
+	const bearer = "bearer "
+	switch {
+	case login == "":
+		return ""
+	case len(login) > len(bearer) && strings.EqualFold(login[:len(bearer)], bearer):
+		return "Bearer " + strings.TrimSpace(login[len(bearer):])
+	case strings.Contains(login, ":"):
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(login))
+	default:
+		return "Bearer " + login
+	}
+}
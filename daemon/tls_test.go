@@ -0,0 +1,168 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lianxiangcloud/lkdex/config"
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/websocket"
+)
+
+func TestAuthorization(t *testing.T) {
+	Convey("test Authorization", t, func() {
+		So(Authorization(""), ShouldEqual, "")
+		So(Authorization("user:pass"), ShouldEqual, "Basic dXNlcjpwYXNz")
+		So(Authorization("Bearer abc.def"), ShouldEqual, "Bearer abc.def")
+		So(Authorization("bearer abc"), ShouldEqual, "Bearer abc")
+		So(Authorization("token"), ShouldEqual, "Bearer token")
+	})
+}
+
+func TestDaemonTLS(t *testing.T) {
+	var header http.Header
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "lkdex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := ioutil.WriteFile(filepath.Join(dir, "ca.pem"), ca, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	Convey("test the tls config and the header of a DaemonClient", t, func() {
+		cfg := config.DefaultDaemonConfig()
+		cfg.PeerRPC = srv.URL
+		cfg.RootDir = dir
+		cfg.Login = "user:pass"
+
+		Convey("the system roots do not verify the daemon", func() {
+			c, err := NewNodeClient(cfg)
+			So(err, ShouldBeNil)
+			defer c.Close()
+			_, err = c.callJSONRPC(context.Background(), "eth_blockNumber", []interface{}{})
+			So(err, ShouldNotBeNil)
+		})
+		Convey("the CA bundle verifies the daemon", func() {
+			cfg.CAFile = "ca.pem"
+			c, err := NewNodeClient(cfg)
+			So(err, ShouldBeNil)
+			defer c.Close()
+			_, err = c.callJSONRPC(context.Background(), "eth_blockNumber", []interface{}{})
+			So(err, ShouldBeNil)
+			So(header.Get("Authorization"), ShouldEqual, "Basic dXNlcjpwYXNz")
+			So(header.Get("nc"), ShouldEqual, "IN")
+		})
+		Convey("a missing CA bundle", func() {
+			cfg.CAFile = "missing.pem"
+			_, err := NewNodeClient(cfg)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("a CA bundle without certificates", func() {
+			cfg.CAFile = "empty.pem"
+			So(ioutil.WriteFile(filepath.Join(dir, "empty.pem"), []byte("none"), 0600), ShouldBeNil)
+			_, err := NewNodeClient(cfg)
+			So(err, ShouldNotBeNil)
+		})
+		Convey("a missing client certificate", func() {
+			cfg.CertFile, cfg.KeyFile = "client.pem", "client.key"
+			_, err := NewNodeClient(cfg)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestWSClient(t *testing.T) {
+	headers := make(chan http.Header, 1)
+	unsubscribed := make(chan string, 1)
+	srv := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		headers <- ws.Request().Header
+		for {
+			var req struct {
+				ID     int               `json:"id"`
+				Method string            `json:"method"`
+				Params []json.RawMessage `json:"params"`
+			}
+			if err := websocket.JSON.Receive(ws, &req); err != nil {
+				return
+			}
+			switch req.Method {
+			case "test_echo":
+				websocket.Message.Send(ws, fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":%s}`, req.ID, req.Params[0]))
+			case "lk_subscribe":
+				// the notifications follow the response at once
+				websocket.Message.Send(ws, fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":"0x1"}`, req.ID))
+				for i := 1; i <= 3; i++ {
+					websocket.Message.Send(ws, fmt.Sprintf(`{"jsonrpc":"2.0","method":"lk_subscription","params":{"subscription":"0x1","result":%d}}`, i))
+				}
+			case "lk_unsubscribe":
+				unsubscribed <- string(req.Params[0])
+				websocket.Message.Send(ws, fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"result":true}`, req.ID))
+			case "test_close":
+				return
+			default:
+				websocket.Message.Send(ws, fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"error":{"code":-32601,"message":"not found"}}`, req.ID))
+			}
+		}
+	}))
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	Convey("test WSClient", t, func() {
+		cfg := config.DefaultDaemonConfig()
+		d, err := NewWSDialer(cfg)
+		So(err, ShouldBeNil)
+		So(d, ShouldBeNil)
+
+		cfg.Login = "token"
+		d, err = NewWSDialer(cfg)
+		So(err, ShouldBeNil)
+		So(d, ShouldNotBeNil)
+
+		c, err := d.Dial(context.Background(), url)
+		So(err, ShouldBeNil)
+		defer c.Close()
+		So((<-headers).Get("Authorization"), ShouldEqual, "Bearer token")
+
+		var res string
+		So(c.CallContext(context.Background(), &res, "test_echo", "hi"), ShouldBeNil)
+		So(res, ShouldEqual, "hi")
+		err = c.CallContext(context.Background(), &res, "test_missing")
+		So(err, ShouldHaveSameTypeAs, &RPCError{})
+		So(err.(*RPCError).Code, ShouldEqual, -32601)
+
+		ch := make(chan int)
+		sub, err := c.Subscribe(context.Background(), "lk", ch, "logsSubscribe")
+		So(err, ShouldBeNil)
+		for i := 1; i <= 3; i++ {
+			So(<-ch, ShouldEqual, i)
+		}
+		sub.Unsubscribe()
+		So(<-unsubscribed, ShouldEqual, `"0x1"`)
+		_, ok := <-sub.Err()
+		So(ok, ShouldBeFalse)
+
+		// the subscriptions and the calls fail once the websocket is closed
+		sub, err = c.Subscribe(context.Background(), "lk", ch, "logsSubscribe")
+		So(err, ShouldBeNil)
+		So(c.CallContext(context.Background(), nil, "test_close"), ShouldNotBeNil)
+		So(<-sub.Err(), ShouldNotBeNil)
+		So(c.CallContext(context.Background(), &res, "test_echo", "hi"), ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,68 @@
+package daemon
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/lianxiangcloud/lkdex/config"
+	"golang.org/x/net/websocket"
+)
+
+// WSDialer opens the websockets of the ws urls of a daemon with its tls config and request header
+type WSDialer struct {
+	tlsConfig *tls.Config
+	header    http.Header
+}
+
+// NewWSDialer returns the WSDialer of daemonConfig, nil if it sets neither a login nor TLS
+// files: the ws urls are dialed by rpc.Dial then. An error is returned if the CA bundle or the
+// client certificate can not be loaded.
+func NewWSDialer(daemonConfig *config.DaemonConfig) (*WSDialer, error) {
+	if daemonConfig.Login == "" && daemonConfig.CAFile == "" && daemonConfig.CertFile == "" && daemonConfig.KeyFile == "" {
+		return nil, nil
+	}
+	tlsConfig, err := TLSConfig(daemonConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &WSDialer{tlsConfig: tlsConfig, header: RequestHeader(daemonConfig)}, nil
+}
+
+// Dial opens a websocket to url and returns a JSON-RPC client over it: rpc.DialWebsocket takes
+// neither a tls config nor a header.
+func (d *WSDialer) Dial(ctx context.Context, url string) (*WSClient, error) {
+	ws, err := d.dialWebsocket(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return newWSClient(ws), nil
+}
+
+func (d *WSDialer) dialWebsocket(ctx context.Context, url string) (*websocket.Conn, error) {
+	origin, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(url, "wss") {
+		origin = "https://" + strings.ToLower(origin)
+	} else {
+		origin = "http://" + strings.ToLower(origin)
+	}
+	wsConfig, err := websocket.NewConfig(url, origin)
+	if err != nil {
+		return nil, err
+	}
+	wsConfig.TlsConfig = d.tlsConfig
+	for key, values := range d.header {
+		wsConfig.Header[key] = values
+	}
+	wsConfig.Dialer = &net.Dialer{Timeout: defaultDialTimeout, KeepAlive: keepAliveInterval}
+	if deadline, ok := ctx.Deadline(); ok {
+		wsConfig.Dialer.Deadline = deadline
+	}
+	return websocket.DialConfig(wsConfig)
+}
@@ -0,0 +1,306 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lianxiangcloud/linkchain/libs/log"
+	"golang.org/x/net/websocket"
+)
+
+var (
+	// ErrWSClientClosed is returned by the calls of a closed WSClient
+	ErrWSClientClosed = errors.New("websocket client closed")
+	// ErrSubscriptionQueueOverflow is sent on the Err channel of a subscription whose channel
+	// is not read while maxSubscriptionBuffer notifications are queued
+	ErrSubscriptionQueueOverflow = errors.New("subscription queue overflow")
+)
+
+const (
+	maxSubscriptionBuffer = 8000
+	unsubscribeTimeout    = 5 * time.Second
+)
+
+// WSClient is a JSON-RPC client over a websocket opened by a WSDialer, it serves the calls and the
+// subscriptions of a daemon like rpc.Client. Each websocket message is one JSON-RPC message.
+type WSClient struct {
+	ws     *websocket.Conn
+	closed chan struct{} // closed once the websocket is
+
+	mu     sync.Mutex
+	nextID int
+	calls  map[int]*wsCall
+	subs   map[string]*WSSubscription
+	err    error // that closed the websocket
+}
+
+// wsCall waits for the response of a request, sub is registered by the response of a subscribe request
+type wsCall struct {
+	resp chan *response
+	sub  *WSSubscription
+}
+
+// wsMessage is a response or a subscription notification of the daemon
+type wsMessage struct {
+	response
+	Method string `json:"method"`
+	Params *struct {
+		Subscription string          `json:"subscription"`
+		Result       json.RawMessage `json:"result"`
+	} `json:"params"`
+}
+
+func newWSClient(ws *websocket.Conn) *WSClient {
+	c := &WSClient{
+		ws:     ws,
+		closed: make(chan struct{}),
+		calls:  make(map[int]*wsCall),
+		subs:   make(map[string]*WSSubscription),
+	}
+	go c.read()
+	return c
+}
+
+// Close closes the websocket, the pending calls return ErrWSClientClosed and the subscriptions fail
+func (c *WSClient) Close() {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = ErrWSClientClosed
+	}
+	c.mu.Unlock()
+	c.ws.Close()
+}
+
+// CallContext calls method with args and decodes the result into result, which may be nil.
+// The error object of the response is returned as *RPCError.
+func (c *WSClient) CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error {
+	res, err := c.call(ctx, &wsCall{resp: make(chan *response, 1)}, method, args)
+	if err != nil {
+		return err
+	}
+	return res.decode(result)
+}
+
+// Subscribe subscribes to the notifications of namespace_subscribe with args, they are decoded
+// into the element type of channel and sent to it. A channel which is not read while
+// maxSubscriptionBuffer notifications are queued fails the subscription with ErrSubscriptionQueueOverflow.
+func (c *WSClient) Subscribe(ctx context.Context, namespace string, channel interface{}, args ...interface{}) (*WSSubscription, error) {
+	chanVal := reflect.ValueOf(channel)
+	if chanVal.Kind() != reflect.Chan || chanVal.Type().ChanDir()&reflect.SendDir == 0 {
+		panic("first argument to Subscribe must be a writable channel")
+	}
+	if chanVal.IsNil() {
+		panic("channel given to Subscribe must not be nil")
+	}
+	sub := &WSSubscription{
+		client:    c,
+		namespace: namespace,
+		channel:   chanVal,
+		in:        make(chan json.RawMessage),
+		quit:      make(chan struct{}),
+		err:       make(chan error, 1),
+	}
+	res, err := c.call(ctx, &wsCall{resp: make(chan *response, 1), sub: sub}, namespace+"_subscribe", args)
+	if err != nil {
+		return nil, err
+	}
+	if err := res.decode(nil); err != nil {
+		return nil, err
+	}
+	if sub.id == "" {
+		return nil, ErrInvalidResult
+	}
+	return sub, nil
+}
+
+// call sends the request of method with args and waits for its response
+func (c *WSClient) call(ctx context.Context, op *wsCall, method string, args []interface{}) (*response, error) {
+	if args == nil {
+		args = []interface{}{}
+	}
+	c.mu.Lock()
+	if c.err != nil {
+		err := c.err
+		c.mu.Unlock()
+		return nil, err
+	}
+	c.nextID++
+	id := c.nextID
+	c.calls[id] = op
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.calls, id)
+		c.mu.Unlock()
+	}()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		c.ws.SetWriteDeadline(deadline)
+	} else {
+		c.ws.SetWriteDeadline(time.Time{})
+	}
+	if err := websocket.JSON.Send(c.ws, requestMessage(id, method, args)); err != nil {
+		return nil, err
+	}
+	select {
+	case res := <-op.resp:
+		return res, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.closed:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return nil, c.err
+	}
+}
+
+// read dispatches the messages of the websocket until it is closed
+func (c *WSClient) read() {
+	var err error
+	for {
+		var msg wsMessage
+		if err = websocket.JSON.Receive(c.ws, &msg); err != nil {
+			break
+		}
+		if msg.Params != nil && strings.HasSuffix(msg.Method, "_subscription") {
+			c.mu.Lock()
+			sub := c.subs[msg.Params.Subscription]
+			c.mu.Unlock()
+			if sub != nil {
+				sub.deliver(msg.Params.Result)
+			}
+			continue
+		}
+		var id int
+		if json.Unmarshal(msg.ID, &id) != nil {
+			log.Debug("Websocket message", "id", string(msg.ID), "method", msg.Method)
+			continue
+		}
+		c.mu.Lock()
+		op := c.calls[id]
+		delete(c.calls, id)
+		if op != nil && op.sub != nil && (msg.Error == nil || msg.Error.Code == 0) {
+			// registered before the next message, which may be its first notification
+			if json.Unmarshal(msg.Result, &op.sub.id) == nil && op.sub.id != "" {
+				c.subs[op.sub.id] = op.sub
+				go op.sub.forward()
+			}
+		}
+		c.mu.Unlock()
+		if op != nil {
+			op.resp <- &msg.response
+		}
+	}
+
+	c.ws.Close()
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	subs := c.subs
+	c.subs = make(map[string]*WSSubscription)
+	err = c.err
+	c.mu.Unlock()
+	close(c.closed)
+	for _, sub := range subs {
+		sub.fail(err)
+	}
+}
+
+// WSSubscription is a subscription of a WSClient
+type WSSubscription struct {
+	client    *WSClient
+	namespace string
+	id        string
+	channel   reflect.Value
+	in        chan json.RawMessage
+	quit      chan struct{}
+	quitOnce  sync.Once
+	err       chan error
+	errOnce   sync.Once
+}
+
+// Err returns the subscription error channel, it receives the error that failed the subscription
+// and is closed by Unsubscribe
+func (s *WSSubscription) Err() <-chan error {
+	return s.err
+}
+
+// Unsubscribe unsubscribes the notifications and closes the error channel, it can be called more than once
+func (s *WSSubscription) Unsubscribe() {
+	s.stop(nil, true)
+	s.errOnce.Do(func() { close(s.err) })
+}
+
+// fail stops s with err, the subscription is not unsubscribed from the daemon
+func (s *WSSubscription) fail(err error) {
+	s.stop(err, false)
+}
+
+func (s *WSSubscription) stop(err error, unsubscribe bool) {
+	s.quitOnce.Do(func() {
+		close(s.quit)
+		c := s.client
+		c.mu.Lock()
+		delete(c.subs, s.id)
+		c.mu.Unlock()
+		if unsubscribe {
+			ctx, cancel := context.WithTimeout(context.Background(), unsubscribeTimeout)
+			defer cancel()
+			c.CallContext(ctx, nil, s.namespace+"_unsubscribe", s.id)
+		}
+		if err != nil {
+			s.err <- err
+		}
+	})
+}
+
+func (s *WSSubscription) deliver(result json.RawMessage) {
+	select {
+	case s.in <- result:
+	case <-s.quit:
+	}
+}
+
+// forward queues the notifications and sends them to the channel of s until it stops
+func (s *WSSubscription) forward() {
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(s.quit)},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(s.in)},
+		{Dir: reflect.SelectSend, Chan: s.channel},
+	}
+	var queue []reflect.Value
+	for {
+		var chosen int
+		var recv reflect.Value
+		if len(queue) == 0 {
+			chosen, recv, _ = reflect.Select(cases[:2])
+		} else {
+			cases[2].Send = queue[0]
+			chosen, recv, _ = reflect.Select(cases)
+		}
+		switch chosen {
+		case 0:
+			return
+		case 1:
+			val := reflect.New(s.channel.Type().Elem())
+			if err := json.Unmarshal(recv.Interface().(json.RawMessage), val.Interface()); err != nil {
+				s.stop(err, true)
+				return
+			}
+			if len(queue) == maxSubscriptionBuffer {
+				s.stop(ErrSubscriptionQueueOverflow, true)
+				return
+			}
+			queue = append(queue, val.Elem())
+		case 2:
+			queue[0] = reflect.Value{}
+			queue = queue[1:]
+		}
+	}
+}
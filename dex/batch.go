@@ -0,0 +1,182 @@
+package dex
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/lianxiangcloud/linkchain/libs/common"
+	"github.com/lianxiangcloud/linkchain/libs/hexutil"
+	"github.com/lianxiangcloud/linkchain/rpc/rtypes"
+	"github.com/lianxiangcloud/lkdex/types"
+)
+
+// OrderTxResult is the result of one order in a batch request
+type OrderTxResult struct {
+	OrderHash common.Hash  `json:"orderHash"`
+	TxHash    *common.Hash `json:"txHash,omitempty"`
+	Error     string       `json:"error,omitempty"`
+	Code      int          `json:"code,omitempty"` // code of Error, see types.Error
+}
+
+// SetError records err as the failure of the order
+func (r *OrderTxResult) SetError(err error) {
+	r.Error = err.Error()
+	r.Code = types.ErrorCode(err)
+}
+
+// DexPostOrders sends a postOrder tx for each order, the txs of a maker use consecutive nonces.
+// A failed order does not stop the batch, its error is reported in its result.
+func (dex *Dex) DexPostOrders(ctx context.Context, orders []*types.SignOrder) []*OrderTxResult {
+	results := make([]*OrderTxResult, 0, len(orders))
+	for _, order := range orders {
+		ret := &OrderTxResult{OrderHash: order.OrderToHash()}
+		results = append(results, ret)
+
+		hash, err := dex.DexPostOrder(ctx, order)
+		if err != nil {
+			dex.Logger.Debug("PostOrders", "order", ret.OrderHash.Hex(), "err", err)
+			ret.SetError(err)
+			continue
+		}
+		ret.TxHash = &hash
+	}
+	return results
+}
+
+// DexCancelOrders sends a cancel tx for each order, the txs of a maker use consecutive nonces.
+// A failed order does not stop the batch, its error is reported in its result.
+func (dex *Dex) DexCancelOrders(ctx context.Context, orders []*types.SignOrder) []*OrderTxResult {
+	results := make([]*OrderTxResult, 0, len(orders))
+	for _, order := range orders {
+		ret := &OrderTxResult{OrderHash: order.OrderToHash()}
+		results = append(results, ret)
+
+		callData, err := dex.cancelOrderCallData(ctx, order)
+		if err != nil {
+			ret.SetError(err)
+			continue
+		}
+		hash, err := dex.DexPostRequest(ctx, order.Maker, callData, ret.OrderHash)
+		if err != nil {
+			dex.Logger.Debug("CancelOrders", "order", ret.OrderHash.Hex(), "err", err)
+			ret.SetError(err)
+			continue
+		}
+		ret.TxHash = &hash
+	}
+	return results
+}
+
+// DexCancelAll cancels the open orders of maker in the index, only those of pair if pair is not nil
+func (dex *Dex) DexCancelAll(ctx context.Context, maker common.Address, pair *types.TokenPair) ([]*OrderTxResult, error) {
+	header, err := dex.chain.GetBlockByNumber(ctx, "latest")
+	if err != nil {
+		return nil, err
+	}
+	orders, err := dex.dexDB.QueryOpenOrdersByMaker(maker, pair, header.Time.ToInt().Uint64())
+	if err != nil {
+		return nil, err
+	}
+	dex.Logger.Debug("CancelAll", "maker", maker, "orders", len(orders))
+	return dex.DexCancelOrders(ctx, orders), nil
+}
+
+// AmountResult is the result of one query of a batched contract call
+type AmountResult struct {
+	Amount *hexutil.Big `json:"amount,omitempty"`
+	Error  string       `json:"error,omitempty"`
+	Code   int          `json:"code,omitempty"` // code of Error, see types.Error
+	err    error
+}
+
+// SetError records err as the failure of the query
+func (r *AmountResult) SetError(err error) {
+	r.err = err
+	r.Error = err.Error()
+	r.Code = types.ErrorCode(err)
+}
+
+// Err returns the error of the query, nil if Amount is set
+func (r *AmountResult) Err() error {
+	return r.err
+}
+
+// DepositQuery is the deposit of Token of User queried by DexGetDepositAmounts
+type DepositQuery struct {
+	User  common.Address `json:"user"`
+	Token common.Address `json:"token"`
+}
+
+// DexAvailableVolumes returns the available volume of each order, evaluated in batch requests.
+// An invalid order or a failed call is reported in the result of the order, the error returned
+// means that the calls were not answered.
+func (dex *Dex) DexAvailableVolumes(ctx context.Context, orders []*types.Order) ([]*AmountResult, error) {
+	calls := make([]amountCall, len(orders))
+	for i, order := range orders {
+		calls[i].data, calls[i].err = availableVolumeCall(order)
+		if order != nil {
+			calls[i].from = order.Maker
+		}
+	}
+	return dex.callAmounts(ctx, calls, func(ret hexutil.Bytes) (*big.Int, error) {
+		return hexutil.DecodeBig(string(ret))
+	})
+}
+
+// DexGetDepositAmounts returns the deposit of each query, evaluated in batch requests.
+// A failed call is reported in the result of the query, the error returned means that
+// the calls were not answered.
+func (dex *Dex) DexGetDepositAmounts(ctx context.Context, queries []DepositQuery) ([]*AmountResult, error) {
+	calls := make([]amountCall, len(queries))
+	for i, q := range queries {
+		calls[i].from = q.User
+		calls[i].data, calls[i].err = depositAmountCall(q.User, q.Token)
+	}
+	return dex.callAmounts(ctx, calls, decodeDepositAmount)
+}
+
+// amountCall is a contract call returning an amount, err is set if it could not be built
+type amountCall struct {
+	from common.Address
+	data []byte
+	err  error
+}
+
+// callAmounts executes calls in batch requests and decodes their results with decode
+func (dex *Dex) callAmounts(ctx context.Context, calls []amountCall, decode func(hexutil.Bytes) (*big.Int, error)) ([]*AmountResult, error) {
+	results := make([]*AmountResult, len(calls))
+	args := make([]*rtypes.SendTxArgs, 0, len(calls))
+	index := make([]int, 0, len(calls))
+	for i, call := range calls {
+		results[i] = &AmountResult{}
+		if call.err != nil {
+			results[i].SetError(call.err)
+			continue
+		}
+		args = append(args, dex.contractCallArgs(call.from, call.data))
+		index = append(index, i)
+	}
+	if len(args) == 0 {
+		return results, nil
+	}
+	dex.Logger.Debug("CallBatch", "calls", len(args))
+
+	rets, err := dex.chain.CallBatch(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	for j, ret := range rets {
+		result := results[index[j]]
+		if ret.Err != nil {
+			result.SetError(ret.Err)
+			continue
+		}
+		amount, err := decode(ret.Ret)
+		if err != nil {
+			result.SetError(err)
+			continue
+		}
+		result.Amount = (*hexutil.Big)(amount)
+	}
+	return results, nil
+}
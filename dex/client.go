@@ -0,0 +1,73 @@
+package dex
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/lianxiangcloud/linkchain/libs/common"
+	"github.com/lianxiangcloud/linkchain/libs/hexutil"
+	"github.com/lianxiangcloud/linkchain/rpc/rtypes"
+	wtypes "github.com/lianxiangcloud/linkchain/wallet/types"
+)
+
+// ChainClient is the linkchain node the Dex reads the chain from and sends its txs to.
+// The errors returned are the types.Error of the daemon calls.
+type ChainClient interface {
+	// GenesisBlockNumber returns the height the chain starts at
+	GenesisBlockNumber(ctx context.Context) (*hexutil.Uint64, error)
+	// Call executes a call of args on the chain head without creating a tx
+	Call(ctx context.Context, args *rtypes.SendTxArgs) (hexutil.Bytes, error)
+	// CallBatch executes the calls of args like Call in batch requests, the error
+	// returned means the calls were not answered
+	CallBatch(ctx context.Context, args []*rtypes.SendTxArgs) ([]CallResult, error)
+	// SendRawTx sends the signed tx b of txType ("tx" or "txt")
+	SendRawTx(ctx context.Context, b hexutil.Bytes, txType string) (common.Hash, error)
+	// GetBlockByNumber returns the header of block blockNr ("latest" for the chain head)
+	GetBlockByNumber(ctx context.Context, blockNr string) (*BlockHeader, error)
+	// GetTransactionReceipt returns the receipt of tx hash, nil if the tx is not in a block yet
+	GetTransactionReceipt(ctx context.Context, hash common.Hash) (*TxReceipt, error)
+	// GetTransactionCount returns the nonce of the next tx of addr
+	GetTransactionCount(ctx context.Context, addr common.Address) (uint64, error)
+	// EstimateGas returns the gas the tx of args uses
+	EstimateGas(ctx context.Context, args *rtypes.SendTxArgs) (hexutil.Uint64, error)
+	// SuggestGasPrice returns the gas price the node suggests
+	SuggestGasPrice(ctx context.Context) (*big.Int, error)
+}
+
+// CallResult is the result of a call of ChainClient.CallBatch
+type CallResult struct {
+	Ret hexutil.Bytes
+	Err error
+}
+
+// WalletClient is the wallet holding the keys of the accounts the Dex signs for
+type WalletClient interface {
+	Signer
+	// SendRawTransaction sends the signed tx b through the wallet
+	SendRawTransaction(ctx context.Context, b hexutil.Bytes) (common.Hash, error)
+	// GetTransactionCount returns the nonce of the next tx of addr
+	GetTransactionCount(ctx context.Context, addr common.Address) (uint64, error)
+	// EstimateGas returns the gas the tx of args uses
+	EstimateGas(ctx context.Context, args *rtypes.SendTxArgs) (hexutil.Uint64, error)
+	// Status returns the status of the wallet
+	Status(ctx context.Context) (*wtypes.StatusResult, error)
+}
+
+var (
+	_ ChainClient  = (*nodeClient)(nil)
+	_ WalletClient = (*walletClient)(nil)
+)
+
+// WithChainClient makes the Dex use chain instead of a client of config.Daemon
+func WithChainClient(chain ChainClient) DexOption {
+	return func(dex *Dex) {
+		dex.chain = chain
+	}
+}
+
+// WithWalletClient makes the Dex use wallet instead of a client of config.WalletDaemon
+func WithWalletClient(wallet WalletClient) DexOption {
+	return func(dex *Dex) {
+		dex.wallet = wallet
+	}
+}
@@ -0,0 +1,142 @@
+package dex
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/lianxiangcloud/linkchain/libs/common"
+	"github.com/lianxiangcloud/linkchain/libs/crypto"
+	"github.com/lianxiangcloud/linkchain/libs/hexutil"
+	"github.com/lianxiangcloud/linkchain/libs/log"
+	"github.com/lianxiangcloud/linkchain/rpc/rtypes"
+	"github.com/lianxiangcloud/lkdex/config"
+	"github.com/lianxiangcloud/lkdex/types"
+)
+
+func newFakeDex(chain ChainClient, wallet WalletClient) *Dex {
+	return &Dex{
+		Logger: log.NewNopLogger(),
+		config: config.DefaultConfig(),
+		chain:  chain,
+		wallet: wallet,
+		signer: wallet,
+		nonces: newNonceManager(wallet, nil),
+	}
+}
+
+func TestFakeSignOrder(t *testing.T) {
+	ctx := context.Background()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, wallet := NewFakeChainClient(10), NewFakeWalletClient()
+	maker := wallet.AddKey(key)
+	chain.SetHead(20, 1000)
+	dex := newFakeDex(chain, wallet)
+
+	order := &types.Order{
+		TokenGet:   Token1,
+		AmountGet:  (*hexutil.Big)(big.NewInt(10)),
+		TokenGive:  Token2,
+		AmountGive: (*hexutil.Big)(big.NewInt(20)),
+		Expires:    1001,
+		Nonce:      1,
+		Maker:      maker,
+	}
+	sig, err := dex.SignDexOrder(ctx, order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signOrder := &types.SignOrder{
+		Order: *order,
+		R:     (*hexutil.Big)(new(big.Int).SetBytes(sig[:32])),
+		S:     (*hexutil.Big)(new(big.Int).SetBytes(sig[32:64])),
+		V:     (*hexutil.Big)(big.NewInt(int64(sig[64]) + 27)),
+	}
+	if err := dex.ValidateSignOrder(ctx, signOrder); err != nil {
+		t.Fatalf("ValidateSignOrder: %v", err)
+	}
+
+	chain.SetHead(21, 1001)
+	if err := dex.ValidateSignOrder(ctx, signOrder); err != types.ErrOrderExpired {
+		t.Fatalf("ValidateSignOrder of an expired order: %v", err)
+	}
+
+	order.Maker = user1
+	if _, err := dex.SignDexOrder(ctx, order); types.ErrorCode(err) != types.ErrorCode(types.ErrWalletResponse) {
+		t.Fatalf("SignDexOrder without the key of the maker: %v", err)
+	}
+}
+
+func TestFakePostChainTx(t *testing.T) {
+	ctx := context.Background()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, wallet := NewFakeChainClient(0), NewFakeWalletClient()
+	from := wallet.AddKey(key)
+	wallet.SetNonce(from, 7)
+	wallet.Gas = 50000
+	dex := newFakeDex(chain, wallet)
+
+	to := common.HexToAddress(dex.config.ContractAddr)
+	hash, err := dex.PostChainTx(ctx, &rtypes.SendTxArgs{From: from, To: &to})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent := chain.Sent()
+	if len(sent) != 1 || crypto.Keccak256Hash(sent[0]) != hash {
+		t.Fatalf("sent %v, hash %s", sent, hash.Hex())
+	}
+	signed := wallet.Signed()
+	if len(signed) != 1 || uint64(*signed[0].Nonce) != 7 || uint64(*signed[0].Gas) != 50000 {
+		t.Fatalf("signed %+v", signed)
+	}
+
+	wallet.Err = types.ErrWalletLocked
+	if _, err := dex.PostChainTx(ctx, &rtypes.SendTxArgs{From: from, To: &to}); err != types.ErrWalletLocked {
+		t.Fatalf("PostChainTx with a locked wallet: %v", err)
+	}
+	if len(chain.Sent()) != 1 {
+		t.Fatal("tx sent with a locked wallet")
+	}
+}
+
+func TestFakeCallBatch(t *testing.T) {
+	ctx := context.Background()
+	chain := NewFakeChainClient(0)
+	chain.CallFunc = func(args *rtypes.SendTxArgs) (hexutil.Bytes, error) {
+		if args.From == user2 {
+			return nil, types.ErrExecutionReverted
+		}
+		return hexutil.Bytes(`{"ret":"0x10"}`), nil
+	}
+	dex := newFakeDex(chain, NewFakeWalletClient())
+
+	amounts, err := dex.DexGetDepositAmounts(ctx, []DepositQuery{{User: user1, Token: Token1}, {User: user2, Token: Token1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(amounts) != 2 || amounts[0].Amount.ToInt().Int64() != 16 || amounts[1].Err() != types.ErrExecutionReverted {
+		t.Fatalf("amounts %+v %+v", amounts[0], amounts[1])
+	}
+	if amounts[1].Code != types.ErrorCode(types.ErrExecutionReverted) {
+		t.Fatalf("code %d", amounts[1].Code)
+	}
+
+	volumes, err := dex.DexAvailableVolumes(ctx, []*types.Order{nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(volumes) != 1 || volumes[0].Err() == nil {
+		t.Fatalf("volume of a nil order %+v", volumes[0])
+	}
+
+	chain.Err = types.ErrNoConnectionToDaemon
+	if _, err := dex.DexGetDepositAmounts(ctx, []DepositQuery{{User: user1, Token: Token1}}); err != types.ErrNoConnectionToDaemon {
+		t.Fatalf("DexGetDepositAmounts without the node: %v", err)
+	}
+}
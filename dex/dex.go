@@ -1,8 +1,8 @@
 package dex
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
 	"math/big"
 	"sync"
 
@@ -11,6 +11,7 @@ import (
 	"github.com/lianxiangcloud/linkchain/libs/log"
 	"github.com/lianxiangcloud/linkchain/rpc/rtypes"
 	"github.com/lianxiangcloud/lkdex/config"
+	"github.com/lianxiangcloud/lkdex/daemon"
 	"github.com/lianxiangcloud/lkdex/types"
 )
 
@@ -66,58 +67,148 @@ func Ret(ret []byte) (string, error) {
 func CheckOrder(order *types.Order) error {
 	zero := big.NewInt(0)
 	if order == nil {
-		return errors.New("order is nil")
+		return types.ArgsError("order is nil")
 	}
 	if order.AmountGet == nil {
-		return errors.New("order format error: amountGet is nil")
+		return types.ArgsError("order format error: amountGet is nil")
 	}
 	if order.AmountGive == nil {
-		return errors.New("order format error: amountGive is nil")
+		return types.ArgsError("order format error: amountGive is nil")
 	}
 	if (*big.Int)(order.AmountGet).Cmp(zero) <= 0 {
-		return errors.New("order format error: amountGet less or equal 0")
+		return types.ArgsError("order format error: amountGet less or equal 0")
 	}
 
 	if (*big.Int)(order.AmountGive).Cmp(zero) <= 0 {
-		return errors.New("order format error: amountGive less or equal 0")
+		return types.ArgsError("order format error: amountGive less or equal 0")
 	}
 
 	if order.TokenGet == order.TokenGive {
-		return errors.New("order format error: TokenGet == TokenGive")
+		return types.ArgsError("order format error: TokenGet == TokenGive")
 	}
 	return nil
 }
 
+// CheckSignOrder checks the order format, the maker signature and the
+// expiry against blockTime, the same way the contract checks a SignOrder.
+func CheckSignOrder(order *types.SignOrder, blockTime uint64) error {
+	if order == nil {
+		return types.ArgsError("order is nil")
+	}
+	if err := CheckOrder(&order.Order); err != nil {
+		return err
+	}
+	if uint64(order.Expires) <= blockTime {
+		return types.ErrOrderExpired
+	}
+	return order.VerifySign()
+}
+
 // Dex dex
 type Dex struct {
 	Logger log.Logger
-	lock   sync.Mutex
 	dexDB  *SQLDBBackend
 	config *config.Config
 	dexSub *DexSubscription
+	chain  ChainClient
+	wallet WalletClient
+	signer Signer
+	nonces *nonceManager
+	quit   chan struct{}
+	ctx    context.Context // of the background calls, canceled by Stop
+	cancel context.CancelFunc
+
+	stopOnce sync.Once
+
+	closers []func() // close the daemon clients created by NewDex
+
+	txMu sync.Mutex // serializes the checks of the pending txs
+
+	metrics       *Metrics
+	reportMetrics bool // update the chain head and order book metrics
 	//currAccount *common.Address
 }
 
-func NewDex(config *config.Config, logger log.Logger, db *SQLDBBackend) (*Dex, error) {
-
-	dexSub, err := NewDexSubscription(config.Daemon.PeerWS, config.ContractAddr, logger, db)
-	if err != nil {
-		return nil, err
-	}
+// NewDex returns the Dex of the contract config.ContractAddr. The chain and the wallet are
+// called through clients of config.Daemon and config.WalletDaemon unless set by the options.
+// With a keystore file in config, the orders and txs are signed with its key and no wallet is called.
+func NewDex(config *config.Config, logger log.Logger, db *SQLDBBackend, options ...DexOption) (*Dex, error) {
 	dex := &Dex{
 		config: config,
 		dexDB:  db,
 		Logger: logger,
-		dexSub: dexSub,
+		quit:   make(chan struct{}),
+
+		metrics: NopMetrics(),
+	}
+	if err := config.Gas.ValidateBasic(); err != nil {
+		return nil, err
+	}
+	dex.ctx, dex.cancel = context.WithCancel(context.Background())
+	for _, option := range options {
+		option(dex)
+	}
+	if dex.chain == nil {
+		c, err := daemon.NewNodeClient(config.Daemon)
+		if err != nil {
+			dex.Stop()
+			return nil, err
+		}
+		dex.chain = NewChainClient(c)
+		dex.closers = append(dex.closers, c.Close)
+	}
+	if dex.signer == nil && config.KeystoreFile != "" {
+		signer, err := LoadKeystoreSigner(config.BaseConfig)
+		if err != nil {
+			dex.Stop()
+			return nil, err
+		}
+		dex.Logger.Info("Sign with the keystore", "file", config.KeystoreFilePath(), "accounts", signer.Accounts())
+		dex.signer = signer
+	}
+	switch {
+	case dex.wallet != nil:
+	case dex.signer != nil:
+		dex.wallet = NewSignerWallet(dex.signer, dex.chain)
+	default:
+		c, err := daemon.NewWalletClient(config.WalletDaemon)
+		if err != nil {
+			dex.Stop()
+			return nil, err
+		}
+		dex.wallet = NewWalletClient(c)
+		dex.closers = append(dex.closers, c.Close)
+	}
+	if dex.signer == nil {
+		dex.signer = dex.wallet
+	}
+	dex.nonces = newNonceManager(dex.wallet, dex.pendingNonce)
+
+	dialer, err := daemon.NewWSDialer(config.Daemon)
+	if err != nil {
+		dex.Stop()
+		return nil, err
+	}
+	dexSub, err := NewDexSubscription(config.Daemon.WSEndpoints(), dialer, config.ContractAddr, dex.chain, logger, db)
+	if err != nil {
+		dex.Stop()
+		return nil, err
 	}
+	dex.dexSub = dexSub
+	dexSub.metrics = dex.metrics
+	dexSub.quit = dex.quit
 	dex.Logger.Info("Dex client create")
-	db.AutoMigrate(&OrderModel{}, &TradeModel{}, &AccountModel{}, &BlockSyncModel{})
+	db.AutoMigrate(&OrderModel{}, &TradeModel{}, &AccountModel{}, &BlockSyncModel{}, &OrderNonceModel{}, &PendingTxModel{})
 	//db.CreateSync()
 	db.SetLogger(logger)
+	if dex.reportMetrics {
+		db.SetMetrics(dex.metrics)
+	}
 
-	height, err := GenesisBlockNumber()
+	height, err := dex.chain.GenesisBlockNumber(dex.ctx)
 	if err != nil {
 		dex.Logger.Error("GenesisBlockNumber fail", "err", err)
+		dex.Stop()
 		return nil, err
 	}
 	defaultInitBlockHeight = uint64(*height)
@@ -127,11 +218,60 @@ func NewDex(config *config.Config, logger log.Logger, db *SQLDBBackend) (*Dex, e
 	if err != nil {
 		return nil, err
 	}
-	dex.dexSub.OnStart()
+	if err := dex.dexSub.OnStart(); err != nil {
+		dex.Logger.Error("Subscription start fail", "err", err)
+	}
+	go dex.txLoop()
+	if dex.reportMetrics {
+		go dex.metricsLoop()
+	}
 	return dex, nil
 }
 
-func (dex *Dex) SignDexOrder(order *types.Order) ([]byte, error) {
+// Stop stops the pending tx poller and the log subscription, it may be called more than once
+func (dex *Dex) Stop() {
+	dex.stopOnce.Do(func() {
+		close(dex.quit)
+		dex.cancel()
+		for _, closer := range dex.closers {
+			closer()
+		}
+	})
+}
+
+// FillOrderDefaults assigns the omitted fields of a new order: a zero Nonce is replaced
+// by a unique nonce of the maker, a zero Expires by the latest block time plus ttl
+// (config.OrderTTL if ttl is nil).
+func (dex *Dex) FillOrderDefaults(ctx context.Context, order *types.Order, ttl *hexutil.Uint64) error {
+	if order == nil {
+		return types.ArgsError("order is nil")
+	}
+	if order.Expires == 0 {
+		orderTTL := dex.config.OrderTTL
+		if ttl != nil {
+			orderTTL = uint64(*ttl)
+		}
+		if orderTTL == 0 {
+			return types.ArgsError("arg format error: ttl is 0")
+		}
+		header, err := dex.chain.GetBlockByNumber(ctx, "latest")
+		if err != nil {
+			return err
+		}
+		order.Expires = hexutil.Uint64(header.Time.ToInt().Uint64() + orderTTL)
+	}
+	if order.Nonce == 0 {
+		nonce, err := dex.dexDB.AllocOrderNonce(order.Maker)
+		if err != nil {
+			dex.Logger.Error("AllocOrderNonce fail", "maker", order.Maker, "err", err)
+			return err
+		}
+		order.Nonce = hexutil.Uint64(nonce)
+	}
+	return nil
+}
+
+func (dex *Dex) SignDexOrder(ctx context.Context, order *types.Order) ([]byte, error) {
 
 	err := CheckOrder(order)
 	if err != nil {
@@ -140,7 +280,7 @@ func (dex *Dex) SignDexOrder(order *types.Order) ([]byte, error) {
 	}
 
 	hash := order.OrderToHash()
-	sign, err := WalletSignHash(order.Maker, hash)
+	sign, err := dex.signer.SignHash(ctx, order.Maker, hash)
 	if err != nil {
 		dex.Logger.Debug("walletSignHashErr", "order", order, "err", err.Error())
 		return nil, err
@@ -149,7 +289,61 @@ func (dex *Dex) SignDexOrder(order *types.Order) ([]byte, error) {
 	return sign, nil
 }
 
-func (dex *Dex) DexDeposit(a common.Address, token common.Address, amount *hexutil.Big) (common.Hash, error) {
+// ValidateSignOrder checks the order with CheckSignOrder against the latest block time,
+// so that an order the contract would revert is rejected before any tx is signed.
+func (dex *Dex) ValidateSignOrder(ctx context.Context, order *types.SignOrder) error {
+	header, err := dex.chain.GetBlockByNumber(ctx, "latest")
+	if err != nil {
+		dex.Logger.Debug("GetBlockByNumber err", "err", err)
+		return err
+	}
+	err = CheckSignOrder(order, header.Time.ToInt().Uint64())
+	if err != nil {
+		dex.Logger.Debug("CheckSignOrder fail", "order", order, "blockTime", header.Time, "err", err)
+		return err
+	}
+	return nil
+}
+
+// checkOrderState checks the order state recorded in the index.
+// Orders not indexed yet are accepted.
+func (dex *Dex) checkOrderState(order *types.SignOrder, checkFilled bool) error {
+	hash := order.OrderToHash()
+	model, err := dex.dexDB.ReadOrderModel(hash)
+	if err != nil {
+		return err
+	}
+	if model == nil {
+		return nil
+	}
+	if model.State.Int64 == Finish {
+		return types.ErrOrderCanceled
+	}
+	if !checkFilled {
+		return nil
+	}
+	filled, ok := new(big.Int).SetString(model.FilledAmount, 0)
+	if ok && filled.Cmp(order.AmountGet.ToInt()) >= 0 {
+		dex.Logger.Debug("Order finished", "hash", hash.Hex(), "filled", model.FilledAmount)
+		return types.ErrOrderFinished
+	}
+	return nil
+}
+
+// checkMakerDeposit checks the maker has at least amount of tokenGive deposited in the contract
+func (dex *Dex) checkMakerDeposit(ctx context.Context, order *types.Order, amount *big.Int) error {
+	deposit, err := dex.DexGetDepositAmount(ctx, &order.Maker, &order.TokenGive)
+	if err != nil {
+		return err
+	}
+	if deposit.Cmp(amount) < 0 {
+		dex.Logger.Debug("Maker deposit insufficient", "maker", order.Maker, "token", order.TokenGive, "deposit", deposit, "need", amount)
+		return types.ErrInsufficientDeposit
+	}
+	return nil
+}
+
+func (dex *Dex) DexDeposit(ctx context.Context, a common.Address, token common.Address, amount *hexutil.Big) (common.Hash, error) {
 	callArgs := ArgsNull()
 	callData := []byte("deposit|" + string(callArgs))
 	dex.Logger.Debug("Deposit", "call", string(callData))
@@ -164,17 +358,17 @@ func (dex *Dex) DexDeposit(a common.Address, token common.Address, amount *hexut
 
 	dex.Logger.Debug("SendTx", "TX", send)
 
-	hash, err := dex.PostChainTx(&send)
+	hash, err := dex.postTrackedTx(ctx, &send, common.EmptyHash)
 	if err != nil {
 		return common.EmptyHash, err
 	}
 	return hash, nil
 }
 
-func (dex *Dex) DexWithDraw(a common.Address, token common.Address, amount *hexutil.Big) (common.Hash, error) {
+func (dex *Dex) DexWithDraw(ctx context.Context, a common.Address, token common.Address, amount *hexutil.Big) (common.Hash, error) {
 	zero := big.NewInt(0)
 	if (*big.Int)(amount).Cmp(zero) <= 0 {
-		return common.EmptyHash, errors.New("arg format error: amount less or equal 0")
+		return common.EmptyHash, types.ArgsError("arg format error: amount less or equal 0")
 	}
 
 	callArgs, err := Args2(token, amount)
@@ -193,18 +387,25 @@ func (dex *Dex) DexWithDraw(a common.Address, token common.Address, amount *hexu
 
 	dex.Logger.Debug("SendTx", "TX", send)
 
-	hash, err := dex.PostChainTx(&send)
+	hash, err := dex.postTrackedTx(ctx, &send, common.EmptyHash)
 	if err != nil {
 		return common.EmptyHash, err
 	}
 	return hash, nil
 }
 
-func (dex *Dex) DexPostOrder(order *types.SignOrder) (common.Hash, error) {
-	err := CheckOrder(&order.Order)
+func (dex *Dex) DexPostOrder(ctx context.Context, order *types.SignOrder) (common.Hash, error) {
+	err := dex.ValidateSignOrder(ctx, order)
+	if err != nil {
+		return common.EmptyHash, err
+	}
+	err = dex.checkOrderState(order, true)
+	if err != nil {
+		return common.EmptyHash, err
+	}
+	err = dex.checkMakerDeposit(ctx, &order.Order, order.AmountGive.ToInt())
 	if err != nil {
 		return common.EmptyHash, err
-
 	}
 
 	callArgs, err := Args1(order)
@@ -215,19 +416,38 @@ func (dex *Dex) DexPostOrder(order *types.SignOrder) (common.Hash, error) {
 	callData := []byte("postOrder|" + string(callArgs))
 	dex.Logger.Debug("PostOrder", "call", string(callData))
 
-	return dex.DexPostRequest(order.Maker, callData)
+	hash, err := dex.DexPostRequest(ctx, order.Maker, callData, order.OrderToHash())
+	if err != nil {
+		return common.EmptyHash, err
+	}
+	// indexed as Sending until the Order event arrives
+	if err := dex.dexDB.CreateOrder(order, Sending); err != nil {
+		dex.Logger.Error("CreateOrder fail", "order", order.OrderToHash().Hex(), "err", err)
+	}
+	return hash, nil
 }
 
-func (dex *Dex) DexTrade(a common.Address, order *types.SignOrder, amount *hexutil.Big) (common.Hash, error) {
+func (dex *Dex) DexTrade(ctx context.Context, a common.Address, order *types.SignOrder, amount *hexutil.Big) (common.Hash, error) {
 	zero := big.NewInt(0)
 	if (*big.Int)(amount).Cmp(zero) <= 0 {
-		return common.EmptyHash, errors.New("arg format error: amount less or equal 0")
+		return common.EmptyHash, types.ArgsError("arg format error: amount less or equal 0")
 	}
 
-	err := CheckOrder(&order.Order)
+	err := dex.ValidateSignOrder(ctx, order)
+	if err != nil {
+		return common.EmptyHash, err
+	}
+	err = dex.checkOrderState(order, true)
+	if err != nil {
+		return common.EmptyHash, err
+	}
+	// the contract fills at least one unit of amountGet from the maker deposit
+	need := new(big.Int).Add(order.AmountGive.ToInt(), order.AmountGet.ToInt())
+	need.Sub(need, big.NewInt(1))
+	need.Div(need, order.AmountGet.ToInt())
+	err = dex.checkMakerDeposit(ctx, &order.Order, need)
 	if err != nil {
 		return common.EmptyHash, err
-
 	}
 	callArgs, err := Args2(order, amount)
 	if err != nil {
@@ -236,49 +456,63 @@ func (dex *Dex) DexTrade(a common.Address, order *types.SignOrder, amount *hexut
 	callData := []byte("trade|" + string(callArgs))
 	dex.Logger.Debug("trade", "call", string(callData))
 
-	return dex.DexPostRequest(a, callData)
+	return dex.DexPostRequest(ctx, a, callData, order.OrderToHash())
 }
 
-func (dex *Dex) DexCancelOrder(order *types.SignOrder) (common.Hash, error) {
-	err := CheckOrder(&order.Order)
+func (dex *Dex) DexCancelOrder(ctx context.Context, order *types.SignOrder) (common.Hash, error) {
+	callData, err := dex.cancelOrderCallData(ctx, order)
 	if err != nil {
 		return common.EmptyHash, err
+	}
+	return dex.DexPostRequest(ctx, order.Maker, callData, order.OrderToHash())
+}
 
+func (dex *Dex) cancelOrderCallData(ctx context.Context, order *types.SignOrder) ([]byte, error) {
+	err := dex.ValidateSignOrder(ctx, order)
+	if err != nil {
+		return nil, err
+	}
+	err = dex.checkOrderState(order, false)
+	if err != nil {
+		return nil, err
 	}
 	callArgs, err := Args1(order)
 	if err != nil {
-		return common.EmptyHash, err
+		return nil, err
 	}
 	callData := []byte("cancelOrder|" + string(callArgs))
 	dex.Logger.Debug("cancelOrder", "call", string(callData))
-
-	return dex.DexPostRequest(order.Maker, callData)
+	return callData, nil
 }
 
-func (dex *Dex) DexAvailableVolume(order *types.Order) (*big.Int, error) {
-	err := CheckOrder(order)
+func (dex *Dex) DexAvailableVolume(ctx context.Context, order *types.Order) (*big.Int, error) {
+	callData, err := availableVolumeCall(order)
 	if err != nil {
 		return nil, err
 	}
+	dex.Logger.Debug("availableVolume", "call", string(callData))
 
-	callArgs, err := Args1(order)
+	result, err := dex.DexCallRequest(ctx, order.Maker, callData)
 	if err != nil {
 		return nil, err
 	}
+	return hexutil.DecodeBig(string(result))
+}
 
-	callData := []byte("availableVolume|" + string(callArgs))
-	dex.Logger.Debug("availableVolume", "call", string(callData))
-
-	result, err := dex.DexCallRequest(order.Maker, callData)
-	vol, err := hexutil.DecodeBig(string(result))
+// availableVolumeCall returns the call data of the availableVolume of order
+func availableVolumeCall(order *types.Order) ([]byte, error) {
+	err := CheckOrder(order)
 	if err != nil {
 		return nil, err
 	}
-	return vol, nil
-
+	callArgs, err := Args1(order)
+	if err != nil {
+		return nil, err
+	}
+	return []byte("availableVolume|" + string(callArgs)), nil
 }
 
-func (dex *Dex) DexUsedVolumeByHash(hash *common.Hash) (*big.Int, error) {
+func (dex *Dex) DexUsedVolumeByHash(ctx context.Context, hash *common.Hash) (*big.Int, error) {
 
 	callArgs, err := Args1(hash)
 	if err != nil {
@@ -287,7 +521,7 @@ func (dex *Dex) DexUsedVolumeByHash(hash *common.Hash) (*big.Int, error) {
 	callData := []byte("usedVolumeByHash|" + string(callArgs))
 	dex.Logger.Debug("usedVolumeByHash", "call", string(callData))
 
-	result, err := dex.DexCallRequest(common.EmptyAddress, callData)
+	result, err := dex.DexCallRequest(ctx, common.EmptyAddress, callData)
 	if err != nil {
 		return nil, err
 	}
@@ -299,33 +533,46 @@ func (dex *Dex) DexUsedVolumeByHash(hash *common.Hash) (*big.Int, error) {
 	return vol, nil
 }
 
-func (dex *Dex) DexGetDepositAmount(user *common.Address, token *common.Address) (*big.Int, error) {
-	callArgs, err := Args2(user, token)
+func (dex *Dex) DexGetDepositAmount(ctx context.Context, user *common.Address, token *common.Address) (*big.Int, error) {
+	callData, err := depositAmountCall(*user, *token)
 	if err != nil {
 		return nil, err
 	}
-	callData := []byte("getDepositAmount|" + string(callArgs))
 	dex.Logger.Debug("getDepositAmount", "call", string(callData))
 
-	result, err := dex.DexCallRequest(*user, callData)
+	result, err := dex.DexCallRequest(ctx, *user, callData)
+	if err != nil {
+		return nil, err
+	}
+	return decodeDepositAmount(result)
+}
+
+// depositAmountCall returns the call data of the getDepositAmount of token of user
+func depositAmountCall(user common.Address, token common.Address) ([]byte, error) {
+	callArgs, err := Args2(user, token)
 	if err != nil {
 		return nil, err
 	}
+	return []byte("getDepositAmount|" + string(callArgs)), nil
+}
+
+// decodeDepositAmount decodes the result of a getDepositAmount call
+func decodeDepositAmount(result hexutil.Bytes) (*big.Int, error) {
 	ret, err := Ret(result)
 	if err != nil {
 		return nil, err
 	}
 	amount, ok := new(big.Int).SetString(ret, 0)
 	if !ok {
-		return nil, err
+		return nil, methodError(types.ErrDaemonResponseData, "eth_call")
 	}
 	return amount, nil
 }
 
-func (dex *Dex) DexTestTakerTrade(order *types.Order, taker common.Address, amount *big.Int) (string, error) {
+func (dex *Dex) DexTestTakerTrade(ctx context.Context, order *types.Order, taker common.Address, amount *big.Int) (string, error) {
 	zero := big.NewInt(0)
 	if (*big.Int)(amount).Cmp(zero) <= 0 {
-		return "", errors.New("arg format error: amount less or equal 0")
+		return "", types.ArgsError("arg format error: amount less or equal 0")
 	}
 
 	err := CheckOrder(order)
@@ -341,7 +588,7 @@ func (dex *Dex) DexTestTakerTrade(order *types.Order, taker common.Address, amou
 	callData := []byte("testTakerTrade|" + string(callArgs))
 	dex.Logger.Debug("TestTakerTrade", "call", string(callData))
 
-	result, err := dex.DexCallRequest(taker, callData)
+	result, err := dex.DexCallRequest(ctx, taker, callData)
 	if err != nil {
 		return "", err
 	}
@@ -353,23 +600,28 @@ func (dex *Dex) DexTestTakerTrade(order *types.Order, taker common.Address, amou
 	return ret, nil
 }
 
-func (dex *Dex) DexCallRequest(from common.Address, txData []byte) (hexutil.Bytes, error) {
-	addr := common.HexToAddress(dex.config.ContractAddr)
-	send := rtypes.SendTxArgs{
-		From: from,
-		To:   &addr,
-		Data: (*hexutil.Bytes)(&txData),
-	}
+func (dex *Dex) DexCallRequest(ctx context.Context, from common.Address, txData []byte) (hexutil.Bytes, error) {
+	send := dex.contractCallArgs(from, txData)
 	dex.Logger.Debug("CallRequest", "TX", send)
-	result, err := EthCall(&send)
+	result, err := dex.chain.Call(ctx, send)
 	if err != nil {
 		return nil, err
 	}
 	return result, nil
 }
 
-//user call contract
-func (dex *Dex) DexPostRequest(from common.Address, txData []byte) (common.Hash, error) {
+// contractCallArgs returns the args of a call of the dex contract by from
+func (dex *Dex) contractCallArgs(from common.Address, txData []byte) *rtypes.SendTxArgs {
+	addr := common.HexToAddress(dex.config.ContractAddr)
+	return &rtypes.SendTxArgs{
+		From: from,
+		To:   &addr,
+		Data: (*hexutil.Bytes)(&txData),
+	}
+}
+
+//user call contract, orderHash is recorded with the tx when the call is about an order
+func (dex *Dex) DexPostRequest(ctx context.Context, from common.Address, txData []byte, orderHash common.Hash) (common.Hash, error) {
 	addr := common.HexToAddress(dex.config.ContractAddr)
 	send := rtypes.SendTxArgs{
 		From: from,
@@ -379,34 +631,58 @@ func (dex *Dex) DexPostRequest(from common.Address, txData []byte) (common.Hash,
 
 	dex.Logger.Debug("SendTx", "TX", send)
 
-	hash, err := dex.PostChainTx(&send)
+	hash, err := dex.postTrackedTx(ctx, &send, orderHash)
 	if err != nil {
 		return common.EmptyHash, err
 	}
 	return hash, nil
 }
 
-func (dex *Dex) PostChainTx(tx *rtypes.SendTxArgs) (common.Hash, error) {
-	nonce, err := WalletGetTransactionCount(tx.From)
+// PostChainTx signs and sends tx. A nil nonce is handed out by the nonce manager of the Dex,
+// the txs of an account without nonce are sent one at a time then.
+func (dex *Dex) PostChainTx(ctx context.Context, tx *rtypes.SendTxArgs) (common.Hash, error) {
+	if tx.Nonce != nil {
+		return dex.sendChainTx(ctx, tx)
+	}
+	nonce, done, err := dex.nonces.next(ctx, tx.From)
 	if err != nil {
 		dex.Logger.Debug("WalletGetNonce err")
 		return common.EmptyHash, err
 	}
-
 	s := hexutil.Uint64(nonce)
 	tx.Nonce = &s
+	hash, err := dex.sendChainTx(ctx, tx)
+	done(err)
+	return hash, err
+}
 
-	tx.GasPrice = (*hexutil.Big)(big.NewInt(1e11))
+// sendChainTx signs and sends tx with its nonce
+func (dex *Dex) sendChainTx(ctx context.Context, tx *rtypes.SendTxArgs) (common.Hash, error) {
+	// a gas price set by the caller is kept, e.g. to replace a pending tx
+	if tx.GasPrice == nil {
+		var data []byte
+		if tx.Data != nil {
+			data = *tx.Data
+		}
+		method, _ := splitCallData(data)
+		price, err := dex.gasPrice(ctx, method)
+		if err != nil {
+			dex.Logger.Debug("SuggestGasPrice err")
+			return common.EmptyHash, err
+		}
+		tx.GasPrice = (*hexutil.Big)(price)
+	}
 
 	// EstimateGas return gas
-	gas, err := WalletEstimateGas(tx)
+	gas, err := dex.wallet.EstimateGas(ctx, tx)
 	if err != nil {
 		dex.Logger.Debug("WalletEstimateGas err")
 		return common.EmptyHash, err
 	}
+	gas = hexutil.Uint64(dex.config.Gas.GasLimit(uint64(gas)))
 	tx.Gas = &gas
 
-	result, err := WalletSignTx(tx)
+	result, err := dex.signer.SignTx(ctx, tx)
 	if err != nil {
 		dex.Logger.Debug("WalletSignTx err")
 		return common.EmptyHash, err
@@ -417,7 +693,7 @@ func (dex *Dex) PostChainTx(tx *rtypes.SendTxArgs) (common.Hash, error) {
 	} else {
 		txType = "txt"
 	}
-	hash, err := SendRawTx(result.Raw, txType)
+	hash, err := dex.chain.SendRawTx(ctx, result.Raw, txType)
 	if err != nil {
 		dex.Logger.Debug("SendRawTransacion err")
 		return common.EmptyHash, err
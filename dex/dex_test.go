@@ -18,3 +18,19 @@ func TestOrderJson(t *testing.T) {
 	fmt.Println(string(s))
 	fmt.Println(string(bd))
 }
+
+func TestSplitCallData(t *testing.T) {
+	args, _ := Args2("0x95ccc08ab44ac6d071a0c5911df64ad2394a4c54", "0x1")
+	method, a := splitCallData([]byte("withdraw|" + string(args)))
+	if method != "withdraw" {
+		t.Fatalf("method %s", method)
+	}
+	if string(a.A0) != `"0x95ccc08ab44ac6d071a0c5911df64ad2394a4c54"` || string(a.A1) != `"0x1"` {
+		t.Fatalf("args %s %s", a.A0, a.A1)
+	}
+
+	method, _ = splitCallData([]byte("deposit|{}"))
+	if method != "deposit" {
+		t.Fatalf("method %s", method)
+	}
+}
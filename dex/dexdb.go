@@ -3,6 +3,7 @@ package dex
 import (
 	"database/sql"
 	"math/big"
+	"time"
 
 	"github.com/jinzhu/gorm"
 	"github.com/lianxiangcloud/linkchain/libs/common"
@@ -14,6 +15,7 @@ import (
 
 type SQLDBBackend struct {
 	gorm.DB
+	Path   string // file of the database
 	logger log.Logger
 }
 
@@ -65,6 +67,40 @@ type TradeModel struct {
 	Taker        string        `gorm:"type:char(42);not null"`   //Taker Address
 }
 
+//OrderNonceModel Order nonce allocated for maker
+type OrderNonceModel struct {
+	Maker string        `gorm:"primary_key;type:char(42)"` //Maker Address
+	Nonce sql.NullInt64 `gorm:"not null"`                  //Next unused order nonce
+}
+
+const (
+	TxPending = iota
+	TxSuccess
+	TxFailed
+	TxReplaced
+	TxDropped
+)
+
+//PendingTxModel Contract transaction sent by the wallet api
+type PendingTxModel struct {
+	gorm.Model
+	TxHash    string        `gorm:"type:char(66);unique_index;not null"` //Tx hash
+	From      string        `gorm:"type:char(42);index;not null"`        //Sender Address
+	Intent    string        `gorm:"type:varchar(16);not null"`           //Contract method: postOrder|trade|cancelOrder|deposit|withdraw, cancelTx
+	OrderHash string        `gorm:"type:char(66)"`                       //Order hash of postOrder|trade|cancelOrder
+	Nonce     sql.NullInt64 `gorm:"not null"`                            //Tx nonce
+	Data      string        `gorm:"not null"`                            //Contract call data
+	State     sql.NullInt64 `gorm:"not null"`                            //0:Pending  1:Success  2:Failed  3:Replaced  4:Dropped
+	BlockNum  sql.NullInt64 //Receipt BlockNum
+	Reason    string        //Revert reason of a failed tx
+
+	To           string `gorm:"type:char(42)"` //Receiver Address
+	TokenAddress string `gorm:"type:char(42)"` //Token of the tx value
+	Value        string //Tx value, hex
+	GasPrice     string //Tx gas price, hex
+	Replaces     string `gorm:"type:char(66)"` //Hash of the tx with the same nonce replaced by this speed-up or cancel tx
+}
+
 func (o *OrderModel) ToSignOrder() (*types.SignOrder, error) {
 	amountGet, ok := new(big.Int).SetString(o.AmountGet, 0)
 	if !ok {
@@ -107,8 +143,16 @@ func (o *OrderModel) ToSignOrder() (*types.SignOrder, error) {
 func (db *SQLDBBackend) CreateOrder(order *types.SignOrder, state uint64) error {
 	hash := order.OrderToHash()
 	db.logger.Debug("Create Hash", "hash", hash.Hex())
-	if !db.Find(&OrderModel{HashID: hash.Hex()}).RecordNotFound() {
+	created, err := db.ReadOrderModel(hash)
+	if err != nil {
+		return err
+	}
+	if created != nil {
 		db.logger.Debug("Hash Created", "hash", hash.Hex())
+		//order posted by the wallet api is on chain now
+		if created.State.Int64 == Sending && state != Sending {
+			return db.UpdateOrderState(hash, state)
+		}
 		return nil
 	}
 	price := new(big.Float).Quo(
@@ -151,6 +195,18 @@ func (db *SQLDBBackend) ReadOrder(hash common.Hash) (*types.SignOrder, error) {
 	return order.ToSignOrder()
 }
 
+// ReadOrderModel returns the indexed order record, nil if the order is not indexed
+func (db *SQLDBBackend) ReadOrderModel(hash common.Hash) (*OrderModel, error) {
+	var order OrderModel
+	if err := db.Where(&OrderModel{HashID: hash.Hex()}).First(&order).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &order, nil
+}
+
 func (db *SQLDBBackend) UpdateOrderState(hash common.Hash, state uint64) error {
 	stateSql := sql.NullInt64{int64(state), true}
 	var order OrderModel
@@ -160,9 +216,22 @@ func (db *SQLDBBackend) UpdateOrderState(hash common.Hash, state uint64) error {
 	return nil
 }
 
+// UpdateFillAmount sets the filled amount of order hash if amount is more than the recorded one:
+// a replayed Trade log carries an older amount
 func (db *SQLDBBackend) UpdateFillAmount(hash common.Hash, amount string) error {
-	var order OrderModel
-	if err := db.Model(&order).Where(&OrderModel{HashID: hash.Hex()}).Update("filledAmount", amount).Error; err != nil {
+	filled, ok := new(big.Int).SetString(amount, 0)
+	if !ok {
+		return types.ErrDBOrderError
+	}
+	order, err := db.ReadOrderModel(hash)
+	if err != nil || order == nil {
+		return err
+	}
+	if recorded, ok := new(big.Int).SetString(order.FilledAmount, 0); ok && filled.Cmp(recorded) <= 0 {
+		db.logger.Debug("Old Fill Amount", "hash", hash.Hex(), "amount", amount, "recorded", order.FilledAmount)
+		return nil
+	}
+	if err := db.Model(&OrderModel{}).Where(&OrderModel{HashID: hash.Hex()}).Update("filled_amount", amount).Error; err != nil {
 		return err
 	}
 	return nil
@@ -174,22 +243,69 @@ func (db *SQLDBBackend) DeleteOrder(hash common.Hash) error {
 	return nil
 }
 
+//OrderNonce: next unused order nonce of maker, never less than 1
+func nextOrderNonce(db *gorm.DB, maker common.Address) (uint64, error) {
+	next := uint64(1)
+	n := OrderNonceModel{}
+	err := db.Where(&OrderNonceModel{Maker: maker.Hex()}).First(&n).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return 0, err
+	}
+	if err == nil && uint64(n.Nonce.Int64) > next {
+		next = uint64(n.Nonce.Int64)
+	}
+
+	var used sql.NullInt64
+	if err := db.Model(&OrderModel{}).Where(&OrderModel{Maker: maker.Hex()}).Select("max(nonce)").Row().Scan(&used); err != nil {
+		return 0, err
+	}
+	if used.Valid && uint64(used.Int64) >= next {
+		next = uint64(used.Int64) + 1
+	}
+	return next, nil
+}
+
+func (db *SQLDBBackend) ReadNextOrderNonce(maker common.Address) (uint64, error) {
+	return nextOrderNonce(&db.DB, maker)
+}
+
+//AllocOrderNonce returns the next unused order nonce of maker and marks it used
+func (db *SQLDBBackend) AllocOrderNonce(maker common.Address) (uint64, error) {
+	tx := db.Begin()
+	next, err := nextOrderNonce(tx, maker)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	n := OrderNonceModel{
+		Maker: maker.Hex(),
+		Nonce: sql.NullInt64{Int64: int64(next + 1), Valid: true},
+	}
+	if err := tx.Save(&n).Error; err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return 0, err
+	}
+	return next, nil
+}
+
 //Trade: CURD
+// CreateTrade records the trade of a Trade log once, a replayed log of the same tx and order
+// is skipped. The filled amount keeps apart the trades of an order in one tx.
 func (db *SQLDBBackend) CreateTrade(orderHash common.Hash, FilledAmount *big.Int, DealAmount *big.Int, BlockNum uint64, txHash common.Hash, taker common.Address) error {
-	last := TradeModel{}
-	found := db.Where(&TradeModel{HashID: orderHash.Hex()}).Last(&last).RecordNotFound()
-	if found {
-		if last.BlockNum.Int64 > int64(BlockNum) {
-			db.logger.Debug("Old Trade", "blockNum", BlockNum)
-			return nil
-		}
-		if last.BlockNum.Int64 == int64(BlockNum) {
-			amount, _ := new(big.Int).SetString(last.FilledAmount, 0)
-			if FilledAmount.Cmp(amount) <= 0 {
-				db.logger.Debug("Old Trade", "amount", amount.String())
-				return nil
-			}
-		}
+	var count int
+	if err := db.Model(&TradeModel{}).Where(&TradeModel{
+		HashID:       orderHash.Hex(),
+		TxHash:       txHash.Hex(),
+		FilledAmount: FilledAmount.String(),
+	}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		db.logger.Debug("Old Trade", "hash", orderHash.Hex(), "tx", txHash.Hex())
+		return nil
 	}
 	trade := TradeModel{
 		HashID:       orderHash.Hex(),
@@ -199,8 +315,7 @@ func (db *SQLDBBackend) CreateTrade(orderHash common.Hash, FilledAmount *big.Int
 		Taker:        taker.Hex(),
 		FilledAmount: FilledAmount.String(),
 	}
-	db.Save(&trade)
-	return nil
+	return db.Save(&trade).Error
 }
 
 //TODO:Query transactions on special demand
@@ -213,7 +328,7 @@ func (db *SQLDBBackend) QueryOrderByTxPair(tokenGet common.Address, tokenGive co
 	if err := db.Model(&OrderModel{}).Limit(count).Offset(index).Where(&OrderModel{
 		TokenGive: tokenGive.Hex(),
 		TokenGet:  tokenGet.Hex(),
-	}).Order("price").Find(&orders).Error; err != nil {
+	}).Where("state <> ?", Sending).Order("price").Find(&orders).Error; err != nil {
 		if gorm.IsRecordNotFoundError(err) {
 			return nil, nil
 		}
@@ -229,6 +344,183 @@ func (db *SQLDBBackend) QueryOrderByTxPair(tokenGet common.Address, tokenGive co
 	return rets, nil
 }
 
+//PendingTx: CURD
+func (db *SQLDBBackend) CreatePendingTx(tx *PendingTxModel) error {
+	return db.Create(tx).Error
+}
+
+func (db *SQLDBBackend) ReadPendingTx(hash common.Hash) (*PendingTxModel, error) {
+	tx := &PendingTxModel{}
+	if err := db.Where(&PendingTxModel{TxHash: hash.Hex()}).First(tx).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return tx, nil
+}
+
+//QueryPendingTxs: txs of from still waiting for receipt, all senders if from is empty
+func (db *SQLDBBackend) QueryPendingTxs(from common.Address) ([]*PendingTxModel, error) {
+	var txs []*PendingTxModel
+	query := db.Where("state = ?", TxPending)
+	if from != common.EmptyAddress {
+		query = query.Where(&PendingTxModel{From: from.Hex()})
+	}
+	if err := query.Order("id").Find(&txs).Error; err != nil {
+		return nil, err
+	}
+	return txs, nil
+}
+
+//QueryPendingTxsByNonce: txs of from with nonce still waiting for receipt, the original tx and its replacements
+func (db *SQLDBBackend) QueryPendingTxsByNonce(from common.Address, nonce uint64) ([]*PendingTxModel, error) {
+	var txs []*PendingTxModel
+	query := db.Where("state = ? AND nonce = ?", TxPending, nonce).Where(&PendingTxModel{From: from.Hex()})
+	if err := query.Order("id").Find(&txs).Error; err != nil {
+		return nil, err
+	}
+	return txs, nil
+}
+
+func (db *SQLDBBackend) UpdatePendingTx(tx *PendingTxModel) error {
+	return db.Save(tx).Error
+}
+
+//QueryStaleSendingOrders: hashes of the orders still Sending without a postOrder tx pending or mined since sentAfter
+func (db *SQLDBBackend) QueryStaleSendingOrders(sentAfter time.Time) ([]common.Hash, error) {
+	live := db.Model(&PendingTxModel{}).Select("order_hash").
+		Where("intent = ? AND order_hash IS NOT NULL AND state IN (?) AND created_at > ?", "postOrder", []int64{TxPending, TxSuccess}, sentAfter).QueryExpr()
+	var orders []OrderModel
+	if err := db.Model(&OrderModel{}).Select("hash_id").Where("state = ? AND hash_id NOT IN (?)", Sending, live).
+		Find(&orders).Error; err != nil {
+		return nil, err
+	}
+	hashes := make([]common.Hash, 0, len(orders))
+	for _, o := range orders {
+		hashes = append(hashes, common.HexToHash(o.HashID))
+	}
+	return hashes, nil
+}
+
+//QueryOpenOrdersByMaker: orders of maker not canceled, filled or expired at blockTime, pair is optional
+func (db *SQLDBBackend) QueryOpenOrdersByMaker(maker common.Address, pair *types.TokenPair, blockTime uint64) ([]*types.SignOrder, error) {
+	var orders []OrderModel
+	var rets []*types.SignOrder
+
+	query := db.Model(&OrderModel{}).Where(&OrderModel{Maker: maker.Hex()}).Where("state <> ? AND expires > ?", Finish, blockTime)
+	if pair != nil {
+		query = query.Where(&OrderModel{TokenGet: pair.TokenGet.Hex(), TokenGive: pair.TokenGive.Hex()})
+	}
+	if err := query.Order("nonce").Find(&orders).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	for _, a := range orders {
+		filled, ok := new(big.Int).SetString(a.FilledAmount, 0)
+		amountGet, _ := new(big.Int).SetString(a.AmountGet, 0)
+		if ok && amountGet != nil && filled.Cmp(amountGet) >= 0 {
+			continue
+		}
+		ret, err := a.ToSignOrder()
+		if err != nil {
+			return nil, err
+		}
+		rets = append(rets, ret)
+	}
+	return rets, nil
+}
+
+//QueryTokenPairs: distinct token pairs of the orders on chain
+func (db *SQLDBBackend) QueryTokenPairs() ([]*types.TokenPair, error) {
+	var pairs []OrderModel
+	if err := db.Model(&OrderModel{}).Select("distinct token_get, token_give").Where("state <> ?", Sending).
+		Order("token_get, token_give").Scan(&pairs).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	rets := make([]*types.TokenPair, 0, len(pairs))
+	for _, p := range pairs {
+		rets = append(rets, &types.TokenPair{
+			TokenGet:  common.HexToAddress(p.TokenGet),
+			TokenGive: common.HexToAddress(p.TokenGive),
+		})
+	}
+	return rets, nil
+}
+
+//QueryOpenOrdersByTxPair: orders of the pair on chain and not canceled, filled or expired at blockTime, order by price
+func (db *SQLDBBackend) QueryOpenOrdersByTxPair(tokenGet common.Address, tokenGive common.Address, blockTime uint64) ([]*OrderModel, error) {
+	var orders []*OrderModel
+	if err := db.Model(&OrderModel{}).Where(&OrderModel{
+		TokenGive: tokenGive.Hex(),
+		TokenGet:  tokenGet.Hex(),
+	}).Where("state = ? AND expires > ?", Trading, blockTime).Order("price").Find(&orders).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	rets := orders[:0]
+	for _, a := range orders {
+		filled, ok := new(big.Int).SetString(a.FilledAmount, 0)
+		amountGet, _ := new(big.Int).SetString(a.AmountGet, 0)
+		if ok && amountGet != nil && filled.Cmp(amountGet) >= 0 {
+			continue
+		}
+		rets = append(rets, a)
+	}
+	return rets, nil
+}
+
+//TradeRecord trade joined with its order
+type TradeRecord struct {
+	TradeModel
+	TokenGet   string
+	AmountGet  string
+	TokenGive  string
+	AmountGive string
+	Maker      string
+}
+
+//TradeFilter conditions of QueryTrades, nil fields are not checked
+type TradeFilter struct {
+	OrderHash *common.Hash
+	Taker     *common.Address
+	Pair      *types.TokenPair // trades of the pair in both directions
+}
+
+//QueryTrades: trades matching filter, latest first
+func (db *SQLDBBackend) QueryTrades(filter *TradeFilter, index uint64, count uint64) ([]*TradeRecord, error) {
+	var rets []*TradeRecord
+
+	query := db.Table("trade_models t").
+		Select("t.*, o.token_get, o.amount_get, o.token_give, o.amount_give, o.maker").
+		Joins("JOIN order_models o ON t.hash_id = o.hash_id").
+		Where("t.deleted_at IS NULL")
+	if filter.OrderHash != nil {
+		query = query.Where("t.hash_id = ?", filter.OrderHash.Hex())
+	}
+	if filter.Taker != nil {
+		query = query.Where("t.taker = ?", filter.Taker.Hex())
+	}
+	if filter.Pair != nil {
+		get, give := filter.Pair.TokenGet.Hex(), filter.Pair.TokenGive.Hex()
+		query = query.Where("(o.token_get = ? AND o.token_give = ?) OR (o.token_get = ? AND o.token_give = ?)", get, give, give, get)
+	}
+	if err := query.Order("t.block_num desc, t.id desc").Limit(count).Offset(index).Scan(&rets).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return rets, nil
+}
+
 //Account: CURD
 func (db *SQLDBBackend) CreateAccountBalance(account common.Address) error {
 	return db.Create(&AccountModel{UserID: account.Hex()}).Error
@@ -1,11 +1,19 @@
 package dex
 
 import (
+	"database/sql"
 	"fmt"
+	"math/big"
 	"testing"
+	"time"
 
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/lianxiangcloud/linkchain/libs/common"
+	"github.com/lianxiangcloud/linkchain/libs/hexutil"
+	"github.com/lianxiangcloud/linkchain/libs/log"
+	"github.com/lianxiangcloud/lkdex/types"
+	"github.com/stretchr/testify/assert"
 )
 
 func connectDB(driverName string, dbName string) (*SQLDBBackend, error) {
@@ -13,7 +21,7 @@ func connectDB(driverName string, dbName string) (*SQLDBBackend, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &SQLDBBackend{*db}, nil
+	return &SQLDBBackend{DB: *db, logger: log.Root()}, nil
 }
 
 type User struct {
@@ -87,3 +95,157 @@ func TestTrade(t *testing.T) {
 	}
 	db.AutoMigrate()
 }
+
+func testOrderModel(hash string, maker, tokenGet, tokenGive common.Address, nonce int64, state int64) *OrderModel {
+	return &OrderModel{
+		HashID:       hash,
+		TokenGet:     tokenGet.Hex(),
+		AmountGet:    "0x1",
+		TokenGive:    tokenGive.Hex(),
+		AmountGive:   "0x1",
+		Nonce:        sql.NullInt64{Int64: nonce, Valid: true},
+		Expires:      sql.NullInt64{Int64: 1, Valid: true},
+		Maker:        maker.Hex(),
+		R:            "0x1",
+		S:            "0x1",
+		V:            "0x1b",
+		State:        sql.NullInt64{Int64: state, Valid: true},
+		Price:        sql.NullFloat64{Float64: 1, Valid: true},
+		FilledAmount: "0",
+	}
+}
+
+func TestOrderNonce(t *testing.T) {
+	db, err := connectDB("sqlite3", "file:nonce?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.AutoMigrate(&OrderModel{}, &OrderNonceModel{})
+	assert := assert.New(t)
+	maker := common.HexToAddress("0xa73810e519e1075010678d706533486d8ecc8000")
+
+	next, err := db.ReadNextOrderNonce(maker)
+	assert.Nil(err)
+	assert.Equal(uint64(1), next)
+
+	nonce, err := db.AllocOrderNonce(maker)
+	assert.Nil(err)
+	assert.Equal(uint64(1), nonce)
+	nonce, err = db.AllocOrderNonce(maker)
+	assert.Nil(err)
+	assert.Equal(uint64(2), nonce)
+
+	//nonce used by an indexed order is skipped
+	db.Create(testOrderModel("0x01", maker, common.EmptyAddress, common.EmptyAddress, 10, Trading))
+	nonce, err = db.AllocOrderNonce(maker)
+	assert.Nil(err)
+	assert.Equal(uint64(11), nonce)
+
+	next, err = db.ReadNextOrderNonce(common.HexToAddress("0x1000000000000000000000000000000000000000"))
+	assert.Nil(err)
+	assert.Equal(uint64(1), next)
+}
+
+func TestQueryTrades(t *testing.T) {
+	db, err := connectDB("sqlite3", "file:trades?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.AutoMigrate(&OrderModel{}, &TradeModel{})
+	assert := assert.New(t)
+	tokenA := common.HexToAddress("0x95ccc08ab44ac6d071a0c5911df64ad2394a4c54")
+	tokenB := common.HexToAddress("0x95ccc08ab44ac6d071a0c5911df64ad2394a4123")
+	taker := common.HexToAddress("0xa73810e519e1075010678d706533486d8ecc8000")
+
+	db.Create(testOrderModel("0x01", taker, tokenA, tokenB, 1, Trading))
+	db.Create(testOrderModel("0x02", taker, tokenB, tokenA, 2, Trading))
+	db.Create(testOrderModel("0x03", taker, tokenB, common.EmptyAddress, 3, Sending))
+	db.Create(&TradeModel{HashID: "0x01", BlockNum: sql.NullInt64{Int64: 1, Valid: true}, Taker: taker.Hex()})
+	db.Create(&TradeModel{HashID: "0x02", BlockNum: sql.NullInt64{Int64: 2, Valid: true}})
+
+	pairs, err := db.QueryTokenPairs()
+	assert.Nil(err)
+	assert.Equal(2, len(pairs))
+
+	trades, err := db.QueryTrades(&TradeFilter{Pair: &types.TokenPair{TokenGet: tokenA, TokenGive: tokenB}}, 0, 10)
+	assert.Nil(err)
+	assert.Equal(2, len(trades))
+	assert.Equal("0x02", trades[0].HashID)
+	assert.Equal(tokenB.Hex(), trades[0].TokenGet)
+
+	trades, err = db.QueryTrades(&TradeFilter{Taker: &taker}, 0, 10)
+	assert.Nil(err)
+	assert.Equal(1, len(trades))
+	assert.Equal("0x01", trades[0].HashID)
+}
+
+func TestSendingOrders(t *testing.T) {
+	db, err := connectDB("sqlite3", "file:sending?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.AutoMigrate(&OrderModel{}, &PendingTxModel{})
+	assert := assert.New(t)
+	tokenA := common.HexToAddress("0x95ccc08ab44ac6d071a0c5911df64ad2394a4c54")
+	tokenB := common.HexToAddress("0x95ccc08ab44ac6d071a0c5911df64ad2394a4123")
+	maker := common.HexToAddress("0xa73810e519e1075010678d706533486d8ecc8000")
+	trading, live, stale, untracked := common.HexToHash("0x01"), common.HexToHash("0x02"), common.HexToHash("0x03"), common.HexToHash("0x04")
+
+	db.Create(testOrderModel(trading.Hex(), maker, tokenA, tokenB, 1, Trading))
+	db.Create(testOrderModel(live.Hex(), maker, tokenA, tokenB, 2, Sending))
+	db.Create(testOrderModel(stale.Hex(), maker, tokenA, tokenB, 3, Sending))
+	db.Create(testOrderModel(untracked.Hex(), maker, tokenA, tokenB, 4, Sending))
+	postOrderTx := func(hash string, order common.Hash, sent time.Time) *PendingTxModel {
+		ptx := &PendingTxModel{
+			TxHash:    hash,
+			From:      maker.Hex(),
+			Intent:    "postOrder",
+			OrderHash: order.Hex(),
+			Nonce:     sql.NullInt64{Int64: 1, Valid: true},
+			Data:      "postOrder",
+			State:     sql.NullInt64{Int64: TxPending, Valid: true},
+		}
+		ptx.CreatedAt = sent
+		return ptx
+	}
+	db.Create(postOrderTx("0x11", live, time.Now()))
+	db.Create(postOrderTx("0x13", stale, time.Now().Add(-time.Hour)))
+
+	//orders not on chain yet are not listed
+	orders, err := db.QueryOrderByTxPair(tokenA, tokenB, 0, 10)
+	assert.Nil(err)
+	assert.Equal(1, len(orders))
+	assert.Equal(hexutil.Uint64(1), orders[0].Nonce)
+
+	hashes, err := db.QueryStaleSendingOrders(time.Now().Add(-sendingOrderTimeout))
+	assert.Nil(err)
+	assert.ElementsMatch([]common.Hash{stale, untracked}, hashes)
+}
+
+func TestTradeReplay(t *testing.T) {
+	db, err := connectDB("sqlite3", "file:replay?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.AutoMigrate(&OrderModel{}, &TradeModel{})
+	assert := assert.New(t)
+	maker := common.HexToAddress("0xa73810e519e1075010678d706533486d8ecc8000")
+	order := common.HexToHash("0x01")
+	tx1, tx2 := common.HexToHash("0x11"), common.HexToHash("0x12")
+	db.Create(testOrderModel(order.Hex(), maker, common.EmptyAddress, common.EmptyAddress, 1, Trading))
+
+	//the logs of tx1 and tx2 are indexed, then replayed
+	for i := 0; i < 2; i++ {
+		assert.Nil(db.UpdateFillAmount(order, "10"))
+		assert.Nil(db.CreateTrade(order, big.NewInt(10), big.NewInt(10), 1, tx1, maker))
+		assert.Nil(db.UpdateFillAmount(order, "30"))
+		assert.Nil(db.CreateTrade(order, big.NewInt(30), big.NewInt(20), 2, tx2, maker))
+	}
+
+	var count int
+	db.Model(&TradeModel{}).Where(&TradeModel{HashID: order.Hex()}).Count(&count)
+	assert.Equal(2, count)
+	model, err := db.ReadOrderModel(order)
+	assert.Nil(err)
+	assert.Equal("30", model.FilledAmount)
+}
@@ -5,6 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/big"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/lianxiangcloud/linkchain/libs/common"
 	"github.com/lianxiangcloud/linkchain/libs/hexutil"
@@ -12,50 +15,327 @@ import (
 	"github.com/lianxiangcloud/linkchain/libs/rpc"
 	"github.com/lianxiangcloud/linkchain/rpc/filters"
 	lktypes "github.com/lianxiangcloud/linkchain/types"
+	"github.com/lianxiangcloud/lkdex/daemon"
 	"github.com/lianxiangcloud/lkdex/types"
 )
 
 type DexSubscription struct {
-	nodeUrl      string
-	client       *rpc.Client
+	peers        *daemon.Endpoints
+	dialer       *daemon.WSDialer // dials the peers with tls and auth, rpc.Dial if nil
+	nodeUrl      string           // url of client
+	client       logClient
+	chain        ChainClient
 	contractAddr common.Address
 	logger       log.Logger
 	db           *SQLDBBackend
 	begin        uint64
+	metrics      *Metrics
+	quit         chan struct{}
+	wake         chan struct{} // signals SubLoop that paused or resyncFrom changed
+
+	mu          sync.Mutex
+	height      uint64    // the logs are indexed up to this block
+	lastIndexed time.Time // a log or a catch up was last indexed at
+	live        bool      // the subscription is connected
+	paused      bool      // indexing is paused
+	resyncFrom  *uint64   // block to index the logs from again
 	//	restart      chan bool
 	// handerLog func(lktypes.Log)
 }
 
-func NewDexSubscription(peer string, contractAddr string, logger log.Logger, db *SQLDBBackend) (*DexSubscription, error) {
-	url := fmt.Sprintf("%s", peer)
-	client, err := rpc.Dial(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to dial peer(%s): %v", url, err)
-	}
-	return &DexSubscription{
-		nodeUrl:      url,
-		client:       client,
+const (
+	minResubscribeDelay = time.Second
+	maxResubscribeDelay = time.Minute
+	wsDialTimeout       = 10 * time.Second
+	catchUpInterval     = 5 * time.Second
+	catchUpTimeout      = 30 * time.Second
+)
+
+// NewDexSubscription connects to the first reachable ws url of peers through dialer, the others
+// are failed over to when the subscription fails. The chain head is read from chain.
+func NewDexSubscription(peers []string, dialer *daemon.WSDialer, contractAddr string, chain ChainClient, logger log.Logger, db *SQLDBBackend) (*DexSubscription, error) {
+	c := &DexSubscription{
+		peers:        daemon.NewEndpoints(peers),
+		dialer:       dialer,
+		chain:        chain,
 		contractAddr: common.HexToAddress(contractAddr),
 		logger:       logger,
 		db:           db,
+		metrics:      NopMetrics(),
+		quit:         make(chan struct{}),
+		wake:         make(chan struct{}, 1),
 		//restart:      make(chan bool, 1),
-	}, nil
+	}
+	if err := c.dial(); err != nil {
+		return nil, fmt.Errorf("failed to dial peer(%s): %v", strings.Join(peers, ","), err)
+	}
+	return c, nil
+}
+
+// dial connects to the selected url of the peers, failing over to the others
+func (c *DexSubscription) dial() error {
+	err := fmt.Errorf("no peer ws url")
+	for i := 0; i < c.peers.Len(); i++ {
+		url := c.peers.Current()
+		var client logClient
+		if client, err = c.dialURL(url); err == nil {
+			c.client, c.nodeUrl = client, url
+			return nil
+		}
+		c.peers.Failed(url, err)
+	}
+	return err
+}
+
+// dialURL connects a rpc client to url, through the dialer if there is one
+func (c *DexSubscription) dialURL(url string) (logClient, error) {
+	if c.dialer == nil {
+		client, err := rpc.Dial(url)
+		if err != nil {
+			return nil, err
+		}
+		return rpcLogClient{client}, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), wsDialTimeout)
+	defer cancel()
+	client, err := c.dialer.Dial(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return wsLogClient{client}, nil
+}
+
+// logClient is the rpc client of the log subscription
+type logClient interface {
+	CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error
+	SubscribeLogs(ctx context.Context, chanLog chan lktypes.Log, arg interface{}) (logSubscription, error)
+	Close()
+}
+
+// logSubscription is a subscription of a logClient
+type logSubscription interface {
+	Err() <-chan error
+	Unsubscribe()
+}
+
+// rpcLogClient is the logClient of a rpc.Client
+type rpcLogClient struct {
+	*rpc.Client
 }
 
-func (c *DexSubscription) SubLoop(chanLog chan lktypes.Log, cli *rpc.ClientSubscription) {
+func (c rpcLogClient) SubscribeLogs(ctx context.Context, chanLog chan lktypes.Log, arg interface{}) (logSubscription, error) {
+	sub, err := c.Subscribe(ctx, "lk", chanLog, "logsSubscribe", arg)
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// wsLogClient is the logClient of a daemon.WSClient, which dials with tls and auth
+type wsLogClient struct {
+	*daemon.WSClient
+}
+
+func (c wsLogClient) SubscribeLogs(ctx context.Context, chanLog chan lktypes.Log, arg interface{}) (logSubscription, error) {
+	sub, err := c.Subscribe(ctx, "lk", chanLog, "logsSubscribe", arg)
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// SubLoop indexes the logs of cli until quit, it subscribes again when cli fails
+// or is nil, and when indexing is paused or a resync is requested.
+// The logs up to the chain head are also read periodically, see catchUp.
+func (c *DexSubscription) SubLoop(chanLog chan lktypes.Log, cli logSubscription) {
+	defer func() {
+		c.client.Close()
+	}()
+	ticker := time.NewTicker(catchUpInterval)
+	defer ticker.Stop()
+	delay := minResubscribeDelay
 	for {
+		if cli == nil {
+			var ok bool
+			if cli, chanLog, ok = c.resubscribe(delay); !ok {
+				return
+			}
+		}
 		select {
 		case err := <-cli.Err():
-			c.logger.Error("connection peer(%s) error: %v", "URL", c.nodeUrl, "err", err)
+			c.logger.Error("Subscription error", "URL", c.nodeUrl, "err", err)
+			c.setLive(false)
 			c.client.Close()
-		//	c.restart <- true
+			c.peers.Failed(c.nodeUrl, err)
+			cli, delay = nil, minResubscribeDelay
 		case vLog := <-chanLog:
 			c.logger.Debug("Subscription", "block", vLog.BlockNumber) // pointer to event log
 			c.FilterrLog(&vLog)
+			c.indexed(vLog.BlockNumber)
+		case <-ticker.C:
+			if err := c.catchUp(); err != nil {
+				c.logger.Error("Subscription catch up fail", "URL", c.nodeUrl, "err", err)
+				c.setLive(false)
+				c.client.Close()
+				c.peers.Failed(c.nodeUrl, err)
+				cli, delay = nil, minResubscribeDelay
+			}
+		case <-c.wake:
+			if c.Paused() || c.resyncPending() {
+				cli.Unsubscribe()
+				c.setLive(false)
+				c.client.Close()
+				cli, delay = nil, 0
+			}
+		case <-c.quit:
+			cli.Unsubscribe()
+			return
 		}
 	}
 }
 
+// resubscribe dials the peer and subscribes from the indexed height, or from the
+// requested resync block, after delay. It retries waiting longer after each failure
+// and waits while indexing is paused. It returns false on quit.
+func (c *DexSubscription) resubscribe(delay time.Duration) (logSubscription, chan lktypes.Log, bool) {
+	reconnect := delay > 0
+	for {
+		var wait <-chan time.Time
+		if !c.Paused() {
+			wait = time.After(delay)
+		}
+		select {
+		case <-wait:
+		case <-c.wake:
+			// resumed or resync requested: retry now
+			delay = 0
+			continue
+		case <-c.quit:
+			return nil, nil, false
+		}
+		c.takeResync()
+		err := c.dial()
+		if err == nil {
+			var (
+				sub     logSubscription
+				chanLog chan lktypes.Log
+			)
+			if sub, chanLog, err = c.subscribe(); err == nil {
+				if reconnect {
+					c.metrics.Reconnects.Add(1)
+				}
+				c.peers.Up(c.nodeUrl)
+				c.logger.Info("Subscription connected", "URL", c.nodeUrl, "height", c.Height())
+				return sub, chanLog, true
+			}
+			c.client.Close()
+			c.peers.Failed(c.nodeUrl, err)
+		}
+		reconnect = true
+		if delay *= 2; delay < minResubscribeDelay {
+			delay = minResubscribeDelay
+		} else if delay > maxResubscribeDelay {
+			delay = maxResubscribeDelay
+		}
+		c.logger.Warn("Subscription reconnect fail", "URL", c.nodeUrl, "retry", delay, "err", err)
+	}
+}
+
+// Pause stops indexing the logs until Resume
+func (c *DexSubscription) Pause() {
+	c.mu.Lock()
+	c.paused = true
+	c.mu.Unlock()
+	c.notify()
+}
+
+// Resume indexes the logs again from the indexed height
+func (c *DexSubscription) Resume() {
+	c.mu.Lock()
+	c.paused = false
+	c.mu.Unlock()
+	c.notify()
+}
+
+// Paused reports whether indexing is paused
+func (c *DexSubscription) Paused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.paused
+}
+
+// Resync indexes the logs again from block from, the indexed records are kept
+// and the logs are applied over them.
+func (c *DexSubscription) Resync(from uint64) {
+	c.mu.Lock()
+	c.resyncFrom = &from
+	c.mu.Unlock()
+	c.notify()
+}
+
+func (c *DexSubscription) resyncPending() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.resyncFrom != nil
+}
+
+// takeResync moves the indexed height back to the requested resync block
+func (c *DexSubscription) takeResync() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.resyncFrom != nil {
+		c.logger.Info("Subscription resync", "from", *c.resyncFrom, "height", c.height)
+		c.height = *c.resyncFrom
+		c.resyncFrom = nil
+	}
+}
+
+// notify wakes SubLoop up to apply Pause, Resume and Resync
+func (c *DexSubscription) notify() {
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Height returns the block the logs are indexed up to
+func (c *DexSubscription) Height() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.height
+}
+
+// indexed records that the logs are indexed up to block height
+func (c *DexSubscription) indexed(height uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastIndexed = time.Now()
+	if height > c.height {
+		c.height = height
+	}
+}
+
+// LastIndexed returns when a log was last indexed or the logs were last read up to the
+// chain head, at least every catchUpInterval while the subscription works.
+func (c *DexSubscription) LastIndexed() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastIndexed
+}
+
+// Live reports whether the subscription is connected
+func (c *DexSubscription) Live() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.live
+}
+
+func (c *DexSubscription) setLive(live bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.live = live
+}
+
 type OrderRet struct {
 	TokenGet   common.Address `json:"tokenGet"`
 	AmountGet  string         `json:"amountGet"`
@@ -133,6 +413,7 @@ func (o *SignOrderRet) ToSignOrder() (*types.SignOrder, error) {
 func (c *DexSubscription) FilterrLog(vlog *lktypes.Log) error {
 	c.logger.Debug("EthSubscribe logs")
 	if len(vlog.Topics) > 0 {
+		c.metrics.Events.With("type", eventType(vlog.Topics[0])).Add(1)
 		ret := string(vlog.Data)
 		switch vlog.Topics[0] {
 		case common.BytesToHash([]byte("Order")):
@@ -150,7 +431,7 @@ func (c *DexSubscription) FilterrLog(vlog *lktypes.Log) error {
 				c.logger.Error("Event Order unmarshal err", "ret", ret, "err", err)
 				return err
 			}
-			err = c.db.CreateOrder(retS, 1)
+			err = c.db.CreateOrder(retS, Trading)
 			if err != nil {
 				c.logger.Error("Order Create err", "err", err)
 				return err
@@ -213,36 +494,90 @@ func (c *DexSubscription) FilterrLog(vlog *lktypes.Log) error {
 }
 
 func (c *DexSubscription) OnStart() error {
+	c.indexed(c.begin)
+	sub, chanLog, err := c.subscribe()
+	if err != nil {
+		// retried by SubLoop
+		c.client.Close()
+		c.peers.Failed(c.nodeUrl, err)
+		go c.SubLoop(nil, nil)
+		return err
+	}
+	go c.SubLoop(chanLog, sub)
+	return nil
+}
+
+// subscribe subscribes to the logs from the indexed height, then indexes the logs from that
+// height to the chain head. The subscription is opened first so that no log emitted meanwhile
+// is missed, the logs delivered by both are skipped when indexed again, see CreateOrder,
+// UpdateFillAmount and CreateTrade.
+func (c *DexSubscription) subscribe() (logSubscription, chan lktypes.Log, error) {
 	query := filters.FilterCriteria{
-		FromBlock: (*hexutil.Big)(new(big.Int).SetUint64(c.begin)),
+		FromBlock: (*hexutil.Big)(new(big.Int).SetUint64(c.Height())),
 		Addresses: []common.Address{c.contractAddr},
 	}
 	arg, err := toFilterArg(&query)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+
+	chanLog := make(chan lktypes.Log)
+	sub, err := c.client.SubscribeLogs(context.Background(), chanLog, arg)
+	if err != nil {
+		return nil, nil, err
 	}
 
+	// the logs are indexed up to the head at least once getLogs returns,
+	// the later ones are delivered by the subscription
+	var head uint64
+	if header, err := c.chain.GetBlockByNumber(context.Background(), "latest"); err == nil {
+		head = header.Number.ToInt().Uint64()
+	}
+	if err := c.getLogs(context.Background(), head); err != nil {
+		sub.Unsubscribe()
+		return nil, nil, err
+	}
+	c.setLive(true)
+	return sub, chanLog, nil
+}
+
+// catchUp indexes the logs from the indexed height to the chain head, those the subscription
+// delivers too are skipped when indexed again. The indexed height keeps up with the chain head
+// while the contract emits no log, and the logs of a stalled subscription are not missed.
+// A getLogs error fails the subscription, an unreachable chain daemon does not.
+func (c *DexSubscription) catchUp() error {
+	ctx, cancel := context.WithTimeout(context.Background(), catchUpTimeout)
+	defer cancel()
+	header, err := c.chain.GetBlockByNumber(ctx, "latest")
+	if err != nil {
+		c.logger.Debug("Subscription catch up", "err", err)
+		return nil
+	}
+	return c.getLogs(ctx, header.Number.ToInt().Uint64())
+}
+
+// getLogs indexes the logs of the contract from the indexed height, then records that the
+// logs are indexed up to head, which was read before. head is 0 if it could not be read.
+func (c *DexSubscription) getLogs(ctx context.Context, head uint64) error {
+	query := filters.FilterCriteria{
+		FromBlock: (*hexutil.Big)(new(big.Int).SetUint64(c.Height())),
+		Addresses: []common.Address{c.contractAddr},
+	}
 	//TODO: init result is too big
 	var result = make([]*lktypes.Log, 0)
-	if err := c.client.Call(&result, "lk_getLogs", query); err != nil {
+	if err := c.client.CallContext(ctx, &result, "lk_getLogs", query); err != nil {
 		c.logger.Error("getLogs", "err", err.Error())
-	} else {
-		c.logger.Debug("getLogs", "lenNum", len(result))
+		return err
 	}
+	c.logger.Debug("getLogs", "lenNum", len(result))
 
 	for _, log := range result {
-		err = c.FilterrLog(log)
-		if err!= nil{
-			c.logger.Error("FilterrLog","err",err.Error())
+		if err := c.FilterrLog(log); err != nil {
+			c.logger.Error("FilterrLog", "err", err.Error())
 		}
+		c.indexed(log.BlockNumber)
 	}
-
-	chanLog := make(chan lktypes.Log)
-	sub, err := c.client.Subscribe(context.Background(), "lk", chanLog, "logsSubscribe", arg)
-	if err != nil {
-		return err
-	}
-	go c.SubLoop(chanLog, sub)
+	c.indexed(head)
 	return nil
 }
 
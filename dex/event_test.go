@@ -0,0 +1,65 @@
+package dex
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/lianxiangcloud/linkchain/libs/common"
+	"github.com/lianxiangcloud/linkchain/libs/hexutil"
+	"github.com/lianxiangcloud/linkchain/libs/log"
+	"github.com/lianxiangcloud/linkchain/libs/rpc"
+	lktypes "github.com/lianxiangcloud/linkchain/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// FakeLogService serves lk_getLogs for TestCatchUp
+type FakeLogService struct {
+	from []uint64 // FromBlock of each query
+	logs []*lktypes.Log
+	err  error
+}
+
+func (s *FakeLogService) GetLogs(query map[string]interface{}) ([]*lktypes.Log, error) {
+	from, _ := hexutil.DecodeUint64(query["fromBlock"].(string))
+	s.from = append(s.from, from)
+	return s.logs, s.err
+}
+
+func TestCatchUp(t *testing.T) {
+	assert := assert.New(t)
+	service := &FakeLogService{}
+	srv := rpc.NewServer()
+	require.Nil(t, srv.RegisterName("lk", service))
+	defer srv.Stop()
+	chain := NewFakeChainClient(0)
+	c := &DexSubscription{
+		client:       rpcLogClient{rpc.DialInProc(srv)},
+		chain:        chain,
+		contractAddr: common.HexToAddress("0x01"),
+		logger:       log.NewNopLogger(),
+		metrics:      NopMetrics(),
+	}
+	defer c.client.Close()
+	c.indexed(10)
+
+	//no log is emitted: the height keeps up with the chain head
+	chain.SetHead(50, 1000)
+	assert.Nil(c.catchUp())
+	assert.Equal(uint64(50), c.Height())
+	service.logs = []*lktypes.Log{{Topics: []common.Hash{}, BlockNumber: 60}}
+	chain.SetHead(55, 1010)
+	assert.Nil(c.catchUp())
+	assert.Equal(uint64(60), c.Height())
+	assert.Equal([]uint64{10, 50}, service.from)
+
+	//the subscription fails with getLogs, not with the chain daemon
+	chain.SetHead(70, 1020)
+	service.err = errors.New("getLogs fail")
+	assert.NotNil(c.catchUp())
+	assert.Equal(uint64(60), c.Height())
+	chain.Err = errors.New("daemon unreachable")
+	assert.Nil(c.catchUp())
+	assert.Equal(uint64(60), c.Height())
+	assert.Equal(3, len(service.from))
+}
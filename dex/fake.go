@@ -0,0 +1,324 @@
+package dex
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"math/big"
+	"sync"
+
+	"github.com/lianxiangcloud/linkchain/libs/common"
+	"github.com/lianxiangcloud/linkchain/libs/crypto"
+	"github.com/lianxiangcloud/linkchain/libs/hexutil"
+	"github.com/lianxiangcloud/linkchain/rpc/rtypes"
+	lktypes "github.com/lianxiangcloud/linkchain/types"
+	wtypes "github.com/lianxiangcloud/linkchain/wallet/types"
+	"github.com/lianxiangcloud/lkdex/types"
+)
+
+// FakeChainClient is an in-memory ChainClient for tests. The zero value is a chain
+// whose head is its genesis block 0 at time 0.
+type FakeChainClient struct {
+	mu       sync.Mutex
+	genesis  uint64
+	head     uint64
+	time     uint64
+	receipts map[common.Hash]*TxReceipt
+	nonces   map[common.Address]uint64
+	sent     []hexutil.Bytes
+
+	// Gas is returned by EstimateGas
+	Gas hexutil.Uint64
+	// GasPrice is returned by SuggestGasPrice
+	GasPrice *big.Int
+	// CallFunc returns the result of Call, Call returns nil if it is nil
+	CallFunc func(args *rtypes.SendTxArgs) (hexutil.Bytes, error)
+	// ReceiptErr returns the error of GetTransactionReceipt for hash when it is set
+	ReceiptErr func(hash common.Hash) error
+	// Err is returned by every call when set, e.g. types.ErrNoConnectionToDaemon
+	Err error
+}
+
+// NewFakeChainClient returns a FakeChainClient whose head is its genesis block
+func NewFakeChainClient(genesis uint64) *FakeChainClient {
+	return &FakeChainClient{genesis: genesis, head: genesis, Gas: 21000, GasPrice: big.NewInt(1e11)}
+}
+
+// SetHead makes block number at time the chain head
+func (f *FakeChainClient) SetHead(number, time uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.head, f.time = number, time
+}
+
+// SetReceipt sets the receipt of tx hash, nil removes it
+func (f *FakeChainClient) SetReceipt(hash common.Hash, receipt *TxReceipt) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.receipts == nil {
+		f.receipts = make(map[common.Hash]*TxReceipt)
+	}
+	if receipt == nil {
+		delete(f.receipts, hash)
+		return
+	}
+	f.receipts[hash] = receipt
+}
+
+// SetNonce sets the nonce GetTransactionCount returns for addr
+func (f *FakeChainClient) SetNonce(addr common.Address, nonce uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.nonces == nil {
+		f.nonces = make(map[common.Address]uint64)
+	}
+	f.nonces[addr] = nonce
+}
+
+// Sent returns the raw txs sent with SendRawTx
+func (f *FakeChainClient) Sent() []hexutil.Bytes {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]hexutil.Bytes(nil), f.sent...)
+}
+
+func (f *FakeChainClient) GenesisBlockNumber(ctx context.Context) (*hexutil.Uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	n := hexutil.Uint64(f.genesis)
+	return &n, nil
+}
+
+func (f *FakeChainClient) Call(ctx context.Context, args *rtypes.SendTxArgs) (hexutil.Bytes, error) {
+	f.mu.Lock()
+	err, call := f.Err, f.CallFunc
+	f.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if call == nil {
+		return nil, nil
+	}
+	return call(args)
+}
+
+// CallBatch calls Call for each of args
+func (f *FakeChainClient) CallBatch(ctx context.Context, args []*rtypes.SendTxArgs) ([]CallResult, error) {
+	f.mu.Lock()
+	err := f.Err
+	f.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	results := make([]CallResult, len(args))
+	for i, a := range args {
+		results[i].Ret, results[i].Err = f.Call(ctx, a)
+	}
+	return results, nil
+}
+
+// SendRawTx records b and returns its keccak hash as the tx hash
+func (f *FakeChainClient) SendRawTx(ctx context.Context, b hexutil.Bytes, txType string) (common.Hash, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return common.EmptyHash, f.Err
+	}
+	f.sent = append(f.sent, b)
+	return crypto.Keccak256Hash(b), nil
+}
+
+// GetBlockByNumber returns the blocks up to the head, all with the time of the head
+func (f *FakeChainClient) GetBlockByNumber(ctx context.Context, blockNr string) (*BlockHeader, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	number := f.head
+	if blockNr != "latest" {
+		n, err := hexutil.DecodeUint64(blockNr)
+		if err != nil || n > f.head {
+			return nil, methodError(types.ErrDaemonResponseData, "eth_getBlockByNumber")
+		}
+		number = n
+	}
+	hash := common.BigToHash(new(big.Int).SetUint64(number))
+	return &BlockHeader{
+		Number: (*hexutil.Big)(new(big.Int).SetUint64(number)),
+		Hash:   &hash,
+		Time:   (*hexutil.Big)(new(big.Int).SetUint64(f.time)),
+	}, nil
+}
+
+func (f *FakeChainClient) GetTransactionReceipt(ctx context.Context, hash common.Hash) (*TxReceipt, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	if f.ReceiptErr != nil {
+		if err := f.ReceiptErr(hash); err != nil {
+			return nil, err
+		}
+	}
+	return f.receipts[hash], nil
+}
+
+func (f *FakeChainClient) GetTransactionCount(ctx context.Context, addr common.Address) (uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return 0, f.Err
+	}
+	return f.nonces[addr], nil
+}
+
+func (f *FakeChainClient) EstimateGas(ctx context.Context, args *rtypes.SendTxArgs) (hexutil.Uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return 0, f.Err
+	}
+	return f.Gas, nil
+}
+
+func (f *FakeChainClient) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	if f.GasPrice == nil {
+		return new(big.Int), nil
+	}
+	return new(big.Int).Set(f.GasPrice), nil
+}
+
+// FakeWalletClient is an in-memory WalletClient for tests signing with the keys added by AddKey
+type FakeWalletClient struct {
+	mu     sync.Mutex
+	keys   map[common.Address]*ecdsa.PrivateKey
+	nonces map[common.Address]uint64
+	signed []*rtypes.SendTxArgs
+
+	// Gas is returned by EstimateGas
+	Gas hexutil.Uint64
+	// Err is returned by every call when set, e.g. types.ErrWalletLocked
+	Err error
+}
+
+// NewFakeWalletClient returns a FakeWalletClient without keys
+func NewFakeWalletClient() *FakeWalletClient {
+	return &FakeWalletClient{
+		keys:   make(map[common.Address]*ecdsa.PrivateKey),
+		nonces: make(map[common.Address]uint64),
+		Gas:    21000,
+	}
+}
+
+// AddKey adds key to the wallet and returns its address
+func (f *FakeWalletClient) AddKey(key *ecdsa.PrivateKey) common.Address {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+	f.keys[addr] = key
+	return addr
+}
+
+// SetNonce sets the nonce GetTransactionCount returns for addr
+func (f *FakeWalletClient) SetNonce(addr common.Address, nonce uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.nonces[addr] = nonce
+}
+
+// Signed returns the txs signed with SignTx
+func (f *FakeWalletClient) Signed() []*rtypes.SendTxArgs {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*rtypes.SendTxArgs(nil), f.signed...)
+}
+
+// key returns the key of addr, the error of a wallet without it if there is none
+func (f *FakeWalletClient) key(method string, addr common.Address) (*ecdsa.PrivateKey, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	key, ok := f.keys[addr]
+	if !ok {
+		return nil, types.ErrWalletResponse.WithData(&types.ErrorData{Method: method, UpstreamMessage: "unknown account " + addr.Hex()})
+	}
+	return key, nil
+}
+
+func (f *FakeWalletClient) SignHash(ctx context.Context, addr common.Address, hash common.Hash) (hexutil.Bytes, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key, err := f.key("ltk_signHash", addr)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.Sign(hash.Bytes(), key)
+}
+
+// SignTx records args and returns their JSON encoding as the raw tx
+func (f *FakeWalletClient) SignTx(ctx context.Context, args *rtypes.SendTxArgs) (*rtypes.SignTransactionResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, err := f.key("ltk_signTransaction", args.From); err != nil {
+		return nil, err
+	}
+	raw, err := json.Marshal(MarshalTx(args))
+	if err != nil {
+		return nil, err
+	}
+	signed := *args
+	f.signed = append(f.signed, &signed)
+	return &rtypes.SignTransactionResult{Raw: raw, Tx: &lktypes.Transaction{}}, nil
+}
+
+// SendRawTransaction returns the keccak hash of b as the tx hash
+func (f *FakeWalletClient) SendRawTransaction(ctx context.Context, b hexutil.Bytes) (common.Hash, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return common.EmptyHash, f.Err
+	}
+	return crypto.Keccak256Hash(b), nil
+}
+
+func (f *FakeWalletClient) GetTransactionCount(ctx context.Context, addr common.Address) (uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return 0, f.Err
+	}
+	return f.nonces[addr], nil
+}
+
+func (f *FakeWalletClient) EstimateGas(ctx context.Context, args *rtypes.SendTxArgs) (hexutil.Uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return 0, f.Err
+	}
+	return f.Gas, nil
+}
+
+func (f *FakeWalletClient) Status(ctx context.Context) (*wtypes.StatusResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.Err != nil {
+		return nil, f.Err
+	}
+	return &wtypes.StatusResult{}, nil
+}
+
+var (
+	_ ChainClient  = (*FakeChainClient)(nil)
+	_ WalletClient = (*FakeWalletClient)(nil)
+)
@@ -0,0 +1,32 @@
+package dex
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/lianxiangcloud/lkdex/config"
+)
+
+// gasPrice returns the gas price of a tx calling contract method with the gas policy of method
+func (dex *Dex) gasPrice(ctx context.Context, method string) (*big.Int, error) {
+	policy := dex.config.Gas.Policy(method)
+	if policy.Strategy == config.GasPriceFixed {
+		return new(big.Int).SetUint64(policy.Price), nil
+	}
+
+	price, err := dex.chain.SuggestGasPrice(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if policy.Strategy == config.GasPriceMultiplier {
+		f := new(big.Float).SetInt(price)
+		f.Mul(f, big.NewFloat(policy.Multiplier))
+		price, _ = f.Int(nil)
+	}
+	if policy.MaxPrice != 0 {
+		if max := new(big.Int).SetUint64(policy.MaxPrice); price.Cmp(max) > 0 {
+			price = max
+		}
+	}
+	return price, nil
+}
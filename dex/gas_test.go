@@ -0,0 +1,79 @@
+package dex
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/lianxiangcloud/linkchain/libs/common"
+	"github.com/lianxiangcloud/linkchain/libs/crypto"
+	"github.com/lianxiangcloud/linkchain/libs/hexutil"
+	"github.com/lianxiangcloud/linkchain/rpc/rtypes"
+	"github.com/lianxiangcloud/lkdex/config"
+)
+
+func TestGasPrice(t *testing.T) {
+	ctx := context.Background()
+	chain := NewFakeChainClient(0)
+	chain.GasPrice = big.NewInt(2e10)
+	dex := newFakeDex(chain, NewFakeWalletClient())
+	dex.config.Gas.Methods = map[string]config.GasPolicy{
+		"trade":       {Strategy: config.GasPriceSuggested},
+		"cancelorder": {Strategy: config.GasPriceMultiplier, Multiplier: 1.5},
+		"withdraw":    {Strategy: config.GasPriceMultiplier, Multiplier: 10, MaxPrice: 1e11},
+	}
+
+	tests := []struct {
+		method string
+		price  *big.Int
+	}{
+		{"", big.NewInt(1e11)},
+		{"deposit", big.NewInt(1e11)},
+		{"trade", big.NewInt(2e10)},
+		{"cancelOrder", big.NewInt(3e10)},
+		{"withdraw", big.NewInt(1e11)},
+	}
+	for _, tt := range tests {
+		price, err := dex.gasPrice(ctx, tt.method)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.method, err)
+		}
+		if price.Cmp(tt.price) != 0 {
+			t.Errorf("%s: gas price %v, want %v", tt.method, price, tt.price)
+		}
+	}
+}
+
+func TestPostChainTxGas(t *testing.T) {
+	ctx := context.Background()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, wallet := NewFakeChainClient(0), NewFakeWalletClient()
+	from := wallet.AddKey(key)
+	wallet.Gas = 50000
+	dex := newFakeDex(chain, wallet)
+	dex.config.Gas.Strategy = config.GasPriceSuggested
+	dex.config.Gas.LimitMargin = 20
+	chain.GasPrice = big.NewInt(3e10)
+
+	to := common.HexToAddress(dex.config.ContractAddr)
+	if _, err := dex.PostChainTx(ctx, &rtypes.SendTxArgs{From: from, To: &to}); err != nil {
+		t.Fatal(err)
+	}
+	price := (*hexutil.Big)(big.NewInt(5e10))
+	if _, err := dex.PostChainTx(ctx, &rtypes.SendTxArgs{From: from, To: &to, GasPrice: price}); err != nil {
+		t.Fatal(err)
+	}
+	signed := wallet.Signed()
+	if len(signed) != 2 {
+		t.Fatalf("signed %+v", signed)
+	}
+	if uint64(*signed[0].Gas) != 60000 || signed[0].GasPrice.ToInt().Cmp(chain.GasPrice) != 0 {
+		t.Errorf("tx gas %d, gas price %v", *signed[0].Gas, signed[0].GasPrice)
+	}
+	if signed[1].GasPrice.ToInt().Cmp(price.ToInt()) != 0 {
+		t.Errorf("gas price %v of the caller replaced by %v", price, signed[1].GasPrice)
+	}
+}
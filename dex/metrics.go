@@ -0,0 +1,196 @@
+package dex
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+	"github.com/jinzhu/gorm"
+	"github.com/lianxiangcloud/linkchain/libs/common"
+
+	prometheus "github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+)
+
+// MetricsSubsystem is the subsystem of the dex metrics
+const MetricsSubsystem = "dex"
+
+// metricsInterval is the interval of the updates of the chain head and order book metrics
+var metricsInterval = 15 * time.Second
+
+// Metrics contains metrics exposed by this package.
+type Metrics struct {
+	// Number of contract events indexed, by type.
+	Events metrics.Counter
+	// Number of reconnections of the log subscription.
+	Reconnects metrics.Counter
+	// Height of the last block indexed.
+	SyncHeight metrics.Gauge
+	// Height of the chain head.
+	ChainHead metrics.Gauge
+	// Blocks between the chain head and the last block indexed.
+	SyncLag metrics.Gauge
+	// Time of a db query in seconds, by operation and table.
+	DBQueryDuration metrics.Histogram
+	// Number of open orders, by tokenGet and tokenGive.
+	OrderBookSize metrics.Gauge
+}
+
+// PrometheusMetrics returns Metrics build using Prometheus client library.
+func PrometheusMetrics(namespace string) *Metrics {
+	return &Metrics{
+		Events: prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: MetricsSubsystem,
+			Name:      "events_total",
+			Help:      "Number of contract events indexed.",
+		}, []string{"type"}),
+		Reconnects: prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: MetricsSubsystem,
+			Name:      "subscription_reconnects_total",
+			Help:      "Number of reconnections of the log subscription.",
+		}, []string{}),
+		SyncHeight: prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: MetricsSubsystem,
+			Name:      "sync_height",
+			Help:      "Height of the last block indexed.",
+		}, []string{}),
+		ChainHead: prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: MetricsSubsystem,
+			Name:      "chain_head",
+			Help:      "Height of the chain head.",
+		}, []string{}),
+		SyncLag: prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: MetricsSubsystem,
+			Name:      "sync_lag_blocks",
+			Help:      "Blocks between the chain head and the last block indexed.",
+		}, []string{}),
+		DBQueryDuration: prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: MetricsSubsystem,
+			Name:      "db_query_duration_seconds",
+			Help:      "Time of a db query in seconds.",
+		}, []string{"operation", "table"}),
+		OrderBookSize: prometheus.NewGaugeFrom(stdprometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: MetricsSubsystem,
+			Name:      "order_book_size",
+			Help:      "Number of open orders of a token pair.",
+		}, []string{"token_get", "token_give"}),
+	}
+}
+
+// NopMetrics returns no-op Metrics.
+func NopMetrics() *Metrics {
+	return &Metrics{
+		Events:          discard.NewCounter(),
+		Reconnects:      discard.NewCounter(),
+		SyncHeight:      discard.NewGauge(),
+		ChainHead:       discard.NewGauge(),
+		SyncLag:         discard.NewGauge(),
+		DBQueryDuration: discard.NewHistogram(),
+		OrderBookSize:   discard.NewGauge(),
+	}
+}
+
+// DexOption sets an optional parameter on the Dex.
+type DexOption func(*Dex)
+
+// WithMetrics sets the metrics, the chain head and order book metrics are only
+// updated if metrics are set.
+func WithMetrics(metrics *Metrics) DexOption {
+	return func(dex *Dex) {
+		dex.metrics = metrics
+		dex.reportMetrics = true
+	}
+}
+
+const dbStartKey = "dex:query_start"
+
+// SetMetrics records the duration of the queries of db
+func (db *SQLDBBackend) SetMetrics(metrics *Metrics) {
+	start := func(scope *gorm.Scope) {
+		scope.Set(dbStartKey, time.Now())
+	}
+	observe := func(operation string) func(scope *gorm.Scope) {
+		return func(scope *gorm.Scope) {
+			if v, ok := scope.Get(dbStartKey); ok {
+				metrics.DBQueryDuration.With("operation", operation, "table", scope.TableName()).
+					Observe(time.Since(v.(time.Time)).Seconds())
+			}
+		}
+	}
+	cb := db.Callback()
+	cb.Create().Before("gorm:begin_transaction").Register("dex:create_start", start)
+	cb.Create().After("gorm:commit_or_rollback_transaction").Register("dex:create_observe", observe("create"))
+	cb.Query().Before("gorm:query").Register("dex:query_start", start)
+	cb.Query().After("gorm:after_query").Register("dex:query_observe", observe("query"))
+	cb.RowQuery().Before("gorm:row_query").Register("dex:row_query_start", start)
+	cb.RowQuery().After("gorm:row_query").Register("dex:row_query_observe", observe("row_query"))
+	cb.Update().Before("gorm:begin_transaction").Register("dex:update_start", start)
+	cb.Update().After("gorm:commit_or_rollback_transaction").Register("dex:update_observe", observe("update"))
+	cb.Delete().Before("gorm:begin_transaction").Register("dex:delete_start", start)
+	cb.Delete().After("gorm:commit_or_rollback_transaction").Register("dex:delete_observe", observe("delete"))
+}
+
+// metricsLoop updates the chain head, sync and order book metrics until Stop
+func (dex *Dex) metricsLoop() {
+	ticker := time.NewTicker(metricsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			dex.updateMetrics(dex.ctx)
+		case <-dex.quit:
+			return
+		}
+	}
+}
+
+// updateMetrics updates the chain head, sync and order book metrics
+func (dex *Dex) updateMetrics(ctx context.Context) {
+	header, err := dex.chain.GetBlockByNumber(ctx, "latest")
+	if err != nil {
+		dex.Logger.Debug("updateMetrics", "err", err)
+		return
+	}
+	head := header.Number.ToInt().Uint64()
+	height := dex.dexSub.Height()
+	dex.metrics.ChainHead.Set(float64(head))
+	dex.metrics.SyncHeight.Set(float64(height))
+	if head > height {
+		dex.metrics.SyncLag.Set(float64(head - height))
+	} else {
+		dex.metrics.SyncLag.Set(0)
+	}
+
+	pairs, err := dex.dexDB.QueryTokenPairs()
+	if err != nil {
+		dex.Logger.Debug("updateMetrics", "err", err)
+		return
+	}
+	blockTime := header.Time.ToInt().Uint64()
+	for _, p := range pairs {
+		orders, err := dex.dexDB.QueryOpenOrdersByTxPair(p.TokenGet, p.TokenGive, blockTime)
+		if err != nil {
+			dex.Logger.Debug("updateMetrics", "err", err)
+			return
+		}
+		dex.metrics.OrderBookSize.With("token_get", p.TokenGet.Hex(), "token_give", p.TokenGive.Hex()).Set(float64(len(orders)))
+	}
+}
+
+// eventType returns the name of the event of topic
+func eventType(topic common.Hash) string {
+	for _, name := range []string{"Order", "Trade", "Cancel", "Withdraw", "Deposit"} {
+		if topic == common.BytesToHash([]byte(name)) {
+			return name
+		}
+	}
+	return "unknown"
+}
@@ -1,11 +1,13 @@
 package dex
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
 	"math/big"
+	"strings"
 
+	"github.com/lianxiangcloud/lkdex/config"
 	"github.com/lianxiangcloud/lkdex/daemon"
+	"github.com/lianxiangcloud/lkdex/types"
 	"github.com/lianxiangcloud/linkchain/libs/common"
 	"github.com/lianxiangcloud/linkchain/libs/hexutil"
 	"github.com/lianxiangcloud/linkchain/rpc/rtypes"
@@ -13,85 +15,172 @@ import (
 	wtypes "github.com/lianxiangcloud/linkchain/wallet/types"
 )
 
-// GenesisBlockNumber return genesisBlock init height
-func GenesisBlockNumber() (*hexutil.Uint64, error) {
-	p := make([]interface{}, 0)
-	body, err := daemon.CallJSONRPC("eth_genesisBlockNumber", p)
-	if err != nil || body == nil || len(body) == 0 {
-		return nil, wtypes.ErrNoConnectionToDaemon
-	}
+// noConnection returns the error of a failed call of method to the chain daemon
+func noConnection(method string, err error) error {
+	return types.ErrNoConnectionToDaemon.WithData(connectionErrorData(method, err))
+}
 
-	var jsonRes wtypes.RPCResponse
-	if err = json.Unmarshal(body, &jsonRes); err != nil {
-		//return nil, fmt.Errorf("GenesisBlockNumber json.Unmarshal(body, &jsonRes) fail, err:%v, body:%s", err, string(body))
-		return nil, wtypes.ErrDaemonResponseBody
-	}
-	if jsonRes.Error.Code != 0 {
-		//return nil, fmt.Errorf("json RPC error:%v,body:[%s]", jsonRes.Error, string(body))
-		return nil, wtypes.ErrDaemonResponseCode
+// noWalletConnection returns the error of a failed call of method to the wallet daemon
+func noWalletConnection(method string, err error) error {
+	return types.ErrNoConnectionToWalletDaemon.WithData(connectionErrorData(method, err))
+}
+
+func connectionErrorData(method string, err error) *types.ErrorData {
+	data := &types.ErrorData{Method: method}
+	if err != nil {
+		data.UpstreamMessage = err.Error()
 	}
+	return data
+}
+
+// methodError returns e with the daemon method that failed
+func methodError(e *types.Error, method string) error {
+	return e.WithData(&types.ErrorData{Method: method})
+}
+
+// daemonError maps the error object of a chain daemon response, keeping its code and message
+func daemonError(method string, rpcErr *daemon.RPCError) error {
+	data := &types.ErrorData{Method: method, UpstreamCode: rpcErr.Code, UpstreamMessage: rpcErr.Message}
+	if isRevert(rpcErr.Message) {
+		data.Reason = rpcErr.Message
+		return types.ErrExecutionReverted.WithData(data)
+	}
+	return types.ErrDaemonResponse.WithData(data)
+}
+
+// walletError maps the error object of a wallet daemon response, keeping its code and message
+func walletError(method string, rpcErr *daemon.RPCError) error {
+	data := &types.ErrorData{Method: method, UpstreamCode: rpcErr.Code, UpstreamMessage: rpcErr.Message}
+	switch {
+	case rpcErr.Code == wtypes.ErrAccountNeedUnlock.ErrorCode() || rpcErr.Code == wtypes.ErrWalletNotOpen.ErrorCode() ||
+		strings.Contains(strings.ToLower(rpcErr.Message), "unlock"):
+		return types.ErrWalletLocked.WithData(data)
+	case rpcErr.Code == wtypes.ErrEstimateGas.ErrorCode() || isRevert(rpcErr.Message):
+		data.Reason = rpcErr.Message
+		return types.ErrExecutionReverted.WithData(data)
+	}
+	return types.ErrWalletResponse.WithData(data)
+}
+
+// callError maps an error of daemon.Call of method to a dex error
+func callError(method string, err error, rpcError func(string, *daemon.RPCError) error, connError func(string, error) error) error {
+	if rpcErr, ok := err.(*daemon.RPCError); ok {
+		return rpcError(method, rpcErr)
+	}
+	switch err {
+	case nil:
+		return nil
+	case daemon.ErrInvalidResponse, daemon.ErrNoResponse:
+		return methodError(types.ErrDaemonResponseBody, method)
+	case daemon.ErrInvalidResult:
+		return methodError(types.ErrDaemonResponseData, method)
+	}
+	return connError(method, err)
+}
+
+// nodeClient is the ChainClient calling a linkchain node daemon
+type nodeClient struct {
+	c *daemon.DaemonClient
+}
+
+// NewChainClient returns the ChainClient calling the linkchain node through c
+func NewChainClient(c *daemon.DaemonClient) ChainClient {
+	return &nodeClient{c: c}
+}
 
+// call calls method of the chain daemon and decodes its result into result
+func (n *nodeClient) call(ctx context.Context, method string, result interface{}, params ...interface{}) error {
+	return callError(method, n.c.Call(ctx, method, result, params...), daemonError, noConnection)
+}
+
+// walletClient is the WalletClient calling a wallet daemon
+type walletClient struct {
+	c *daemon.DaemonClient
+}
+
+// NewWalletClient returns the WalletClient calling the wallet through c
+func NewWalletClient(c *daemon.DaemonClient) WalletClient {
+	return &walletClient{c: c}
+}
+
+// call calls method of the wallet daemon and decodes its result into result
+func (w *walletClient) call(ctx context.Context, method string, result interface{}, params ...interface{}) error {
+	return callError(method, w.c.Call(ctx, method, result, params...), walletError, noWalletConnection)
+}
+
+// isRevert reports whether msg of a daemon error is a failed contract execution
+func isRevert(msg string) bool {
+	msg = strings.ToLower(msg)
+	return strings.Contains(msg, "revert") || strings.Contains(msg, "always failing transaction")
+}
+
+// GenesisBlockNumber return genesisBlock init height
+func (n *nodeClient) GenesisBlockNumber(ctx context.Context) (*hexutil.Uint64, error) {
 	var blockNumber hexutil.Uint64
-	if err = json.Unmarshal(jsonRes.Result, &blockNumber); err != nil {
-		//return nil, fmt.Errorf("json.Unmarshal jsonRes.Result fail, err:%v, body:%s", err, string(body))
-		return nil, wtypes.ErrDaemonResponseData
+	if err := n.call(ctx, "eth_genesisBlockNumber", &blockNumber); err != nil {
+		return nil, err
 	}
-
 	return &blockNumber, nil
 }
 
-// GenesisBlockNumber return genesisBlock init height
-func EthCall(args *rtypes.SendTxArgs) (hexutil.Bytes, error) {
-	p := make([]interface{}, 2)
-	p[0] = MarshalTx(args)
-	p[1] = "latest"
-	body, err := daemon.CallJSONRPC("eth_call", p)
-	if err != nil || body == nil || len(body) == 0 {
-		return nil, wtypes.ErrNoConnectionToDaemon
+// Call executes a call of args on the chain head without creating a tx
+func (n *nodeClient) Call(ctx context.Context, args *rtypes.SendTxArgs) (hexutil.Bytes, error) {
+	var ret hexutil.Bytes
+	if err := n.call(ctx, "eth_call", &ret, MarshalTx(args), "latest"); err != nil {
+		return nil, err
 	}
+	return ret, nil
+}
 
-	var jsonRes wtypes.RPCResponse
-	if err = json.Unmarshal(body, &jsonRes); err != nil {
-		//return nil, fmt.Errorf("GenesisBlockNumber json.Unmarshal(body, &jsonRes) fail, err:%v, body:%s", err, string(body))
-		return nil, wtypes.ErrDaemonResponseBody
+// CallBatch executes the calls of args on the chain head in batch requests
+func (n *nodeClient) CallBatch(ctx context.Context, args []*rtypes.SendTxArgs) ([]CallResult, error) {
+	rets := make([]hexutil.Bytes, len(args))
+	batch := make([]daemon.BatchElem, len(args))
+	for i, a := range args {
+		batch[i] = daemon.BatchElem{Method: "eth_call", Params: []interface{}{MarshalTx(a), "latest"}, Result: &rets[i]}
 	}
-	if jsonRes.Error.Code != 0 {
-		//return nil, fmt.Errorf("json RPC error:%v,body:[%s]", jsonRes.Error, string(body))
-		return nil, wtypes.ErrDaemonResponseCode
+	if err := n.c.BatchCall(ctx, batch); err != nil {
+		return nil, callError("eth_call", err, daemonError, noConnection)
 	}
-
-	var ret hexutil.Bytes
-	if err = json.Unmarshal(jsonRes.Result, &ret); err != nil {
-		//return nil, fmt.Errorf("json.Unmarshal jsonRes.Result fail, err:%v, body:%s", err, string(body))
-		return nil, wtypes.ErrDaemonResponseData
+	results := make([]CallResult, len(args))
+	for i := range batch {
+		results[i] = CallResult{Ret: rets[i], Err: callError("eth_call", batch[i].Error, daemonError, noConnection)}
 	}
-
-	return ret, nil
+	return results, nil
 }
 
-func WalletSignHash(addr common.Address, hash common.Hash) (hexutil.Bytes, error) {
-	p := make([]interface{}, 2)
-	p[0] = addr
-	p[1] = hash
-	body, err := daemon.WalletCallJSONRPC("ltk_signHash", p)
-	if err != nil || body == nil || len(body) == 0 {
-		return nil, wtypes.ErrNoConnectionToDaemon
+// GetTransactionCount returns the nonce of the next tx of addr
+func (n *nodeClient) GetTransactionCount(ctx context.Context, addr common.Address) (uint64, error) {
+	var nonce hexutil.Uint64
+	if err := n.call(ctx, "eth_getTransactionCount", &nonce, addr, "latest"); err != nil {
+		return 0, err
 	}
+	return uint64(nonce), nil
+}
 
-	var jsonRes wtypes.RPCResponse
-	if err = json.Unmarshal(body, &jsonRes); err != nil {
-		//return nil, fmt.Errorf("GenesisBlockNumber json.Unmarshal(body, &jsonRes) fail, err:%v, body:%s", err, string(body))
-		return nil, wtypes.ErrDaemonResponseBody
+// EstimateGas returns the gas the tx of args uses
+func (n *nodeClient) EstimateGas(ctx context.Context, args *rtypes.SendTxArgs) (hexutil.Uint64, error) {
+	var gas hexutil.Uint64
+	if err := n.call(ctx, "eth_estimateGas", &gas, MarshalTx(args)); err != nil {
+		return 0, err
 	}
-	if jsonRes.Error.Code != 0 {
-		//return nil, fmt.Errorf("json RPC error:%v,body:[%s]", jsonRes.Error, string(body))
-		return nil, wtypes.ErrDaemonResponseCode
+	return gas, nil
+}
+
+// SuggestGasPrice returns the gas price the node suggests
+func (n *nodeClient) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	var price hexutil.Big
+	if err := n.call(ctx, "eth_gasPrice", &price); err != nil {
+		return nil, err
 	}
+	return price.ToInt(), nil
+}
 
+// SignHash signs hash with the key of addr
+func (w *walletClient) SignHash(ctx context.Context, addr common.Address, hash common.Hash) (hexutil.Bytes, error) {
 	var signData hexutil.Bytes
-	if err = json.Unmarshal(jsonRes.Result, &signData); err != nil {
-		//return nil, fmt.Errorf("json.Unmarshal jsonRes.Result fail, err:%v, body:%s", err, string(body))
-		return nil, wtypes.ErrDaemonResponseData
+	if err := w.call(ctx, "ltk_signHash", &signData, addr, hash); err != nil {
+		return nil, err
 	}
 	return signData, nil
 }
@@ -112,7 +201,7 @@ func MarshalTx(args *rtypes.SendTxArgs) map[string]interface{} {
 	if args.GasPrice != nil && args.GasPrice.ToInt().Cmp(big.NewInt(0)) > 0 {
 		req["gasPrice"] = args.GasPrice
 	} else {
-		req["gasPrice"] = (*hexutil.Big)(big.NewInt(1e11))
+		req["gasPrice"] = (*hexutil.Big)(new(big.Int).SetUint64(config.DefaultGasPrice))
 	}
 	if args.Value != nil {
 		req["value"] = args.Value
@@ -126,133 +215,92 @@ func MarshalTx(args *rtypes.SendTxArgs) map[string]interface{} {
 	return req
 }
 
-func WalletSignTx(args *rtypes.SendTxArgs) (*rtypes.SignTransactionResult, error) {
-	body, err := daemon.WalletCallJSONRPC("ltk_signTransaction", []interface{}{MarshalTx(args)})
-	if err != nil || body == nil || len(body) == 0 {
-		return nil, wtypes.ErrNoConnectionToDaemon
-	}
-
-	var jsonRes wtypes.RPCResponse
-	if err = json.Unmarshal(body, &jsonRes); err != nil {
-		//return nil, fmt.Errorf("GenesisBlockNumber json.Unmarshal(body, &jsonRes) fail, err:%v, body:%s", err, string(body))
-		return nil, wtypes.ErrDaemonResponseBody
-	}
-	if jsonRes.Error.Code != 0 {
-		//return nil, fmt.Errorf("json RPC error:%v,body:[%s]", jsonRes.Error, string(body))
-		return nil, wtypes.ErrDaemonResponseCode
-	}
-
+// SignTx signs the tx of args with the key of args.From
+func (w *walletClient) SignTx(ctx context.Context, args *rtypes.SendTxArgs) (*rtypes.SignTransactionResult, error) {
 	result := rtypes.SignTransactionResult{Raw: nil, Tx: &lktypes.Transaction{}}
-	if err = json.Unmarshal(jsonRes.Result, &result); err != nil {
-		//return nil, fmt.Errorf("json.Unmarshal jsonRes.Result fail, err:%v, body:%s", err, string(body))
-		return nil, wtypes.ErrDaemonResponseData
+	if err := w.call(ctx, "ltk_signTransaction", &result, MarshalTx(args)); err != nil {
+		return nil, err
 	}
 	return &result, nil
 }
 
-func WalletSendRawTransaction(b hexutil.Bytes) (common.Hash, error) {
-	p := make([]interface{}, 1)
-	p[0] = b
-	body, err := daemon.WalletCallJSONRPC("ltk_sendRawTransaction", p)
-	if err != nil || body == nil || len(body) == 0 {
-		return common.EmptyHash, wtypes.ErrNoConnectionToDaemon
-	}
-
-	var jsonRes wtypes.RPCResponse
-	if err = json.Unmarshal(body, &jsonRes); err != nil {
-		//return nil, fmt.Errorf("GenesisBlockNumber json.Unmarshal(body, &jsonRes) fail, err:%v, body:%s", err, string(body))
-		return common.EmptyHash, wtypes.ErrDaemonResponseBody
-	}
-	if jsonRes.Error.Code != 0 {
-		//return nil, fmt.Errorf("json RPC error:%v,body:[%s]", jsonRes.Error, string(body))
-		return common.EmptyHash, wtypes.ErrDaemonResponseCode
-	}
-
+// SendRawTransaction sends the signed tx b through the wallet
+func (w *walletClient) SendRawTransaction(ctx context.Context, b hexutil.Bytes) (common.Hash, error) {
 	var hash common.Hash
-	if err = json.Unmarshal(jsonRes.Result, &hash); err != nil {
-		//return nil, fmt.Errorf("json.Unmarshal jsonRes.Result fail, err:%v, body:%s", err, string(body))
-		return common.EmptyHash, wtypes.ErrDaemonResponseData
+	if err := w.call(ctx, "ltk_sendRawTransaction", &hash, b); err != nil {
+		return common.EmptyHash, err
 	}
 	return hash, nil
 }
 
-func SendRawTx(b hexutil.Bytes, txType string) (common.Hash, error) {
-	p := make([]interface{}, 2)
-	p[0] = b
-	p[1] = txType
-	body, err := daemon.CallJSONRPC("eth_sendRawTx", p)
-	if err != nil || body == nil || len(body) == 0 {
-		return common.EmptyHash, wtypes.ErrNoConnectionToDaemon
-	}
-
-	var jsonRes wtypes.RPCResponse
-	if err = json.Unmarshal(body, &jsonRes); err != nil {
-		//return nil, fmt.Errorf("GenesisBlockNumber json.Unmarshal(body, &jsonRes) fail, err:%v, body:%s", err, string(body))
-		return common.EmptyHash, wtypes.ErrDaemonResponseBody
-	}
-	if jsonRes.Error.Code != 0 {
-		//return nil, fmt.Errorf("json RPC error:%v,body:[%s]", jsonRes.Error, string(body))
-		return common.EmptyHash, wtypes.ErrDaemonResponseCode
-	}
-
+// SendRawTx sends the signed tx b of txType ("tx" or "txt")
+func (n *nodeClient) SendRawTx(ctx context.Context, b hexutil.Bytes, txType string) (common.Hash, error) {
 	var hash common.Hash
-	if err = json.Unmarshal(jsonRes.Result, &hash); err != nil {
-		//return nil, fmt.Errorf("json.Unmarshal jsonRes.Result fail, err:%v, body:%s", err, string(body))
-		return common.EmptyHash, wtypes.ErrDaemonResponseData
+	if err := n.call(ctx, "eth_sendRawTx", &hash, b, txType); err != nil {
+		return common.EmptyHash, err
 	}
 	return hash, nil
 }
 
-func WalletGetTransactionCount(addr common.Address) (uint64, error) {
-	p := make([]interface{}, 2)
-	p[0] = addr
-	p[1] = `latest`
-	body, err := daemon.WalletCallJSONRPC("ltk_getTransactionCount", p)
-	if err != nil || body == nil || len(body) == 0 {
-		return 0, wtypes.ErrNoConnectionToDaemon
+// GetTransactionCount returns the nonce of the next tx of addr
+func (w *walletClient) GetTransactionCount(ctx context.Context, addr common.Address) (uint64, error) {
+	var nonce hexutil.Uint64
+	if err := w.call(ctx, "ltk_getTransactionCount", &nonce, addr, "latest"); err != nil {
+		return 0, err
 	}
+	return uint64(nonce), nil
+}
 
-	var jsonRes wtypes.RPCResponse
-	if err = json.Unmarshal(body, &jsonRes); err != nil {
-		//return nil, fmt.Errorf("GenesisBlockNumber json.Unmarshal(body, &jsonRes) fail, err:%v, body:%s", err, string(body))
-		return 0, wtypes.ErrDaemonResponseBody
-	}
-	if jsonRes.Error.Code != 0 {
-		//return nil, fmt.Errorf("json RPC error:%v,body:[%s]", jsonRes.Error, string(body))
-		return 0, wtypes.ErrDaemonResponseCode
+// EstimateGas returns the gas the tx of args uses
+func (w *walletClient) EstimateGas(ctx context.Context, args *rtypes.SendTxArgs) (hexutil.Uint64, error) {
+	var gas hexutil.Uint64
+	if err := w.call(ctx, "ltk_estimateGas", &gas, MarshalTx(args)); err != nil {
+		return 0, err
 	}
+	return gas, nil
+}
 
-	var nonce hexutil.Uint64
-	if err = json.Unmarshal(jsonRes.Result, &nonce); err != nil {
-		//return nil, fmt.Errorf("json.Unmarshal jsonRes.Result fail, err:%v, body:%s", err, string(body))
-		fmt.Println(err)
-		return 0, wtypes.ErrDaemonResponseData
+// Status return the status of the wallet daemon
+func (w *walletClient) Status(ctx context.Context) (*wtypes.StatusResult, error) {
+	var status wtypes.StatusResult
+	if err := w.call(ctx, "ltk_status", &status); err != nil {
+		return nil, err
 	}
-	uNonce := uint64(nonce)
-	return uNonce, nil
+	return &status, nil
 }
 
-func WalletEstimateGas(args *rtypes.SendTxArgs) (hexutil.Uint64, error) {
-	body, err := daemon.WalletCallJSONRPC("ltk_estimateGas", []interface{}{MarshalTx(args)})
-	if err != nil || body == nil || len(body) == 0 {
-		return 0, wtypes.ErrNoConnectionToDaemon
-	}
+// BlockHeader is the part of a linkchain RPC block used by dex
+type BlockHeader struct {
+	Number *hexutil.Big `json:"number"`
+	Hash   *common.Hash `json:"hash"`
+	Time   *hexutil.Big `json:"timestamp"`
+}
 
-	var jsonRes wtypes.RPCResponse
-	if err = json.Unmarshal(body, &jsonRes); err != nil {
-		return 0, fmt.Errorf("estimateGas json.Unmarshal(body, &jsonRes) fail, err:%v, body:%s", err, string(body))
-		//		return 0, wtypes.ErrDaemonResponseBody
+// GetBlockByNumber return the header of block blockNr ("latest" for the chain head)
+func (n *nodeClient) GetBlockByNumber(ctx context.Context, blockNr string) (*BlockHeader, error) {
+	var header BlockHeader
+	if err := n.call(ctx, "eth_getBlockByNumber", &header, blockNr, false); err != nil {
+		return nil, err
 	}
-
-	if jsonRes.Error.Code != 0 {
-		return 0, fmt.Errorf("json RPC error:%v,body:[%s]", jsonRes.Error, string(body))
-		//	return 0, wtypes.ErrDaemonResponseCode
+	if header.Number == nil || header.Time == nil {
+		return nil, methodError(types.ErrDaemonResponseData, "eth_getBlockByNumber")
 	}
+	return &header, nil
+}
 
-	var gas hexutil.Uint64
-	if err = json.Unmarshal(jsonRes.Result, &gas); err != nil {
-		return 0, fmt.Errorf("json.Unmarshal jsonRes.Result fail, err:%v, body:%s", err, string(body))
-		//	return gas, wtypes.ErrDaemonResponseData
+// TxReceipt is the part of a linkchain tx receipt used by dex
+type TxReceipt struct {
+	BlockNumber hexutil.Uint64 `json:"blockNumber"`
+	GasUsed     hexutil.Uint64 `json:"gasUsed"`
+	Status      hexutil.Uint   `json:"status"`
+	VMErr       string         `json:"vmerr"`
+}
+
+// GetTransactionReceipt return the receipt of tx hash, nil if the tx is not in a block yet
+func (n *nodeClient) GetTransactionReceipt(ctx context.Context, hash common.Hash) (*TxReceipt, error) {
+	var receipt *TxReceipt
+	if err := n.call(ctx, "eth_getTransactionReceipt", &receipt, hash); err != nil {
+		return nil, err
 	}
-	return gas, nil
+	return receipt, nil
 }
@@ -1,6 +1,7 @@
 package dex
 
 import (
+	"context"
 	"fmt"
 	"math/big"
 	"testing"
@@ -16,16 +17,24 @@ var adminAddr = common.HexToAddress("0xa73810e519e1075010678d706533486d8ecc8000"
 
 //TODO: Mock Wallet Test
 func TestBasic(t *testing.T) {
-	daemon.InitDaemonClient(config.DefaultDaemonConfig())
-	daemon.InitWalletDaemonClient(config.DefaultWalletDaemonConfig())
-	n, err := GenesisBlockNumber()
+	nodeClient, err := daemon.NewNodeClient(config.DefaultDaemonConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	walletClient, err := daemon.NewWalletClient(config.DefaultWalletDaemonConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, wallet := NewChainClient(nodeClient), NewWalletClient(walletClient)
+	ctx := context.Background()
+	n, err := chain.GenesisBlockNumber(ctx)
 	if err != nil {
 		t.Error("GenesisBlockNumber")
 		fmt.Println(err)
 	}
 	fmt.Println(n)
 
-	sign, err := WalletSignHash(adminAddr, common.HexToHash("0x6c554f11cc33de44e2687e6539c27d9fad08db76803f92008d7cfcea55ad597a"))
+	sign, err := wallet.SignHash(ctx, adminAddr, common.HexToHash("0x6c554f11cc33de44e2687e6539c27d9fad08db76803f92008d7cfcea55ad597a"))
 	if err != nil {
 		t.Error("WalletSignHash")
 		fmt.Println(err)
@@ -33,7 +42,7 @@ func TestBasic(t *testing.T) {
 		fmt.Println(sign)
 	}
 
-	nonce, err := WalletGetTransactionCount(adminAddr)
+	nonce, err := wallet.GetTransactionCount(ctx, adminAddr)
 	if err != nil {
 		t.Error("WalletSignHash")
 		fmt.Println(err)
@@ -52,7 +61,7 @@ func TestBasic(t *testing.T) {
 	*tx.Gas = 0x1
 	*tx.Nonce = hexutil.Uint64(nonce)
 
-	signTxResult, err := WalletSignTx(&tx)
+	signTxResult, err := wallet.SignTx(ctx, &tx)
 	if err != nil {
 		t.Error("WalletSignTx")
 		fmt.Println(err)
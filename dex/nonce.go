@@ -0,0 +1,157 @@
+package dex
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lianxiangcloud/linkchain/libs/common"
+	"github.com/lianxiangcloud/lkdex/types"
+)
+
+// nonceGapTimeout is how long the nonce count of an account may stay behind the nonces handed
+// out before the txs from the count on are taken as dropped and their nonces handed out again,
+// unless the Dex still tracks one of them as pending
+const nonceGapTimeout = 2 * time.Minute
+
+// nonceManager hands out the nonces of the txs the Dex sends. The nonces of an account are
+// handed out one at a time: the nonce of a tx is locked until the tx is sent, so that
+// concurrent txs of the account neither reuse nor skip a nonce.
+type nonceManager struct {
+	wallet WalletClient
+	// pending returns the nonce after the pending txs of from recorded by the Dex, false if
+	// there are none, it may be nil
+	pending    func(from common.Address) (uint64, bool)
+	gapTimeout time.Duration
+	now        func() time.Time
+
+	mu       sync.Mutex
+	accounts map[common.Address]*accountNonce
+}
+
+// accountNonce is the nonce state of an account
+type accountNonce struct {
+	mu     sync.Mutex // held from next until the tx of the nonce is sent
+	synced bool       // next is known, it is read from the chain again when false
+	next   uint64     // nonce of the next tx
+	count  uint64     // nonce count of the chain at the last check
+	moved  time.Time  // when count last changed or a tx of nonce count was sent
+}
+
+func newNonceManager(wallet WalletClient, pending func(from common.Address) (uint64, bool)) *nonceManager {
+	return &nonceManager{
+		wallet:     wallet,
+		pending:    pending,
+		gapTimeout: nonceGapTimeout,
+		now:        time.Now,
+		accounts:   make(map[common.Address]*accountNonce),
+	}
+}
+
+func (m *nonceManager) account(from common.Address) *accountNonce {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.accounts[from]
+	if !ok {
+		a = &accountNonce{}
+		m.accounts[from] = a
+	}
+	return a
+}
+
+// next locks the nonces of from and returns the nonce of its next tx. done must be called
+// with the error of sending the tx, it unlocks the nonces. The nonce is handed out again
+// if the tx was not sent, and the nonces are read from the chain again if the node
+// rejected the nonce.
+func (m *nonceManager) next(ctx context.Context, from common.Address) (uint64, func(err error), error) {
+	a := m.account(from)
+	a.mu.Lock()
+	count, err := m.wallet.GetTransactionCount(ctx, from)
+	if err != nil {
+		a.mu.Unlock()
+		return 0, nil, err
+	}
+
+	now := m.now()
+	switch {
+	case !a.synced:
+		a.next = count
+		if m.pending != nil {
+			if pending, ok := m.pending(from); ok && pending > a.next {
+				a.next = pending
+			}
+		}
+		a.synced = true
+	case count >= a.next:
+		// the txs handed out are mined, or the account sent txs by other means
+		a.next = count
+	case count == a.count && now.Sub(a.moved) > m.gapTimeout && !m.awaiting(from, count):
+		// nothing was mined for a while and no tx from count on is pending: they are lost, fill the gap
+		a.next = count
+	}
+	if count != a.count {
+		a.count, a.moved = count, now
+	}
+
+	nonce := a.next
+	done := func(err error) {
+		defer a.mu.Unlock()
+		switch {
+		case err == nil:
+			if nonce == a.count {
+				a.moved = m.now()
+			}
+			a.next = nonce + 1
+		case isNonceError(err):
+			a.synced = false
+		}
+	}
+	return nonce, done, nil
+}
+
+// awaiting reports whether a tx of from with a nonce from count on is recorded as pending,
+// it may still be mined and must not be replaced by reusing its nonce
+func (m *nonceManager) awaiting(from common.Address, count uint64) bool {
+	if m.pending == nil {
+		return false
+	}
+	pending, ok := m.pending(from)
+	return ok && pending > count
+}
+
+// isNonceError tells if the node rejected a tx because of its nonce, or because a pending
+// tx already uses it
+func isNonceError(err error) bool {
+	e, ok := err.(*types.Error)
+	if !ok {
+		return false
+	}
+	data, ok := e.ErrorData().(*types.ErrorData)
+	if !ok {
+		return false
+	}
+	msg := strings.ToLower(data.UpstreamMessage)
+	for _, s := range []string{"nonce", "known transaction", "already known", "underpriced", "replacement"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// pendingNonce returns the nonce after the pending txs of from in the db
+func (dex *Dex) pendingNonce(from common.Address) (uint64, bool) {
+	txs, err := dex.dexDB.QueryPendingTxs(from)
+	if err != nil {
+		dex.Logger.Error("QueryPendingTxs fail", "from", from.Hex(), "err", err)
+		return 0, false
+	}
+	var next uint64
+	for _, ptx := range txs {
+		if ptx.Nonce.Valid && uint64(ptx.Nonce.Int64) >= next {
+			next = uint64(ptx.Nonce.Int64) + 1
+		}
+	}
+	return next, len(txs) > 0
+}
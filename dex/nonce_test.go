@@ -0,0 +1,110 @@
+package dex
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lianxiangcloud/linkchain/libs/common"
+	"github.com/lianxiangcloud/lkdex/types"
+)
+
+func TestNonceManagerConcurrent(t *testing.T) {
+	ctx := context.Background()
+	wallet := NewFakeWalletClient()
+	from := common.HexToAddress("0x01")
+	wallet.SetNonce(from, 5)
+	m := newNonceManager(wallet, nil)
+
+	var mu sync.Mutex
+	seen := make(map[uint64]bool)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			nonce, done, err := m.next(ctx, from)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			seen[nonce] = true
+			mu.Unlock()
+			done(nil)
+		}()
+	}
+	wg.Wait()
+	for nonce := uint64(5); nonce < 25; nonce++ {
+		if !seen[nonce] {
+			t.Fatalf("nonce %d not handed out, got %v", nonce, seen)
+		}
+	}
+}
+
+func TestNonceManagerResync(t *testing.T) {
+	ctx := context.Background()
+	wallet := NewFakeWalletClient()
+	from := common.HexToAddress("0x01")
+	wallet.SetNonce(from, 3)
+	now := time.Unix(1000, 0)
+	pending, tracked := uint64(5), true
+	m := newNonceManager(wallet, func(common.Address) (uint64, bool) { return pending, tracked })
+	m.now = func() time.Time { return now }
+
+	next := func(err error) uint64 {
+		nonce, done, e := m.next(ctx, from)
+		if e != nil {
+			t.Fatal(e)
+		}
+		done(err)
+		return nonce
+	}
+
+	// the pending txs are counted
+	if nonce := next(nil); nonce != 5 {
+		t.Fatalf("first nonce %d, want 5", nonce)
+	}
+	// a tx not sent gives its nonce back
+	if nonce := next(types.ErrNoConnectionToDaemon); nonce != 6 {
+		t.Fatalf("nonce %d, want 6", nonce)
+	}
+	if nonce := next(nil); nonce != 6 {
+		t.Fatalf("nonce %d of a tx not sent, want 6", nonce)
+	}
+	// a rejected nonce is read from the chain again
+	nonceErr := types.ErrDaemonResponse.WithData(&types.ErrorData{Method: "eth_sendRawTx", UpstreamMessage: "nonce too low"})
+	if nonce := next(nonceErr); nonce != 7 {
+		t.Fatalf("nonce %d, want 7", nonce)
+	}
+	wallet.SetNonce(from, 8)
+	if nonce := next(nil); nonce != 8 {
+		t.Fatalf("nonce %d after a nonce error, want 8", nonce)
+	}
+	pending = 9
+	// the chain does not advance: the gap is not filled while the txs are pending
+	now = now.Add(time.Minute)
+	if nonce := next(nil); nonce != 9 {
+		t.Fatalf("nonce %d, want 9", nonce)
+	}
+	pending = 10
+	now = now.Add(nonceGapTimeout + time.Second)
+	if nonce := next(nil); nonce != 10 {
+		t.Fatalf("nonce %d after the gap timeout with pending txs, want 10", nonce)
+	}
+	// the pending txs are dropped: the gap is filled
+	tracked = false
+	if nonce := next(nil); nonce != 8 {
+		t.Fatalf("nonce %d after the pending txs are dropped, want 8", nonce)
+	}
+	// a nonce used by a pending tx is read from the chain again
+	underpriced := types.ErrDaemonResponse.WithData(&types.ErrorData{Method: "eth_sendRawTx", UpstreamMessage: "replacement transaction underpriced"})
+	if nonce := next(underpriced); nonce != 9 {
+		t.Fatalf("nonce %d, want 9", nonce)
+	}
+	wallet.SetNonce(from, 11)
+	if nonce := next(nil); nonce != 11 {
+		t.Fatalf("nonce %d after a replacement error, want 11", nonce)
+	}
+}
@@ -0,0 +1,123 @@
+package dex
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/lianxiangcloud/linkchain/libs/common"
+	"github.com/lianxiangcloud/linkchain/libs/hexutil"
+	"github.com/lianxiangcloud/linkchain/rpc/rtypes"
+	"github.com/lianxiangcloud/lkdex/types"
+)
+
+// cancelPriceBump is the percent a cancel tx raises the gas price of the txs it replaces by
+const cancelPriceBump = 10
+
+// SpeedUpTx sends the pending tx hash again with the same nonce and payload at gasPrice, which
+// must be higher than the gas prices of the pending txs of the nonce. The new tx is recorded
+// as replacing hash, the txs of the nonce not mined are marked replaced once one is mined.
+func (dex *Dex) SpeedUpTx(ctx context.Context, hash common.Hash, gasPrice *big.Int) (common.Hash, error) {
+	ptx, price, err := dex.replaceableTx(hash)
+	if err != nil {
+		return common.EmptyHash, err
+	}
+	if gasPrice == nil || gasPrice.Cmp(price) <= 0 {
+		return common.EmptyHash, types.ArgsError("gasPrice must be higher than " + hexutil.EncodeBig(price))
+	}
+
+	to := common.HexToAddress(ptx.To)
+	data := hexutil.Bytes(ptx.Data)
+	tx := &rtypes.SendTxArgs{
+		From:         common.HexToAddress(ptx.From),
+		To:           &to,
+		TokenAddress: common.HexToAddress(ptx.TokenAddress),
+		GasPrice:     (*hexutil.Big)(gasPrice),
+	}
+	if len(data) > 0 {
+		tx.Data = &data
+	}
+	if ptx.Value != "" {
+		value, err := hexutil.DecodeBig(ptx.Value)
+		if err != nil {
+			return common.EmptyHash, types.ErrDBOrderError
+		}
+		tx.Value = (*hexutil.Big)(value)
+	}
+	return dex.postReplacementTx(ctx, ptx, tx, ptx.Intent)
+}
+
+// CancelTx replaces the pending tx hash with a zero-value transfer of its sender to itself with
+// the same nonce. The gas price is cancelPriceBump percent higher than those of the pending
+// txs of the nonce, or the price of the gas policy if that is higher.
+func (dex *Dex) CancelTx(ctx context.Context, hash common.Hash) (common.Hash, error) {
+	ptx, price, err := dex.replaceableTx(hash)
+	if err != nil {
+		return common.EmptyHash, err
+	}
+	price.Mul(price, big.NewInt(100+cancelPriceBump))
+	price.Add(price, big.NewInt(99))
+	price.Div(price, big.NewInt(100))
+	policy, err := dex.gasPrice(ctx, "")
+	if err != nil {
+		return common.EmptyHash, err
+	}
+	if policy.Cmp(price) > 0 {
+		price = policy
+	}
+
+	from := common.HexToAddress(ptx.From)
+	tx := &rtypes.SendTxArgs{
+		From:     from,
+		To:       &from,
+		Value:    (*hexutil.Big)(new(big.Int)),
+		GasPrice: (*hexutil.Big)(price),
+	}
+	return dex.postReplacementTx(ctx, ptx, tx, "cancelTx")
+}
+
+// replaceableTx returns the pending tx hash and the highest gas price of the pending txs of its nonce
+func (dex *Dex) replaceableTx(hash common.Hash) (*PendingTxModel, *big.Int, error) {
+	ptx, err := dex.dexDB.ReadPendingTx(hash)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ptx == nil {
+		return nil, nil, types.ErrTxNotFound
+	}
+	if ptx.State.Int64 != TxPending {
+		return nil, nil, types.ErrTxNotPending
+	}
+	// the records before the txs could be replaced lack the receiver
+	if !ptx.Nonce.Valid || ptx.To == "" {
+		return nil, nil, types.ArgsError("tx was recorded without the fields to replace it")
+	}
+
+	txs, err := dex.dexDB.QueryPendingTxsByNonce(common.HexToAddress(ptx.From), uint64(ptx.Nonce.Int64))
+	if err != nil {
+		return nil, nil, err
+	}
+	price := new(big.Int)
+	for _, t := range txs {
+		if p, err := hexutil.DecodeBig(t.GasPrice); err == nil && p.Cmp(price) > 0 {
+			price = p
+		}
+	}
+	return ptx, price, nil
+}
+
+// postReplacementTx sends tx with the nonce of ptx and records it as replacing ptx
+func (dex *Dex) postReplacementTx(ctx context.Context, ptx *PendingTxModel, tx *rtypes.SendTxArgs, intent string) (common.Hash, error) {
+	nonce := hexutil.Uint64(ptx.Nonce.Int64)
+	tx.Nonce = &nonce
+	dex.Logger.Debug("ReplaceTx", "hash", ptx.TxHash, "intent", intent, "TX", tx)
+
+	hash, err := dex.PostChainTx(ctx, tx)
+	if err != nil {
+		return common.EmptyHash, err
+	}
+	rtx := newPendingTx(hash, tx, common.HexToHash(ptx.OrderHash))
+	rtx.Intent = intent
+	rtx.Replaces = ptx.TxHash
+	dex.recordTx(rtx)
+	return hash, nil
+}
@@ -0,0 +1,130 @@
+package dex
+
+import (
+	"context"
+	"database/sql"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/lianxiangcloud/linkchain/libs/common"
+	"github.com/lianxiangcloud/linkchain/libs/crypto"
+	"github.com/lianxiangcloud/linkchain/libs/hexutil"
+	"github.com/lianxiangcloud/lkdex/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplaceTx(t *testing.T) {
+	db, err := connectDB("sqlite3", "file:replace?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.AutoMigrate(&OrderModel{}, &PendingTxModel{})
+	assert := assert.New(t)
+	ctx := context.Background()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, wallet := NewFakeChainClient(0), NewFakeWalletClient()
+	from := wallet.AddKey(key)
+	wallet.SetNonce(from, 3)
+	dex := newFakeDex(chain, wallet)
+	dex.dexDB = db
+
+	token := common.HexToAddress("0x95ccc08ab44ac6d071a0c5911df64ad2394a4c54")
+	hash, err := dex.DexWithDraw(ctx, from, token, (*hexutil.Big)(big.NewInt(1)))
+	assert.Nil(err)
+
+	_, err = dex.SpeedUpTx(ctx, hash, big.NewInt(1e11))
+	assert.Equal(types.CodeInvalidArgs, types.ErrorCode(err))
+	speedUp, err := dex.SpeedUpTx(ctx, hash, big.NewInt(2e11))
+	assert.Nil(err)
+	status, err := dex.GetTxStatus(speedUp)
+	assert.Nil(err)
+	assert.Equal("withdraw", status.Intent)
+	assert.Equal(hexutil.Uint64(3), status.Nonce)
+	assert.Equal(hash, *status.Replaces)
+	assert.Equal(big.NewInt(2e11), status.GasPrice.ToInt())
+
+	cancel, err := dex.CancelTx(ctx, hash)
+	assert.Nil(err)
+	signed := wallet.Signed()
+	last := signed[len(signed)-1]
+	assert.Equal(from, *last.To)
+	assert.Equal(hexutil.Uint64(3), *last.Nonce)
+	assert.Equal(big.NewInt(22e10), last.GasPrice.ToInt())
+	assert.Nil(last.Data)
+
+	pending, err := dex.ListPendingTxs(from)
+	assert.Nil(err)
+	assert.Equal(3, len(pending))
+
+	chain.SetReceipt(speedUp, &TxReceipt{BlockNumber: 5, Status: 1})
+	settled, err := dex.Reconcile(ctx)
+	assert.Nil(err)
+	assert.Equal(1, settled)
+	for h, want := range map[common.Hash]string{hash: "replaced", speedUp: "success", cancel: "replaced"} {
+		status, err := dex.GetTxStatus(h)
+		assert.Nil(err)
+		assert.Equal(want, status.Status, h.Hex())
+	}
+
+	_, err = dex.CancelTx(ctx, hash)
+	assert.Equal(types.ErrTxNotPending, err)
+	_, err = dex.CancelTx(ctx, common.HexToHash("0x01"))
+	assert.Equal(types.ErrTxNotFound, err)
+}
+
+func TestCheckPendingTxs(t *testing.T) {
+	db, err := connectDB("sqlite3", "file:pendingtxs?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.AutoMigrate(&OrderModel{}, &PendingTxModel{})
+	assert := assert.New(t)
+	chain, wallet := NewFakeChainClient(0), NewFakeWalletClient()
+	dex := newFakeDex(chain, wallet)
+	dex.dexDB = db
+
+	from := common.HexToAddress("0xa73810e519e1075010678d706533486d8ecc8000")
+	broken, mined, fresh, lost := common.HexToHash("0x21"), common.HexToHash("0x22"), common.HexToHash("0x23"), common.HexToHash("0x24")
+	withdrawTx := func(hash common.Hash, nonce int64, sent time.Time) *PendingTxModel {
+		ptx := &PendingTxModel{
+			TxHash: hash.Hex(),
+			From:   from.Hex(),
+			Intent: "withdraw",
+			Nonce:  sql.NullInt64{Int64: nonce, Valid: true},
+			Data:   "withdraw",
+			State:  sql.NullInt64{Int64: TxPending, Valid: true},
+		}
+		ptx.CreatedAt = sent
+		return ptx
+	}
+	db.Create(withdrawTx(broken, 1, time.Now()))
+	db.Create(withdrawTx(mined, 2, time.Now()))
+	db.Create(withdrawTx(fresh, 3, time.Now()))
+	db.Create(withdrawTx(lost, 4, time.Now().Add(-time.Hour)))
+
+	//a receipt error of one tx does not stop the others from being checked
+	chain.ReceiptErr = func(hash common.Hash) error {
+		if hash == broken {
+			return types.ErrNoConnectionToDaemon
+		}
+		return nil
+	}
+	chain.SetReceipt(mined, &TxReceipt{BlockNumber: 5, Status: 1})
+	settled, err := dex.Reconcile(context.Background())
+	assert.Nil(err)
+	assert.Equal(1, settled)
+	for h, want := range map[common.Hash]string{broken: "pending", mined: "success", fresh: "pending", lost: "dropped"} {
+		status, err := dex.GetTxStatus(h)
+		assert.Nil(err)
+		assert.Equal(want, status.Status, h.Hex())
+	}
+
+	//the error is returned when no receipt could be read
+	chain.Err = types.ErrNoConnectionToDaemon
+	_, err = dex.Reconcile(context.Background())
+	assert.Equal(types.ErrNoConnectionToDaemon, err)
+}
@@ -0,0 +1,179 @@
+package dex
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"io/ioutil"
+	"math/big"
+	"sync"
+
+	"github.com/lianxiangcloud/linkchain/accounts/keystore"
+	"github.com/lianxiangcloud/linkchain/libs/common"
+	"github.com/lianxiangcloud/linkchain/libs/crypto"
+	"github.com/lianxiangcloud/linkchain/libs/hexutil"
+	"github.com/lianxiangcloud/linkchain/libs/ser"
+	"github.com/lianxiangcloud/linkchain/rpc/rtypes"
+	lktypes "github.com/lianxiangcloud/linkchain/types"
+	wtypes "github.com/lianxiangcloud/linkchain/wallet/types"
+	"github.com/lianxiangcloud/lkdex/config"
+	"github.com/lianxiangcloud/lkdex/types"
+)
+
+// Signer signs the orders and the txs of its accounts
+type Signer interface {
+	// SignHash signs hash with the key of addr, the signature is in the [R || S || V] format where V is 0 or 1
+	SignHash(ctx context.Context, addr common.Address, hash common.Hash) (hexutil.Bytes, error)
+	// SignTx signs the tx of args with the key of args.From, gas, gasPrice and nonce must be set
+	SignTx(ctx context.Context, args *rtypes.SendTxArgs) (*rtypes.SignTransactionResult, error)
+}
+
+// WithSigner makes the Dex sign with signer instead of the wallet. Unless a wallet
+// client is set too, the nonces, the gas and the status are then read from the chain.
+func WithSigner(signer Signer) DexOption {
+	return func(dex *Dex) {
+		dex.signer = signer
+	}
+}
+
+// KeystoreSigner is a Signer holding the decrypted keys of keystore files
+type KeystoreSigner struct {
+	mu   sync.RWMutex
+	keys map[common.Address]*ecdsa.PrivateKey
+}
+
+// NewKeystoreSigner returns a KeystoreSigner without keys
+func NewKeystoreSigner() *KeystoreSigner {
+	return &KeystoreSigner{keys: make(map[common.Address]*ecdsa.PrivateKey)}
+}
+
+// LoadKeystoreSigner returns a KeystoreSigner with the key of the keystore file of cfg,
+// decrypted with cfg.KeystorePassword
+func LoadKeystoreSigner(cfg config.BaseConfig) (*KeystoreSigner, error) {
+	keyjson, err := ioutil.ReadFile(cfg.KeystoreFilePath())
+	if err != nil {
+		return nil, err
+	}
+	password, err := cfg.KeystorePassword()
+	if err != nil {
+		return nil, err
+	}
+	s := NewKeystoreSigner()
+	if _, err := s.AddKeyJSON(keyjson, password); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// AddKeyJSON decrypts the keystore keyjson with password and adds its key
+func (s *KeystoreSigner) AddKeyJSON(keyjson []byte, password string) (common.Address, error) {
+	key, err := keystore.DecryptKey(keyjson, password)
+	if err != nil {
+		return common.EmptyAddress, err
+	}
+	return s.AddKey(key.PrivateKey), nil
+}
+
+// AddKey adds key and returns its address
+func (s *KeystoreSigner) AddKey(key *ecdsa.PrivateKey) common.Address {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+	s.keys[addr] = key
+	return addr
+}
+
+// Accounts returns the addresses of the keys
+func (s *KeystoreSigner) Accounts() []common.Address {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	addrs := make([]common.Address, 0, len(s.keys))
+	for addr := range s.keys {
+		addrs = append(addrs, addr)
+	}
+	return addrs
+}
+
+func (s *KeystoreSigner) key(addr common.Address) (*ecdsa.PrivateKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.keys[addr]
+	if !ok {
+		return nil, types.ErrUnknownAccount.WithData(&types.ErrorData{UpstreamMessage: addr.Hex()})
+	}
+	return key, nil
+}
+
+func (s *KeystoreSigner) SignHash(ctx context.Context, addr common.Address, hash common.Hash) (hexutil.Bytes, error) {
+	key, err := s.key(addr)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.Sign(hash.Bytes(), key)
+}
+
+// SignTx signs the tx of args with the sign param of the chain, like the wallet does
+func (s *KeystoreSigner) SignTx(ctx context.Context, args *rtypes.SendTxArgs) (*rtypes.SignTransactionResult, error) {
+	if args.Gas == nil || args.GasPrice == nil || args.Nonce == nil {
+		return nil, types.ArgsError("gas, gasPrice and nonce of the tx must be set")
+	}
+	if args.TokenAddress != common.EmptyAddress && args.To == nil {
+		return nil, types.ArgsError("to of a token tx must be set")
+	}
+	key, err := s.key(args.From)
+	if err != nil {
+		return nil, err
+	}
+	send := *args
+	if send.Value == nil {
+		send.Value = (*hexutil.Big)(new(big.Int))
+	}
+	tx := send.ToTransaction()
+	stx, ok := tx.(interface {
+		Sign(signer lktypes.STDSigner, prv *ecdsa.PrivateKey) error
+	})
+	if !ok {
+		return nil, types.ArgsError("tx type can not be signed")
+	}
+	if err := stx.Sign(lktypes.NewSTDEIP155Signer(lktypes.SignParam), key); err != nil {
+		return nil, err
+	}
+	raw, err := ser.EncodeToBytes(tx)
+	if err != nil {
+		return nil, err
+	}
+	return &rtypes.SignTransactionResult{Raw: raw, Tx: tx}, nil
+}
+
+// signerWallet is the WalletClient of a local Signer, the other calls go to the chain
+type signerWallet struct {
+	Signer
+	chain ChainClient
+}
+
+// NewSignerWallet returns the WalletClient signing with signer and calling chain
+// for the nonces, the gas and the txs
+func NewSignerWallet(signer Signer, chain ChainClient) WalletClient {
+	return &signerWallet{Signer: signer, chain: chain}
+}
+
+func (w *signerWallet) SendRawTransaction(ctx context.Context, b hexutil.Bytes) (common.Hash, error) {
+	return w.chain.SendRawTx(ctx, b, lktypes.TxNormal)
+}
+
+func (w *signerWallet) GetTransactionCount(ctx context.Context, addr common.Address) (uint64, error) {
+	return w.chain.GetTransactionCount(ctx, addr)
+}
+
+func (w *signerWallet) EstimateGas(ctx context.Context, args *rtypes.SendTxArgs) (hexutil.Uint64, error) {
+	return w.chain.EstimateGas(ctx, args)
+}
+
+// Status returns an empty status, there is no wallet process to check
+func (w *signerWallet) Status(ctx context.Context) (*wtypes.StatusResult, error) {
+	return &wtypes.StatusResult{}, nil
+}
+
+var (
+	_ Signer       = (*KeystoreSigner)(nil)
+	_ WalletClient = (*signerWallet)(nil)
+)
@@ -0,0 +1,79 @@
+package dex
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/lianxiangcloud/linkchain/accounts/keystore"
+	"github.com/lianxiangcloud/linkchain/libs/common"
+	"github.com/lianxiangcloud/linkchain/libs/crypto"
+	"github.com/lianxiangcloud/linkchain/libs/hexutil"
+	"github.com/lianxiangcloud/linkchain/rpc/rtypes"
+	lktypes "github.com/lianxiangcloud/linkchain/types"
+	"github.com/lianxiangcloud/lkdex/types"
+)
+
+func TestKeystoreSigner(t *testing.T) {
+	ctx := context.Background()
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+	keyjson, err := keystore.EncryptKey(&keystore.Key{Address: addr, PrivateKey: key}, "secret", keystore.LightScryptN, keystore.LightScryptP, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer := NewKeystoreSigner()
+	if _, err := signer.AddKeyJSON(keyjson, "wrong"); err == nil {
+		t.Fatal("key decrypted with a wrong password")
+	}
+	if a, err := signer.AddKeyJSON(keyjson, "secret"); err != nil || a != addr {
+		t.Fatalf("AddKeyJSON %s %v", a.Hex(), err)
+	}
+
+	hash := common.HexToHash("0x6c554f11cc33de44e2687e6539c27d9fad08db76803f92008d7cfcea55ad597a")
+	sig, err := signer.SignHash(ctx, addr, hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := crypto.SigToPub(hash.Bytes(), sig)
+	if err != nil || crypto.PubkeyToAddress(*pub) != addr {
+		t.Fatalf("SignHash signature of %v", err)
+	}
+	if _, err := signer.SignHash(ctx, user1, hash); types.ErrorCode(err) != types.CodeUnknownAccount {
+		t.Fatalf("SignHash of an unknown account: %v", err)
+	}
+
+	// a Dex signing with the keystore reads the nonce and the gas from the chain
+	chain := NewFakeChainClient(0)
+	chain.SetNonce(addr, 3)
+	dex := newFakeDex(chain, NewSignerWallet(signer, chain))
+	dex.signer = signer
+
+	to := common.HexToAddress(dex.config.ContractAddr)
+	if _, err := dex.PostChainTx(ctx, &rtypes.SendTxArgs{From: addr, To: &to}); err != nil {
+		t.Fatal(err)
+	}
+	if len(chain.Sent()) != 1 {
+		t.Fatalf("sent %d txs", len(chain.Sent()))
+	}
+
+	if _, err := signer.SignTx(ctx, &rtypes.SendTxArgs{From: addr, To: &to}); err == nil {
+		t.Fatal("SignTx without gas, gasPrice and nonce")
+	}
+	nonce, gas := uint64(3), uint64(21000)
+	result, err := signer.SignTx(ctx, &rtypes.SendTxArgs{From: addr, To: &to, Nonce: (*hexutil.Uint64)(&nonce), Gas: (*hexutil.Uint64)(&gas), GasPrice: (*hexutil.Big)(big.NewInt(1e11))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := result.Tx.(*lktypes.Transaction)
+	if from, err := tx.Sender(lktypes.NewSTDEIP155Signer(lktypes.SignParam)); err != nil || from != addr || tx.Nonce() != 3 {
+		t.Fatalf("signed tx from %s nonce %d: %v", from.Hex(), tx.Nonce(), err)
+	}
+	if len(result.Raw) == 0 {
+		t.Fatal("no raw tx")
+	}
+}
@@ -0,0 +1,83 @@
+package dex
+
+import (
+	"context"
+	"time"
+
+	"github.com/lianxiangcloud/linkchain/libs/hexutil"
+	"github.com/lianxiangcloud/lkdex/types"
+)
+
+// maxIndexedAge is the time the logs may go unindexed while the node is ready,
+// the subscription reads them up to the chain head every catchUpInterval.
+const maxIndexedAge = time.Minute
+
+// SyncStatus is the indexing status of the dex and the reachability of the daemons
+type SyncStatus struct {
+	ChainHead             hexutil.Uint64 `json:"chainHead"`             // head of the chain, 0 if the daemon is unreachable
+	SyncHeight            hexutil.Uint64 `json:"syncHeight"`            // the logs are indexed up to this block
+	Lag                   hexutil.Uint64 `json:"lag"`                   // blocks between ChainHead and SyncHeight
+	IndexedAgo            hexutil.Uint64 `json:"indexedAgo"`            // seconds since a log was last indexed or the logs were last read up to the chain head
+	Subscribed            bool           `json:"subscribed"`            // the log subscription is connected
+	Paused                bool           `json:"paused"`                // indexing is paused by admin_pauseIndexing
+	DaemonReachable       bool           `json:"daemonReachable"`       // the chain daemon answers
+	WalletDaemonReachable bool           `json:"walletDaemonReachable"` // the wallet daemon answers
+	Ready                 bool           `json:"ready"`                 // the chain daemon answers, the subscription is connected, Lag is at most config.MaxSyncLag and IndexedAgo at most maxIndexedAge
+}
+
+// SyncStatus queries the chain head and the wallet daemon and returns the sync status
+func (dex *Dex) SyncStatus(ctx context.Context) *SyncStatus {
+	status := &SyncStatus{Subscribed: dex.dexSub.Live(), Paused: dex.dexSub.Paused()}
+
+	height := dex.dexSub.Height()
+	if header, err := dex.chain.GetBlockByNumber(ctx, "latest"); err != nil {
+		dex.Logger.Debug("SyncStatus", "err", err)
+	} else {
+		head := header.Number.ToInt().Uint64()
+		status.DaemonReachable = true
+		status.ChainHead = hexutil.Uint64(head)
+		if head > height {
+			status.Lag = hexutil.Uint64(head - height)
+		}
+	}
+	status.SyncHeight = hexutil.Uint64(height)
+	indexedAgo := time.Since(dex.dexSub.LastIndexed())
+	status.IndexedAgo = hexutil.Uint64(indexedAgo / time.Second)
+
+	if _, err := dex.wallet.Status(ctx); err != nil {
+		dex.Logger.Debug("SyncStatus", "err", err)
+	} else {
+		status.WalletDaemonReachable = true
+	}
+
+	status.Ready = status.DaemonReachable && status.Subscribed && uint64(status.Lag) <= dex.config.MaxSyncLag && indexedAgo <= maxIndexedAge
+	return status
+}
+
+// PauseIndexing stops indexing the contract logs until ResumeIndexing
+func (dex *Dex) PauseIndexing() {
+	dex.dexSub.Pause()
+}
+
+// ResumeIndexing indexes the contract logs again from the indexed height
+func (dex *Dex) ResumeIndexing() {
+	dex.dexSub.Resume()
+}
+
+// IndexingPaused reports whether indexing was stopped by PauseIndexing
+func (dex *Dex) IndexingPaused() bool {
+	return dex.dexSub.Paused()
+}
+
+// Resync indexes the contract logs again from block from, which must not be above the chain head
+func (dex *Dex) Resync(ctx context.Context, from uint64) error {
+	header, err := dex.chain.GetBlockByNumber(ctx, "latest")
+	if err != nil {
+		return err
+	}
+	if head := header.Number.ToInt().Uint64(); from > head {
+		return types.ArgsError("resync block is above the chain head")
+	}
+	dex.dexSub.Resync(from)
+	return nil
+}
@@ -0,0 +1,49 @@
+package dex
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lianxiangcloud/linkchain/libs/hexutil"
+	"github.com/lianxiangcloud/linkchain/libs/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncStatus(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	chain, wallet := NewFakeChainClient(0), NewFakeWalletClient()
+	dex := newFakeDex(chain, wallet)
+	dex.dexSub = &DexSubscription{chain: chain, logger: log.NewNopLogger(), metrics: NopMetrics()}
+	dex.dexSub.indexed(40)
+	dex.dexSub.setLive(true)
+
+	chain.SetHead(45, 1000)
+	status := dex.SyncStatus(ctx)
+	assert.True(status.Ready)
+	assert.Equal(hexutil.Uint64(5), status.Lag)
+	assert.Equal(hexutil.Uint64(0), status.IndexedAgo)
+
+	//the status does not move the indexed height
+	chain.SetHead(60, 1100)
+	status = dex.SyncStatus(ctx)
+	assert.False(status.Ready)
+	assert.Equal(hexutil.Uint64(40), status.SyncHeight)
+	assert.Equal(hexutil.Uint64(20), status.Lag)
+	assert.Equal(uint64(40), dex.dexSub.Height())
+
+	//the logs are not indexed any more
+	dex.dexSub.indexed(60)
+	dex.dexSub.mu.Lock()
+	dex.dexSub.lastIndexed = time.Now().Add(-2 * maxIndexedAge)
+	dex.dexSub.mu.Unlock()
+	status = dex.SyncStatus(ctx)
+	assert.False(status.Ready)
+	assert.Equal(hexutil.Uint64(0), status.Lag)
+	assert.Equal(hexutil.Uint64(2*maxIndexedAge/time.Second), status.IndexedAgo)
+
+	dex.dexSub.setLive(false)
+	dex.dexSub.indexed(60)
+	assert.False(dex.SyncStatus(ctx).Ready)
+}
@@ -0,0 +1,353 @@
+package dex
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/lianxiangcloud/linkchain/libs/common"
+	"github.com/lianxiangcloud/linkchain/libs/hexutil"
+	"github.com/lianxiangcloud/linkchain/rpc/rtypes"
+	"github.com/lianxiangcloud/lkdex/types"
+)
+
+const (
+	txPollInterval = 5 * time.Second
+	// sendingOrderTimeout is how long an order stays Sending after its postOrder tx was
+	// sent, the tx was dropped by the node if it is not mined by then
+	sendingOrderTimeout = 30 * time.Minute
+	// pendingTxTimeout is how long a tx is polled for its receipt before it is taken as dropped
+	pendingTxTimeout = sendingOrderTimeout
+)
+
+// callArgs is the argument object of a contract call, see Args1, Args2
+type callArgs struct {
+	A0 json.RawMessage `json:"0"`
+	A1 json.RawMessage `json:"1"`
+}
+
+// splitCallData splits contract call data "method|args" into method and args
+func splitCallData(data []byte) (string, *callArgs) {
+	parts := strings.SplitN(string(data), "|", 2)
+	args := &callArgs{}
+	if len(parts) == 2 {
+		json.Unmarshal([]byte(parts[1]), args)
+	}
+	return parts[0], args
+}
+
+// postTrackedTx sends tx and records it as pending, the receipt is checked by txLoop
+func (dex *Dex) postTrackedTx(ctx context.Context, tx *rtypes.SendTxArgs, orderHash common.Hash) (common.Hash, error) {
+	hash, err := dex.PostChainTx(ctx, tx)
+	if err != nil {
+		return common.EmptyHash, err
+	}
+	dex.recordTx(newPendingTx(hash, tx, orderHash))
+	return hash, nil
+}
+
+// newPendingTx returns the pending record of the sent tx hash
+func newPendingTx(hash common.Hash, tx *rtypes.SendTxArgs, orderHash common.Hash) *PendingTxModel {
+	var data []byte
+	if tx.Data != nil {
+		data = *tx.Data
+	}
+	intent, _ := splitCallData(data)
+	ptx := &PendingTxModel{
+		TxHash: hash.Hex(),
+		From:   tx.From.Hex(),
+		Intent: intent,
+		Data:   string(data),
+		State:  sql.NullInt64{Int64: TxPending, Valid: true},
+	}
+	if orderHash != common.EmptyHash {
+		ptx.OrderHash = orderHash.Hex()
+	}
+	if tx.Nonce != nil {
+		ptx.Nonce = sql.NullInt64{Int64: int64(*tx.Nonce), Valid: true}
+	}
+	if tx.To != nil {
+		ptx.To = tx.To.Hex()
+	}
+	if tx.TokenAddress != common.EmptyAddress {
+		ptx.TokenAddress = tx.TokenAddress.Hex()
+	}
+	if tx.Value != nil {
+		ptx.Value = tx.Value.String()
+	}
+	if tx.GasPrice != nil {
+		ptx.GasPrice = tx.GasPrice.String()
+	}
+	return ptx
+}
+
+// recordTx saves the record of a sent tx
+func (dex *Dex) recordTx(ptx *PendingTxModel) {
+	// the tx is sent already, a record failure must not fail the request
+	if err := dex.dexDB.CreatePendingTx(ptx); err != nil {
+		dex.Logger.Error("CreatePendingTx fail", "hash", ptx.TxHash, "err", err)
+	}
+}
+
+// txLoop polls the receipts of pending txs until Stop
+func (dex *Dex) txLoop() {
+	ticker := time.NewTicker(txPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			dex.checkPendingTxs(dex.ctx)
+		case <-dex.quit:
+			return
+		}
+	}
+}
+
+// Reconcile checks the receipts of the pending txs now, like txLoop does periodically.
+// It returns the number of txs found in a block.
+func (dex *Dex) Reconcile(ctx context.Context) (int, error) {
+	return dex.checkPendingTxs(ctx)
+}
+
+func (dex *Dex) checkPendingTxs(ctx context.Context) (int, error) {
+	dex.txMu.Lock()
+	defer dex.txMu.Unlock()
+
+	txs, err := dex.dexDB.QueryPendingTxs(common.EmptyAddress)
+	if err != nil {
+		dex.Logger.Error("QueryPendingTxs fail", "err", err)
+		return 0, err
+	}
+	settled, failed := 0, 0
+	var lastErr error
+	for _, ptx := range txs {
+		receipt, err := dex.chain.GetTransactionReceipt(ctx, common.HexToHash(ptx.TxHash))
+		if err != nil {
+			// the other txs are checked, this one again on the next poll
+			dex.Logger.Debug("GetTransactionReceipt fail", "hash", ptx.TxHash, "err", err)
+			failed, lastErr = failed+1, err
+			continue
+		}
+		if receipt == nil {
+			dex.dropExpiredTx(ptx)
+			continue
+		}
+		settled++
+
+		ptx.BlockNum = sql.NullInt64{Int64: int64(receipt.BlockNumber), Valid: true}
+		if receipt.Status == 1 {
+			ptx.State.Int64 = TxSuccess
+		} else {
+			ptx.State.Int64 = TxFailed
+			ptx.Reason = dex.revertReason(ctx, ptx, receipt)
+			dex.Logger.Info("Tx failed", "hash", ptx.TxHash, "intent", ptx.Intent, "reason", ptx.Reason)
+			if ptx.Intent == "postOrder" && ptx.OrderHash != "" {
+				dex.dropSendingOrder(common.HexToHash(ptx.OrderHash))
+			}
+		}
+		if err := dex.dexDB.UpdatePendingTx(ptx); err != nil {
+			dex.Logger.Error("UpdatePendingTx fail", "hash", ptx.TxHash, "err", err)
+		}
+		dex.settleReplaced(ptx)
+	}
+	dex.dropStaleSendingOrders()
+	if failed > 0 && failed == len(txs) {
+		return 0, lastErr
+	}
+	return settled, nil
+}
+
+// dropExpiredTx marks the pending tx ptx dropped if it was sent more than pendingTxTimeout
+// ago, it is not polled any more. Its nonce is handed out again by the nonce manager.
+func (dex *Dex) dropExpiredTx(ptx *PendingTxModel) {
+	if time.Since(ptx.CreatedAt) <= pendingTxTimeout {
+		return
+	}
+	ptx.State.Int64 = TxDropped
+	ptx.Reason = "not mined within " + pendingTxTimeout.String()
+	dex.Logger.Info("Tx dropped", "hash", ptx.TxHash, "intent", ptx.Intent)
+	if err := dex.dexDB.UpdatePendingTx(ptx); err != nil {
+		dex.Logger.Error("UpdatePendingTx fail", "hash", ptx.TxHash, "err", err)
+	}
+}
+
+// settleReplaced marks the other pending txs with the nonce of the mined tx ptx as replaced,
+// they are never mined. The order of a replaced postOrder tx never reaches the chain then,
+// unless ptx posts it too.
+func (dex *Dex) settleReplaced(ptx *PendingTxModel) {
+	if !ptx.Nonce.Valid {
+		return
+	}
+	txs, err := dex.dexDB.QueryPendingTxsByNonce(common.HexToAddress(ptx.From), uint64(ptx.Nonce.Int64))
+	if err != nil {
+		dex.Logger.Error("QueryPendingTxsByNonce fail", "from", ptx.From, "nonce", ptx.Nonce.Int64, "err", err)
+		return
+	}
+	for _, other := range txs {
+		if other.TxHash == ptx.TxHash {
+			continue
+		}
+		other.State.Int64 = TxReplaced
+		other.Reason = "replaced by " + ptx.TxHash
+		dex.Logger.Info("Tx replaced", "hash", other.TxHash, "by", ptx.TxHash)
+		if other.Intent == "postOrder" && other.OrderHash != "" && other.OrderHash != ptx.OrderHash {
+			dex.dropSendingOrder(common.HexToHash(other.OrderHash))
+		}
+		if err := dex.dexDB.UpdatePendingTx(other); err != nil {
+			dex.Logger.Error("UpdatePendingTx fail", "hash", other.TxHash, "err", err)
+		}
+	}
+}
+
+// dropSendingOrder removes an order whose postOrder tx failed and which never reached the chain
+func (dex *Dex) dropSendingOrder(hash common.Hash) {
+	model, err := dex.dexDB.ReadOrderModel(hash)
+	if err != nil || model == nil || model.State.Int64 != Sending {
+		return
+	}
+	if err := dex.dexDB.DeleteOrder(hash); err != nil {
+		dex.Logger.Error("DeleteOrder fail", "hash", hash.Hex(), "err", err)
+	}
+}
+
+// dropStaleSendingOrders removes the Sending orders whose postOrder tx was neither mined nor
+// failed within sendingOrderTimeout. The Order event indexes the order again if the tx is mined later.
+func (dex *Dex) dropStaleSendingOrders() {
+	hashes, err := dex.dexDB.QueryStaleSendingOrders(time.Now().Add(-sendingOrderTimeout))
+	if err != nil {
+		dex.Logger.Error("QueryStaleSendingOrders fail", "err", err)
+		return
+	}
+	for _, hash := range hashes {
+		dex.Logger.Info("Drop stale sending order", "hash", hash.Hex())
+		if err := dex.dexDB.DeleteOrder(hash); err != nil {
+			dex.Logger.Error("DeleteOrder fail", "hash", hash.Hex(), "err", err)
+		}
+	}
+}
+
+// revertReason explains a failed tx. The node only reports a generic vm error,
+// so the contract checks of the intent are replayed against the current state.
+func (dex *Dex) revertReason(ctx context.Context, ptx *PendingTxModel, receipt *TxReceipt) string {
+	reason := receipt.VMErr
+	if reason == "" {
+		reason = "transaction failed"
+	}
+
+	_, args := splitCallData([]byte(ptx.Data))
+	from := common.HexToAddress(ptx.From)
+	var detail string
+	switch ptx.Intent {
+	case "postOrder", "cancelOrder":
+		var order types.SignOrder
+		if json.Unmarshal(args.A0, &order) != nil {
+			break
+		}
+		header, err := dex.chain.GetBlockByNumber(ctx, hexutil.EncodeUint64(uint64(receipt.BlockNumber)))
+		if err != nil {
+			break
+		}
+		if err := CheckSignOrder(&order, header.Time.ToInt().Uint64()); err != nil {
+			detail = err.Error()
+		} else if err := dex.checkOrderState(&order, ptx.Intent == "postOrder"); err != nil {
+			detail = err.Error()
+		}
+	case "trade":
+		var order types.SignOrder
+		var amount hexutil.Big
+		if json.Unmarshal(args.A0, &order) != nil || json.Unmarshal(args.A1, &amount) != nil {
+			break
+		}
+		ret, err := dex.DexTestTakerTrade(ctx, &order.Order, from, amount.ToInt())
+		if err == nil && strings.HasPrefix(ret, "fail") {
+			detail = ret
+		}
+	case "withdraw":
+		var token common.Address
+		var amount hexutil.Big
+		if json.Unmarshal(args.A0, &token) != nil || json.Unmarshal(args.A1, &amount) != nil {
+			break
+		}
+		deposit, err := dex.DexGetDepositAmount(ctx, &from, &token)
+		if err == nil && deposit.Cmp(amount.ToInt()) < 0 {
+			detail = "Insufficient balance"
+		}
+	}
+	if detail != "" {
+		reason = reason + ": " + detail
+	}
+	return reason
+}
+
+// TxStatus is the tracked state of a tx sent by the wallet api
+type TxStatus struct {
+	TxHash    common.Hash     `json:"txHash"`
+	From      common.Address  `json:"from"`
+	Intent    string          `json:"intent"`
+	OrderHash *common.Hash    `json:"orderHash,omitempty"`
+	Nonce     hexutil.Uint64  `json:"nonce"`
+	GasPrice  *hexutil.Big    `json:"gasPrice,omitempty"`
+	Status    string          `json:"status"`
+	BlockNum  *hexutil.Uint64 `json:"blockNumber,omitempty"`
+	Reason    string          `json:"reason,omitempty"`
+	Replaces  *common.Hash    `json:"replaces,omitempty"` // tx replaced by this speed-up or cancel tx
+}
+
+var txStateNames = map[int64]string{
+	TxPending:  "pending",
+	TxSuccess:  "success",
+	TxFailed:   "failed",
+	TxReplaced: "replaced",
+	TxDropped:  "dropped",
+}
+
+func (t *PendingTxModel) ToTxStatus() *TxStatus {
+	status := &TxStatus{
+		TxHash: common.HexToHash(t.TxHash),
+		From:   common.HexToAddress(t.From),
+		Intent: t.Intent,
+		Nonce:  hexutil.Uint64(t.Nonce.Int64),
+		Status: txStateNames[t.State.Int64],
+		Reason: t.Reason,
+	}
+	if t.OrderHash != "" {
+		hash := common.HexToHash(t.OrderHash)
+		status.OrderHash = &hash
+	}
+	if t.BlockNum.Valid {
+		num := hexutil.Uint64(t.BlockNum.Int64)
+		status.BlockNum = &num
+	}
+	if price, err := hexutil.DecodeBig(t.GasPrice); err == nil {
+		status.GasPrice = (*hexutil.Big)(price)
+	}
+	if t.Replaces != "" {
+		hash := common.HexToHash(t.Replaces)
+		status.Replaces = &hash
+	}
+	return status
+}
+
+// GetTxStatus returns the tracked state of tx hash, nil if the tx was not sent by dex
+func (dex *Dex) GetTxStatus(hash common.Hash) (*TxStatus, error) {
+	ptx, err := dex.dexDB.ReadPendingTx(hash)
+	if err != nil || ptx == nil {
+		return nil, err
+	}
+	return ptx.ToTxStatus(), nil
+}
+
+// ListPendingTxs returns the txs of from still waiting for a receipt
+func (dex *Dex) ListPendingTxs(from common.Address) ([]*TxStatus, error) {
+	txs, err := dex.dexDB.QueryPendingTxs(from)
+	if err != nil {
+		return nil, err
+	}
+	rets := make([]*TxStatus, 0, len(txs))
+	for _, ptx := range txs {
+		rets = append(rets, ptx.ToTxStatus())
+	}
+	return rets, nil
+}
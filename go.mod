@@ -9,15 +9,18 @@ replace (
 )
 
 require (
-	github.com/bouk/monkey v1.0.1
+	github.com/go-kit/kit v0.8.0
 	github.com/golang/mock v1.3.1
 	github.com/jinzhu/gorm v1.9.11
 	github.com/lianxiangcloud/linkchain v0.1.2
 	github.com/mattn/go-sqlite3 v1.11.0
+	github.com/prometheus/client_golang v1.0.0
+	github.com/rs/cors v1.6.0
 	github.com/smartystreets/goconvey v0.0.0-20190731233626-505e41936337
 	github.com/spf13/cobra v0.0.5
 	github.com/spf13/viper v1.4.0
 	github.com/stretchr/testify v1.3.0
 	github.com/xunleichain/tc-wasm v0.3.5
-	gopkg.in/h2non/gock.v1 v1.0.15
+	golang.org/x/net v0.0.0-20190628185345-da137c7871d7
+	gopkg.in/natefinch/npipe.v2 v2.0.0-20160621034901-c1b8fa8bdcce
 )
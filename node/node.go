@@ -1,7 +1,11 @@
 package node
 
 import (
+	"context"
+	"net"
+	"net/http"
 	"path/filepath"
+	"time"
 
 	"github.com/jinzhu/gorm"
 	cfg "github.com/lianxiangcloud/lkdex/config"
@@ -11,6 +15,7 @@ import (
 	cmn "github.com/lianxiangcloud/linkchain/libs/common"
 	"github.com/lianxiangcloud/linkchain/libs/log"
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // DBContext specifies config information for loading a new DB.
@@ -34,16 +39,32 @@ func DefaultSQLDBProvider(ctx *DBContext) (*dex.SQLDBBackend, error) {
 
 func NewSQLDB(ID string, dbdir string, contractAddr string) (*dex.SQLDBBackend, error) {
 	//	fmt.Println(filepath.Join(dbdir, ID+contractAddr+".db"))
-	db, err := gorm.Open("sqlite3", filepath.Join(dbdir, ID+contractAddr+".db"))
+	path := filepath.Join(dbdir, ID+contractAddr+".db")
+	db, err := gorm.Open("sqlite3", path)
 	if err != nil {
 		return nil, err
 	}
 	return &dex.SQLDBBackend{
-		DB: *db,
+		DB:   *db,
+		Path: path,
 	}, nil
 
 }
 
+// MetricsProvider returns the rpc, dex and daemon Metrics.
+type MetricsProvider func(namespace string) (*rpc.Metrics, *dex.Metrics, *daemon.Metrics)
+
+// DefaultMetricsProvider returns rpc, dex and daemon Metrics build
+// using Prometheus client library.
+func DefaultMetricsProvider(namespace string) (*rpc.Metrics, *dex.Metrics, *daemon.Metrics) {
+	return rpc.PrometheusMetrics(namespace), dex.PrometheusMetrics(namespace), daemon.PrometheusMetrics(namespace)
+}
+
+// NopMetricsProvider returns rpc, dex and daemon Metrics as no-op.
+func NopMetricsProvider(namespace string) (*rpc.Metrics, *dex.Metrics, *daemon.Metrics) {
+	return rpc.NopMetrics(), dex.NopMetrics(), daemon.NopMetrics()
+}
+
 // NodeProvider takes a config and a logger and returns a ready to go Node.
 type NodeProvider func(*cfg.Config, log.Logger) (*Node, error)
 
@@ -67,12 +88,22 @@ func NewNode(config *cfg.Config, logger log.Logger, dbProvider SQLDBProvider) (*
 		return nil, err
 	}
 
+	// metrics
+	metricsProvider := NopMetricsProvider
+	if config.Instrumentation.Prometheus {
+		metricsProvider = DefaultMetricsProvider
+	}
+	rpcMetrics, dexMetrics, daemonMetrics := metricsProvider(config.Instrumentation.Namespace)
+
 	// init daemon
-	daemon.InitDaemonClient(config.Daemon)
-	daemon.InitWalletDaemonClient(config.WalletDaemon)
+	daemon.SetMetrics(daemonMetrics)
 
 	// init eventListen
-	localDex, err := dex.NewDex(config, logger.With("module", "dex"), dexDB)
+	var dexOptions []dex.DexOption
+	if config.Instrumentation.Prometheus {
+		dexOptions = append(dexOptions, dex.WithMetrics(dexMetrics))
+	}
+	localDex, err := dex.NewDex(config, logger.With("module", "dex"), dexDB, dexOptions...)
 	if err != nil {
 		return nil, err
 	}
@@ -84,6 +115,7 @@ func NewNode(config *cfg.Config, logger log.Logger, dbProvider SQLDBProvider) (*
 	rpcContext.SetLogger(logger)
 	rpcContext.SetDex(localDex)
 	rpcContext.SetDexDB(dexDB)
+	rpcContext.SetMetrics(rpcMetrics)
 	//rpcContext.SetAccountManager(accountManager)
 
 	rpcSrv, err := rpc.NewService(config, rpcContext)
@@ -114,13 +146,27 @@ type Node struct {
 	// rpc
 	rpcSrv *rpc.Service
 	dex    *dex.Dex
+
+	prometheusSrv *http.Server
 }
 
 // OnStart starts the Node. It implements cmn.Service.
 func (n *Node) OnStart() error {
 	n.Logger.Info("starting Node")
-	n.rpcSrv.Start()
+	if err := n.rpcSrv.Start(); err != nil {
+		n.dex.Stop()
+		return err
+	}
 	//	n.localWallet.Start()
+	if n.config.Instrumentation.Prometheus {
+		srv, err := n.startPrometheusServer(n.config.Instrumentation.PrometheusListenAddr)
+		if err != nil {
+			n.rpcSrv.Stop()
+			n.dex.Stop()
+			return err
+		}
+		n.prometheusSrv = srv
+	}
 	return nil
 }
 
@@ -130,6 +176,35 @@ func (n *Node) OnStop() {
 	n.Logger.Info("Stopping Node")
 	//n.localWallet.Stop()
 	n.rpcSrv.Stop()
+	n.dex.Stop()
+	if n.prometheusSrv != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := n.prometheusSrv.Shutdown(ctx); err != nil {
+			// Error from closing listeners, or context timeout:
+			n.Logger.Error("Prometheus HTTP server Shutdown", "err", err)
+		}
+	}
+}
+
+// startPrometheusServer starts a Prometheus HTTP server, listening for metrics
+// collectors on addr.
+func (n *Node) startPrometheusServer(addr string) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	srv := &http.Server{Handler: mux}
+	go func() {
+		if err := srv.Serve(listener); err != http.ErrServerClosed {
+			// Error closing listener:
+			n.Logger.Error("Prometheus HTTP server Serve", "err", err)
+		}
+	}()
+	n.Logger.Info("Prometheus endpoint opened", "url", "http://"+addr+"/metrics")
+	return srv, nil
 }
 
 // RunForever waits for an interrupt signal and stops the node.
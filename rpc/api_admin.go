@@ -0,0 +1,163 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net/url"
+
+	"github.com/lianxiangcloud/linkchain/libs/common"
+	"github.com/lianxiangcloud/linkchain/libs/hexutil"
+	"github.com/lianxiangcloud/linkchain/libs/log"
+	"github.com/lianxiangcloud/lkdex/config"
+	"github.com/lianxiangcloud/lkdex/dex"
+)
+
+var errLogLevelUnsupported = errors.New("log level can not be changed: the logs are not written by a config.LevelHandler")
+
+// PrivateAdminAPI offers the methods operating a running node, it is only served over IPC by default.
+type PrivateAdminAPI struct {
+	b     Backend
+	dex   *dex.Dex
+	dexDB *dex.SQLDBBackend
+	cfg   *config.Config
+}
+
+// NewPrivateAdminAPI creates a new PrivateAdminAPI.
+func NewPrivateAdminAPI(b Backend) *PrivateAdminAPI {
+	return &PrivateAdminAPI{
+		b:     b,
+		dex:   b.GetDex(),
+		dexDB: b.GetDexDB(),
+		cfg:   b.GetConfig(),
+	}
+}
+
+// NodeInfo is the version and a summary of the configuration of the node, the secrets are left out
+type NodeInfo struct {
+	Version        string         `json:"version"`
+	Branch         string         `json:"branch"`
+	ContractAddr   common.Address `json:"contractAddr"`
+	DBPath         string         `json:"dbPath"`
+	LogLevel       string         `json:"logLevel"`
+	TestNet        bool           `json:"testNet"`
+	OrderTTL       hexutil.Uint64 `json:"orderTTL"`
+	MaxSyncLag     hexutil.Uint64 `json:"maxSyncLag"`
+	Daemon         []string       `json:"daemon"`
+	DaemonWS       []string       `json:"daemonWS"`
+	WalletDaemon   []string       `json:"walletDaemon"`
+	IPCEndpoint    string         `json:"ipcEndpoint"`
+	HTTPEndpoint   string         `json:"httpEndpoint"`
+	HTTPModules    []string       `json:"httpModules"`
+	WSEndpoint     string         `json:"wsEndpoint"`
+	WSModules      []string       `json:"wsModules"`
+	AuthModules    []string       `json:"authModules"`
+	IPCOnlyModules []string       `json:"ipcOnlyModules"`
+	REST           bool           `json:"rest"`
+	Prometheus     string         `json:"prometheus,omitempty"` // listen address of the metrics, empty if disabled
+	IndexingPaused bool           `json:"indexingPaused"`
+}
+
+// NodeInfo returns the version and a summary of the configuration of the node
+func (s *PrivateAdminAPI) NodeInfo() (*NodeInfo, error) {
+	info := &NodeInfo{
+		Version:        config.GitCommit,
+		Branch:         config.GitBranch,
+		ContractAddr:   common.HexToAddress(s.cfg.ContractAddr),
+		DBPath:         s.dexDB.Path,
+		LogLevel:       s.cfg.LogLevel,
+		TestNet:        s.cfg.TestNet,
+		OrderTTL:       hexutil.Uint64(s.cfg.OrderTTL),
+		MaxSyncLag:     hexutil.Uint64(s.cfg.MaxSyncLag),
+		Daemon:         redactURLs(s.cfg.Daemon.RPCEndpoints()),
+		DaemonWS:       redactURLs(s.cfg.Daemon.WSEndpoints()),
+		WalletDaemon:   redactURLs(s.cfg.WalletDaemon.RPCEndpoints()),
+		IPCEndpoint:    s.cfg.IPCFile(),
+		HTTPEndpoint:   s.cfg.RPC.HTTPEndpoint,
+		HTTPModules:    s.cfg.RPC.HTTPModules,
+		WSEndpoint:     s.cfg.RPC.WSEndpoint,
+		WSModules:      s.cfg.RPC.WSModules,
+		AuthModules:    s.cfg.RPC.AuthModules,
+		IPCOnlyModules: s.cfg.RPC.IPCOnlyModules,
+		REST:           s.cfg.RPC.REST,
+		IndexingPaused: s.dex.IndexingPaused(),
+	}
+	if h, ok := levelHandler(); ok {
+		info.LogLevel = h.Level()
+	}
+	if s.cfg.Instrumentation.Prometheus {
+		info.Prometheus = s.cfg.Instrumentation.PrometheusListenAddr
+	}
+	return info, nil
+}
+
+// Resync indexes the contract logs again from block from, the indexed orders and
+// trades are kept and the logs are applied over them.
+func (s *PrivateAdminAPI) Resync(ctx context.Context, from hexutil.Uint64) (bool, error) {
+	ctx, cancel := callContext(ctx, s.b, "admin_resync")
+	defer cancel()
+	if err := s.dex.Resync(ctx, uint64(from)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// PauseIndexing stops indexing the contract logs until ResumeIndexing
+func (s *PrivateAdminAPI) PauseIndexing() (bool, error) {
+	s.dex.PauseIndexing()
+	return true, nil
+}
+
+// ResumeIndexing indexes the contract logs again from the last indexed block
+func (s *PrivateAdminAPI) ResumeIndexing() (bool, error) {
+	s.dex.ResumeIndexing()
+	return true, nil
+}
+
+// Reconcile checks the receipts of the pending txs now and returns the number of txs found in a block
+func (s *PrivateAdminAPI) Reconcile(ctx context.Context) (hexutil.Uint64, error) {
+	ctx, cancel := callContext(ctx, s.b, "admin_reconcile")
+	defer cancel()
+	settled, err := s.dex.Reconcile(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return hexutil.Uint64(settled), nil
+}
+
+// SetLogLevel changes the log level, given like the log_level option: "info" or "dex:debug,*:info"
+func (s *PrivateAdminAPI) SetLogLevel(level string) (bool, error) {
+	h, ok := levelHandler()
+	if !ok {
+		return false, errLogLevelUnsupported
+	}
+	if err := h.SetLevel(level); err != nil {
+		return false, err
+	}
+	log.Root().Info("Log level changed", "level", level)
+	return true, nil
+}
+
+// levelHandler returns the handler of the root logger if its level can be changed
+func levelHandler() (*config.LevelHandler, bool) {
+	h, ok := log.Root().GetHandler().(*config.LevelHandler)
+	return h, ok
+}
+
+// redactURLs removes the user info of the daemon urls
+func redactURLs(rawurls []string) []string {
+	urls := make([]string, len(rawurls))
+	for i, rawurl := range rawurls {
+		urls[i] = redactURL(rawurl)
+	}
+	return urls
+}
+
+// redactURL removes the user info of a daemon url
+func redactURL(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.User == nil {
+		return rawurl
+	}
+	u.User = nil
+	return u.String()
+}
@@ -1,6 +1,7 @@
 package rpc
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/lianxiangcloud/linkchain/libs/common"
@@ -22,14 +23,14 @@ func NewPublicOrderPoolAPI(b Backend) *PublicOrderPoolAPI {
 }
 func (s *PublicOrderPoolAPI) GetOrderHash(order *types.Order) (common.Hash, error) {
 	if order == nil {
-		return common.EmptyHash, fmt.Errorf("order is nil")
+		return common.EmptyHash, types.ArgsError("order is nil")
 	}
 	return order.OrderToHash(), nil
 }
 
 func (s *PublicOrderPoolAPI) GetSignOrderHash(order *types.SignOrder) (common.Hash, error) {
 	if order == nil {
-		return common.EmptyHash, fmt.Errorf("order is nil")
+		return common.EmptyHash, types.ArgsError("order is nil")
 	}
 	return order.OrderToHash(), nil
 }
@@ -42,10 +43,68 @@ func (s *PublicOrderPoolAPI) GetOrderByTxPair(getToken common.Address, giveToken
 	return s.dexDB.QueryOrderByTxPair(getToken, giveToken, 0, count)
 }
 
-func (s *PublicOrderPoolAPI) GetDepositAmount(a common.Address, token common.Address) (*hexutil.Big, error) {
-	ret, err := s.dex.DexGetDepositAmount(&a, &token)
+func (s *PublicOrderPoolAPI) GetDepositAmount(ctx context.Context, a common.Address, token common.Address) (*hexutil.Big, error) {
+	ctx, cancel := callContext(ctx, s.b, "dex_getDepositAmount")
+	defer cancel()
+	ret, err := s.dex.DexGetDepositAmount(ctx, &a, &token)
 	if err != nil {
 		return nil, err
 	}
 	return (*hexutil.Big)(ret), nil
 }
+
+// GetDepositAmounts returns the deposit of each query, the calls are sent to the node in batch requests
+func (s *PublicOrderPoolAPI) GetDepositAmounts(ctx context.Context, queries []dex.DepositQuery) ([]*dex.AmountResult, error) {
+	ctx, cancel := callContext(ctx, s.b, "dex_getDepositAmounts")
+	defer cancel()
+	if err := checkBatchQueries(s.b, "queries", len(queries)); err != nil {
+		return nil, err
+	}
+	return s.dex.DexGetDepositAmounts(ctx, queries)
+}
+
+// AvailableVolumes returns the volume of each order that can still be traded,
+// the calls are sent to the node in batch requests
+func (s *PublicOrderPoolAPI) AvailableVolumes(ctx context.Context, orders []*types.Order) ([]*dex.AmountResult, error) {
+	ctx, cancel := callContext(ctx, s.b, "dex_availableVolumes")
+	defer cancel()
+	if err := checkBatchQueries(s.b, "orders", len(orders)); err != nil {
+		return nil, err
+	}
+	return s.dex.DexAvailableVolumes(ctx, orders)
+}
+
+// checkBatchQueries checks that a batched query has between 1 and rpc.max_batch_queries items named name
+func checkBatchQueries(b Backend, name string, n int) error {
+	if n == 0 {
+		return types.ArgsError(name + " is empty")
+	}
+	if max := maxBatchQueries(b); max > 0 && n > max {
+		return types.ArgsError(fmt.Sprintf("too many %s: %d, at most %d", name, n, max))
+	}
+	return nil
+}
+
+// maxBatchQueries returns rpc.max_batch_queries, 0 for no limit
+func maxBatchQueries(b Backend) int {
+	if cfg := b.GetConfig(); cfg != nil {
+		return cfg.RPC.MaxBatchQueries
+	}
+	return 0
+}
+
+// GetNextNonce returns the order nonce the node will assign to the next order of maker
+func (s *PublicOrderPoolAPI) GetNextNonce(maker common.Address) (hexutil.Uint64, error) {
+	nonce, err := s.dexDB.ReadNextOrderNonce(maker)
+	if err != nil {
+		return 0, err
+	}
+	return hexutil.Uint64(nonce), nil
+}
+
+// SyncStatus returns the chain head, the indexed height and the reachability of the daemons
+func (s *PublicOrderPoolAPI) SyncStatus(ctx context.Context) (*dex.SyncStatus, error) {
+	ctx, cancel := callContext(ctx, s.b, "dex_syncStatus")
+	defer cancel()
+	return s.dex.SyncStatus(ctx), nil
+}
@@ -0,0 +1,26 @@
+package rpc
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/lianxiangcloud/lkdex/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckBatchQueries(t *testing.T) {
+	assert := assert.New(t)
+	b := testBackend{}
+	assert.Equal(types.CodeInvalidArgs, types.ErrorCode(checkBatchQueries(b, "queries", 0)))
+	assert.Nil(checkBatchQueries(b, "queries", 1))
+	assert.Nil(checkBatchQueries(b, "queries", 100))
+	err := checkBatchQueries(b, "queries", 101)
+	assert.Equal(types.CodeInvalidArgs, types.ErrorCode(err))
+	assert.Equal("too many queries: 101, at most 100", err.Error())
+
+	api := newRESTAPI(b, nil, nil)
+	tokens := strings.Repeat("0x95ccc08ab44ac6d071a0c5911df64ad2394a4123,", 100) + "0x95ccc08ab44ac6d071a0c5911df64ad2394a4124"
+	_, err = api.balances(context.Background(), "0xa73810e519e1075010678d706533486d8ecc8000", tokens)
+	assert.Equal(errRESTTooManyTokens, err)
+}
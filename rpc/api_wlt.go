@@ -1,7 +1,7 @@
 package rpc
 
 import (
-	"fmt"
+	"context"
 	"math/big"
 
 	"github.com/lianxiangcloud/linkchain/libs/common"
@@ -16,6 +16,8 @@ type PrivateWalletAPI struct {
 	b     Backend
 	dex   *dex.Dex
 	dexDB *dex.SQLDBBackend
+
+	policy *walletPolicy // restricts the caller, nil if not restricted
 }
 
 // NewPrivateAccountAPI create a new PrivateAccountAPI.
@@ -27,20 +29,39 @@ func NewPrivateWalletAPI(b Backend) *PrivateWalletAPI {
 	}
 }
 
-func (s *PrivateWalletAPI) PostOrder(order *types.Order) ([]common.Hash, error) {
-	//TODO:off-chain check order
-	sig, err := s.dex.SignDexOrder(order)
-	if err != nil {
+// newRestrictedWalletAPI creates a PrivateWalletAPI whose calls are checked against policy.
+func newRestrictedWalletAPI(b Backend, policy *walletPolicy) *PrivateWalletAPI {
+	api := NewPrivateWalletAPI(b)
+	api.policy = policy
+	return api
+}
+
+// authorize checks method and the accounts it acts on against the policy of the caller
+func (s *PrivateWalletAPI) authorize(method string, addrs ...common.Address) error {
+	if s.policy == nil {
+		return nil
+	}
+	if err := s.policy.allow(method, addrs...); err != nil {
+		s.dex.Logger.Info("Wallet api denied", "subject", s.policy.maskedSubject(), "method", method, "accounts", addrs, "err", err)
+		return err
+	}
+	return nil
+}
+
+// PostOrder signs and posts the order. Omitted nonce and expires are assigned by the node,
+// expires defaults to the latest block time plus ttl seconds.
+func (s *PrivateWalletAPI) PostOrder(ctx context.Context, order *types.Order, ttl *hexutil.Uint64) ([]common.Hash, error) {
+	ctx, cancel := callContext(ctx, s.b, "wlt_postOrder")
+	defer cancel()
+	if err := s.authorize("postOrder", order.Maker); err != nil {
 		return nil, err
 	}
-	signOrder := types.SignOrder{
-		Order: *order,
-		R:     (*hexutil.Big)(new(big.Int).SetBytes(sig[:32])),
-		S:     (*hexutil.Big)(new(big.Int).SetBytes(sig[32:64])),
-		V:     (*hexutil.Big)(new(big.Int).SetBytes([]byte{sig[64] + 27})),
+	signOrder, err := s.signOrder(ctx, order, ttl)
+	if err != nil {
+		return nil, err
 	}
 
-	hash, err := s.dex.DexPostOrder(&signOrder)
+	hash, err := s.dex.DexPostOrder(ctx, signOrder)
 	if err != nil {
 		return nil, err
 	}
@@ -48,9 +69,58 @@ func (s *PrivateWalletAPI) PostOrder(order *types.Order) ([]common.Hash, error)
 	return []common.Hash{hash, orderHash}, nil
 }
 
-func (s *PrivateWalletAPI) PostSignOrder(order *types.SignOrder) ([]common.Hash, error) {
+// PostOrders signs and posts orders like PostOrder, the txs of a maker are sent with
+// consecutive nonces. Each order gets its own result, a failed order does not stop the others.
+func (s *PrivateWalletAPI) PostOrders(ctx context.Context, orders []*types.Order, ttl *hexutil.Uint64) ([]*dex.OrderTxResult, error) {
+	ctx, cancel := callContext(ctx, s.b, "wlt_postOrders")
+	defer cancel()
+	makers := make([]common.Address, 0, len(orders))
+	for _, order := range orders {
+		if order != nil {
+			makers = append(makers, order.Maker)
+		}
+	}
+	if err := s.authorize("postOrders", makers...); err != nil {
+		return nil, err
+	}
+
+	signOrders := make([]*types.SignOrder, 0, len(orders))
+	signErrs := make([]error, len(orders))
+	for i, order := range orders {
+		signOrder, err := s.signOrder(ctx, order, ttl)
+		if err != nil {
+			signErrs[i] = err
+			continue
+		}
+		signOrders = append(signOrders, signOrder)
+	}
+
+	sent := s.dex.DexPostOrders(ctx, signOrders)
+	results := make([]*dex.OrderTxResult, 0, len(orders))
+	for i, order := range orders {
+		if signErrs[i] != nil {
+			ret := &dex.OrderTxResult{}
+			ret.SetError(signErrs[i])
+			if order != nil && order.AmountGet != nil && order.AmountGive != nil {
+				ret.OrderHash = order.OrderToHash()
+			}
+			results = append(results, ret)
+			continue
+		}
+		results = append(results, sent[0])
+		sent = sent[1:]
+	}
+	return results, nil
+}
 
-	hash, err := s.dex.DexPostOrder(order)
+func (s *PrivateWalletAPI) PostSignOrder(ctx context.Context, order *types.SignOrder) ([]common.Hash, error) {
+	ctx, cancel := callContext(ctx, s.b, "wlt_postSignOrder")
+	defer cancel()
+	if err := s.authorize("postSignOrder", order.Maker); err != nil {
+		return nil, err
+	}
+
+	hash, err := s.dex.DexPostOrder(ctx, order)
 	if err != nil {
 		return nil, err
 	}
@@ -63,24 +133,49 @@ type SignOrderRet struct {
 	Hash common.Hash      `json:"hash"`
 }
 
-func (s *PrivateWalletAPI) SignOrder(order *types.Order) (*SignOrderRet, error) {
+// SignOrder signs the order, assigning omitted nonce and expires like PostOrder.
+func (s *PrivateWalletAPI) SignOrder(ctx context.Context, order *types.Order, ttl *hexutil.Uint64) (*SignOrderRet, error) {
+	ctx, cancel := callContext(ctx, s.b, "wlt_signOrder")
+	defer cancel()
+	if err := s.authorize("signOrder", order.Maker); err != nil {
+		return nil, err
+	}
+	signOrder, err := s.signOrder(ctx, order, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return &SignOrderRet{signOrder, signOrder.OrderToHash()}, nil
+}
 
-	sig, err := s.dex.SignDexOrder(order)
+// signOrder assigns the omitted fields of order and signs it with the maker account
+func (s *PrivateWalletAPI) signOrder(ctx context.Context, order *types.Order, ttl *hexutil.Uint64) (*types.SignOrder, error) {
+	err := s.dex.FillOrderDefaults(ctx, order, ttl)
 	if err != nil {
 		return nil, err
 	}
-	signOrder := types.SignOrder{
+	sig, err := s.dex.SignDexOrder(ctx, order)
+	if err != nil {
+		return nil, err
+	}
+	return &types.SignOrder{
 		Order: *order,
 		R:     (*hexutil.Big)(new(big.Int).SetBytes(sig[:32])),
 		S:     (*hexutil.Big)(new(big.Int).SetBytes(sig[32:64])),
 		V:     (*hexutil.Big)(new(big.Int).SetBytes([]byte{sig[64] + 27})),
-	}
+	}, nil
+}
 
-	return &SignOrderRet{&signOrder, signOrder.OrderToHash()}, nil
+func (s *PrivateWalletAPI) Trade(ctx context.Context, a common.Address, order *types.SignOrder, amount *hexutil.Big) ([]common.Hash, error) {
+	ctx, cancel := callContext(ctx, s.b, "wlt_trade")
+	defer cancel()
+	if err := s.authorize("trade", a); err != nil {
+		return nil, err
+	}
+	return s.trade(ctx, a, order, amount)
 }
 
-func (s *PrivateWalletAPI) Trade(a common.Address, order *types.SignOrder, amount *hexutil.Big) ([]common.Hash, error) {
-	hash, err := s.dex.DexTrade(a, order, amount)
+func (s *PrivateWalletAPI) trade(ctx context.Context, a common.Address, order *types.SignOrder, amount *hexutil.Big) ([]common.Hash, error) {
+	hash, err := s.dex.DexTrade(ctx, a, order, amount)
 	if err != nil {
 		return nil, err
 	}
@@ -88,35 +183,167 @@ func (s *PrivateWalletAPI) Trade(a common.Address, order *types.SignOrder, amoun
 	return []common.Hash{hash, orderHash}, nil
 }
 
-func (s *PrivateWalletAPI) TakerOrderByHash(a common.Address, hash common.Hash, amount *hexutil.Big) ([]common.Hash, error) {
+func (s *PrivateWalletAPI) TakerOrderByHash(ctx context.Context, a common.Address, hash common.Hash, amount *hexutil.Big) ([]common.Hash, error) {
+	ctx, cancel := callContext(ctx, s.b, "wlt_takerOrderByHash")
+	defer cancel()
+	if err := s.authorize("takerOrderByHash", a); err != nil {
+		return nil, err
+	}
 	order, err := s.dexDB.ReadOrder(hash)
 	if err != nil {
 		return nil, err
 	}
 	if order == nil {
-		return nil, fmt.Errorf("order is not exist")
+		return nil, types.ErrOrderNotFound
 	}
-	return s.Trade(a, order, amount)
+	return s.trade(ctx, a, order, amount)
 }
 
-func (s *PrivateWalletAPI) CancelOrder(order *types.SignOrder) (common.Hash, error) {
-	return s.dex.DexCancelOrder(order)
+func (s *PrivateWalletAPI) CancelOrder(ctx context.Context, order *types.SignOrder) (common.Hash, error) {
+	ctx, cancel := callContext(ctx, s.b, "wlt_cancelOrder")
+	defer cancel()
+	if err := s.authorize("cancelOrder", order.Maker); err != nil {
+		return common.EmptyHash, err
+	}
+	return s.dex.DexCancelOrder(ctx, order)
 }
-func (s *PrivateWalletAPI) CancelOrderByHash(hash common.Hash) (common.Hash, error) {
+func (s *PrivateWalletAPI) CancelOrderByHash(ctx context.Context, hash common.Hash) (common.Hash, error) {
+	ctx, cancel := callContext(ctx, s.b, "wlt_cancelOrderByHash")
+	defer cancel()
 	order, err := s.dexDB.ReadOrder(hash)
 	if err != nil {
 		return common.EmptyHash, err
 	}
 	if order == nil {
-		return common.EmptyHash, fmt.Errorf("order is not exist")
+		return common.EmptyHash, types.ErrOrderNotFound
+	}
+	if err := s.authorize("cancelOrderByHash", order.Maker); err != nil {
+		return common.EmptyHash, err
+	}
+	return s.dex.DexCancelOrder(ctx, order)
+}
+
+// CancelOrders cancels the indexed orders of hashes and returns the result of each order
+func (s *PrivateWalletAPI) CancelOrders(ctx context.Context, hashes []common.Hash) ([]*dex.OrderTxResult, error) {
+	ctx, cancel := callContext(ctx, s.b, "wlt_cancelOrders")
+	defer cancel()
+	orders := make([]*types.SignOrder, 0, len(hashes))
+	missing := make(map[common.Hash]bool)
+	for _, hash := range hashes {
+		order, err := s.dexDB.ReadOrder(hash)
+		if err != nil || order == nil {
+			missing[hash] = true
+			continue
+		}
+		orders = append(orders, order)
+	}
+	makers := make([]common.Address, 0, len(orders))
+	for _, order := range orders {
+		makers = append(makers, order.Maker)
+	}
+	if err := s.authorize("cancelOrders", makers...); err != nil {
+		return nil, err
+	}
+
+	sent := s.dex.DexCancelOrders(ctx, orders)
+	results := make([]*dex.OrderTxResult, 0, len(hashes))
+	for _, hash := range hashes {
+		if missing[hash] {
+			ret := &dex.OrderTxResult{OrderHash: hash}
+			ret.SetError(types.ErrOrderNotFound)
+			results = append(results, ret)
+			continue
+		}
+		results = append(results, sent[0])
+		sent = sent[1:]
+	}
+	return results, nil
+}
+
+// CancelAll cancels all open orders of maker, only those of pair if pair is given
+func (s *PrivateWalletAPI) CancelAll(ctx context.Context, maker common.Address, pair *types.TokenPair) ([]*dex.OrderTxResult, error) {
+	ctx, cancel := callContext(ctx, s.b, "wlt_cancelAll")
+	defer cancel()
+	if err := s.authorize("cancelAll", maker); err != nil {
+		return nil, err
 	}
-	return s.dex.DexCancelOrder(order)
+	return s.dex.DexCancelAll(ctx, maker, pair)
 }
 
-func (s *PrivateWalletAPI) WithdrawToken(a common.Address, token common.Address, amount *hexutil.Big) (common.Hash, error) {
-	return s.dex.DexWithDraw(a, token, amount)
+func (s *PrivateWalletAPI) WithdrawToken(ctx context.Context, a common.Address, token common.Address, amount *hexutil.Big) (common.Hash, error) {
+	ctx, cancel := callContext(ctx, s.b, "wlt_withdrawToken")
+	defer cancel()
+	if err := s.authorize("withdrawToken", a); err != nil {
+		return common.EmptyHash, err
+	}
+	return s.dex.DexWithDraw(ctx, a, token, amount)
 }
 
-func (s *PrivateWalletAPI) DepositToken(a common.Address, token common.Address, amount *hexutil.Big) (common.Hash, error) {
-	return s.dex.DexDeposit(a, token, amount)
+func (s *PrivateWalletAPI) DepositToken(ctx context.Context, a common.Address, token common.Address, amount *hexutil.Big) (common.Hash, error) {
+	ctx, cancel := callContext(ctx, s.b, "wlt_depositToken")
+	defer cancel()
+	if err := s.authorize("depositToken", a); err != nil {
+		return common.EmptyHash, err
+	}
+	return s.dex.DexDeposit(ctx, a, token, amount)
+}
+
+// GetTxStatus returns the state of a tx sent by the wallet api, with the revert reason if it failed
+func (s *PrivateWalletAPI) GetTxStatus(hash common.Hash) (*dex.TxStatus, error) {
+	status, err := s.dex.GetTxStatus(hash)
+	if err != nil {
+		return nil, err
+	}
+	if status == nil {
+		return nil, types.ErrTxNotFound
+	}
+	if err := s.authorize("getTxStatus", status.From); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// ListPendingTxs returns the txs sent by address through the wallet api that have no receipt yet
+func (s *PrivateWalletAPI) ListPendingTxs(a common.Address) ([]*dex.TxStatus, error) {
+	if err := s.authorize("listPendingTxs", a); err != nil {
+		return nil, err
+	}
+	return s.dex.ListPendingTxs(a)
+}
+
+// SpeedUpTx resends the pending tx hash with the same nonce at gasPrice, which must be higher
+// than the gas price of the tx. It returns the hash of the new tx.
+func (s *PrivateWalletAPI) SpeedUpTx(ctx context.Context, hash common.Hash, gasPrice *hexutil.Big) (common.Hash, error) {
+	ctx, cancel := callContext(ctx, s.b, "wlt_speedUpTx")
+	defer cancel()
+	if err := s.authorizeTx("speedUpTx", hash); err != nil {
+		return common.EmptyHash, err
+	}
+	if gasPrice == nil {
+		return common.EmptyHash, types.ArgsError("gasPrice is nil")
+	}
+	return s.dex.SpeedUpTx(ctx, hash, gasPrice.ToInt())
+}
+
+// CancelTx replaces the pending tx hash with a zero-value transfer of its sender to itself with
+// the same nonce and a higher gas price. It returns the hash of the new tx.
+func (s *PrivateWalletAPI) CancelTx(ctx context.Context, hash common.Hash) (common.Hash, error) {
+	ctx, cancel := callContext(ctx, s.b, "wlt_cancelTx")
+	defer cancel()
+	if err := s.authorizeTx("cancelTx", hash); err != nil {
+		return common.EmptyHash, err
+	}
+	return s.dex.CancelTx(ctx, hash)
+}
+
+// authorizeTx checks method on the sender of the tx hash
+func (s *PrivateWalletAPI) authorizeTx(method string, hash common.Hash) error {
+	status, err := s.dex.GetTxStatus(hash)
+	if err != nil {
+		return err
+	}
+	if status == nil {
+		return types.ErrTxNotFound
+	}
+	return s.authorize(method, status.From)
 }
@@ -0,0 +1,248 @@
+package rpc
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lianxiangcloud/linkchain/libs/log"
+	"github.com/lianxiangcloud/linkchain/libs/rpc"
+	"github.com/lianxiangcloud/lkdex/config"
+)
+
+const (
+	apiKeyHeader = "X-API-Key"
+
+	errCodeUnauthorized = -32001
+)
+
+var (
+	errNoCredentials      = errors.New("unauthorized: missing api key or bearer token")
+	errInvalidCredentials = errors.New("unauthorized: invalid api key or bearer token")
+	errInvalidJWT         = errors.New("unauthorized: invalid jwt")
+	errExpiredJWT         = errors.New("unauthorized: jwt expired")
+)
+
+// authenticator checks the credentials of HTTP and WS requests against the
+// configured api keys and jwt secret. Only the modules in AuthModules need them.
+type authenticator struct {
+	logger    log.Logger
+	modules   map[string]bool
+	keys      [][]byte
+	jwtSecret []byte
+}
+
+func newAuthenticator(cfg *config.RPCConfig, logger log.Logger) *authenticator {
+	a := &authenticator{
+		logger:  logger,
+		modules: make(map[string]bool),
+	}
+	for _, m := range cfg.AuthModules {
+		a.modules[m] = true
+	}
+	for _, k := range cfg.APIKeys {
+		if k != "" {
+			a.keys = append(a.keys, []byte(k))
+		}
+	}
+	if cfg.JWTSecret != "" {
+		a.jwtSecret = []byte(cfg.JWTSecret)
+	}
+	return a
+}
+
+// enabled reports whether any credential is configured
+func (a *authenticator) enabled() bool {
+	return len(a.keys) > 0 || len(a.jwtSecret) > 0
+}
+
+// protected reports whether module needs credentials
+func (a *authenticator) protected(module string) bool {
+	return a.modules[module]
+}
+
+// authenticate checks the api key or bearer token of r and returns the identity
+// of the caller: the api key itself or the subject of the jwt.
+func (a *authenticator) authenticate(r *http.Request) (string, error) {
+	token := r.Header.Get(apiKeyHeader)
+	if token == "" {
+		auth := r.Header.Get("Authorization")
+		if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+			token = strings.TrimSpace(auth[7:])
+		}
+	}
+	if token == "" {
+		return "", errNoCredentials
+	}
+
+	for _, k := range a.keys {
+		if subtle.ConstantTimeCompare(k, []byte(token)) == 1 {
+			return token, nil
+		}
+	}
+	if len(a.jwtSecret) > 0 && strings.Count(token, ".") == 2 {
+		claims, err := verifyJWT(token, a.jwtSecret, time.Now())
+		if err != nil {
+			return "", err
+		}
+		return claims.Subject, nil
+	}
+	return "", errInvalidCredentials
+}
+
+// httpHandler serves authenticated HTTP requests with the handler of their identity in
+// restricted or full, and the others with public, whatever their HTTP method and body.
+// Invalid credentials are rejected, so are the requests without credentials calling a
+// protected module: public would answer them with method not found.
+func (a *authenticator) httpHandler(full, public http.Handler, restricted map[string]http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := a.authenticate(r)
+		switch err {
+		case nil:
+			if h, ok := restricted[id]; ok {
+				h.ServeHTTP(w, r)
+				return
+			}
+			full.ServeHTTP(w, r)
+		case errNoCredentials:
+			if r.Body != nil {
+				body, err := peekBody(w, r)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+					return
+				}
+				if method, ok := a.protectedCall(body); ok {
+					a.logger.Info("RPC auth fail", "remote", r.RemoteAddr, "method", method, "err", err)
+					writeRPCError(w, http.StatusUnauthorized, nil, false, errCodeUnauthorized, errNoCredentials)
+					return
+				}
+			}
+			public.ServeHTTP(w, r)
+		default:
+			a.logger.Info("RPC auth fail", "remote", r.RemoteAddr, "err", err)
+			writeRPCError(w, http.StatusUnauthorized, nil, false, errCodeUnauthorized, err)
+		}
+	})
+}
+
+// wsHandler serves authenticated WS connections with the handler of their identity in
+// restricted or full, and the others with public. Invalid credentials are rejected at the handshake.
+func (a *authenticator) wsHandler(full, public http.Handler, restricted map[string]http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := a.authenticate(r)
+		switch err {
+		case nil:
+			if h, ok := restricted[id]; ok {
+				h.ServeHTTP(w, r)
+				return
+			}
+			full.ServeHTTP(w, r)
+		case errNoCredentials:
+			public.ServeHTTP(w, r)
+		default:
+			a.logger.Info("WS auth fail", "remote", r.RemoteAddr, "err", err)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		}
+	})
+}
+
+// protectedCall returns the first method of a single or batch request body that
+// belongs to a protected module. It only picks the error of a request, the public
+// handler serves none of the protected modules whatever the body is.
+func (a *authenticator) protectedCall(body []byte) (string, bool) {
+	calls, _, err := parseCalls(body)
+	if err != nil {
+		return "", false
+	}
+	for _, c := range calls {
+		if a.protected(c.module()) {
+			return c.Method, true
+		}
+	}
+	return "", false
+}
+
+// jwtClaims are the registered claims checked by verifyJWT
+type jwtClaims struct {
+	Subject   string `json:"sub"`
+	ExpiresAt int64  `json:"exp"`
+	NotBefore int64  `json:"nbf"`
+}
+
+// verifyJWT verifies a HS256 signed jwt and its exp and nbf claims
+func verifyJWT(token string, secret []byte, now time.Time) (*jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errInvalidJWT
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return nil, errInvalidJWT
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errInvalidJWT
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, errInvalidJWT
+	}
+
+	claims := &jwtClaims{}
+	if err := decodeJWTPart(parts[1], claims); err != nil {
+		return nil, errInvalidJWT
+	}
+	if claims.ExpiresAt != 0 && now.Unix() >= claims.ExpiresAt {
+		return nil, errExpiredJWT
+	}
+	if claims.NotBefore != 0 && now.Unix() < claims.NotBefore {
+		return nil, errInvalidJWT
+	}
+	return claims, nil
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// registerAPIs registers the apis of modules, or all apis if exposeAll, on a new server
+// serving rpc_discover to describe them.
+// Modules in exclude are never registered.
+func registerAPIs(apis []rpc.API, modules []string, exposeAll bool, exclude map[string]bool, logger log.Logger) (*rpc.Server, error) {
+	whitelist := make(map[string]bool)
+	for _, module := range modules {
+		whitelist[module] = true
+	}
+	var registered []rpc.API
+	for _, api := range apis {
+		if exclude[api.Namespace] {
+			continue
+		}
+		if exposeAll || whitelist[api.Namespace] || (len(whitelist) == 0 && api.Public) {
+			registered = append(registered, api)
+		}
+	}
+	handler := rpc.NewServer()
+	for _, api := range withDiscoverAPI(registered) {
+		if err := handler.RegisterName(api.Namespace, api.Service); err != nil {
+			return nil, err
+		}
+		logger.Debug("RPC registered", "namespace", api.Namespace)
+	}
+	return handler, nil
+}
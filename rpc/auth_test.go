@@ -0,0 +1,125 @@
+package rpc
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lianxiangcloud/linkchain/libs/log"
+	"github.com/lianxiangcloud/lkdex/config"
+	"github.com/stretchr/testify/assert"
+)
+
+const testJWTSecret = "secret"
+
+func signJWT(alg string, claims jwtClaims, secret string) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyJWT(t *testing.T) {
+	now := time.Unix(1000000, 0)
+	valid := signJWT("HS256", jwtClaims{Subject: "alice", ExpiresAt: now.Unix() + 60, NotBefore: now.Unix() - 60}, testJWTSecret)
+	parts := strings.Split(valid, ".")
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"valid", valid, nil},
+		{"no exp and nbf", signJWT("HS256", jwtClaims{Subject: "alice"}, testJWTSecret), nil},
+		{"alg none", signJWT("none", jwtClaims{Subject: "alice"}, testJWTSecret), errInvalidJWT},
+		{"alg HS512", signJWT("HS512", jwtClaims{Subject: "alice"}, testJWTSecret), errInvalidJWT},
+		{"unsigned", parts[0] + "." + parts[1] + ".", errInvalidJWT},
+		{"other secret", signJWT("HS256", jwtClaims{Subject: "alice"}, "other"), errInvalidJWT},
+		{"tampered claims", parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"bob"}`)) + "." + parts[2], errInvalidJWT},
+		{"expired", signJWT("HS256", jwtClaims{Subject: "alice", ExpiresAt: now.Unix()}, testJWTSecret), errExpiredJWT},
+		{"not yet valid", signJWT("HS256", jwtClaims{Subject: "alice", NotBefore: now.Unix() + 1}, testJWTSecret), errInvalidJWT},
+		{"two parts", parts[0] + "." + parts[1], errInvalidJWT},
+	}
+	for _, tt := range tests {
+		claims, err := verifyJWT(tt.token, []byte(testJWTSecret), now)
+		assert.Equal(t, tt.err, err, tt.name)
+		if err == nil {
+			assert.Equal(t, "alice", claims.Subject, tt.name)
+		}
+	}
+}
+
+// namedHandler answers every request with its name
+func namedHandler(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(name))
+	})
+}
+
+func TestAuthHTTPHandler(t *testing.T) {
+	cfg := config.DefaultConfig().RPC
+	cfg.APIKeys = []string{"key1", "key2"}
+	cfg.JWTSecret = testJWTSecret
+	auth := newAuthenticator(cfg, log.NewNopLogger())
+	handler := auth.httpHandler(namedHandler("full"), namedHandler("public"), map[string]http.Handler{
+		"key2":  namedHandler("restricted key2"),
+		"alice": namedHandler("restricted alice"),
+	})
+
+	aliceJWT := "Bearer " + signJWT("HS256", jwtClaims{Subject: "alice"}, testJWTSecret)
+	bobJWT := "Bearer " + signJWT("HS256", jwtClaims{Subject: "bob"}, testJWTSecret)
+	expiredJWT := "Bearer " + signJWT("HS256", jwtClaims{Subject: "alice", ExpiresAt: 1}, testJWTSecret)
+	forgedJWT := "Bearer " + signJWT("HS256", jwtClaims{Subject: "alice"}, "other")
+	dexCall := `{"jsonrpc":"2.0","id":1,"method":"dex_getOrder","params":[]}`
+	wltCall := `{"jsonrpc":"2.0","id":1,"method":"wlt_postOrder","params":[]}`
+	tests := []struct {
+		name   string
+		method string
+		header string
+		value  string
+		body   string
+		status int
+		served string
+	}{
+		{"public call", http.MethodPost, "", "", dexCall, http.StatusOK, "public"},
+		{"protected call", http.MethodPost, "", "", wltCall, http.StatusUnauthorized, ""},
+		{"protected call in batch", http.MethodPost, "", "", "[" + dexCall + "," + wltCall + "]", http.StatusUnauthorized, ""},
+		{"public batch", http.MethodPost, "", "", "[" + dexCall + "," + dexCall + "]", http.StatusOK, "public"},
+		{"unparseable body", http.MethodPost, "", "", `{"method":"wlt_postOrder"`, http.StatusOK, "public"},
+		{"get", http.MethodGet, "", "", "", http.StatusOK, "public"},
+		{"get with protected body", http.MethodGet, "", "", wltCall, http.StatusUnauthorized, ""},
+		{"api key", http.MethodPost, apiKeyHeader, "key1", wltCall, http.StatusOK, "full"},
+		{"bearer api key", http.MethodPost, "Authorization", "Bearer key1", wltCall, http.StatusOK, "full"},
+		{"restricted api key", http.MethodPost, apiKeyHeader, "key2", wltCall, http.StatusOK, "restricted key2"},
+		{"restricted jwt", http.MethodPost, "Authorization", aliceJWT, wltCall, http.StatusOK, "restricted alice"},
+		{"unrestricted jwt", http.MethodPost, "Authorization", bobJWT, wltCall, http.StatusOK, "full"},
+		{"invalid api key", http.MethodPost, apiKeyHeader, "key3", dexCall, http.StatusUnauthorized, ""},
+		{"expired jwt", http.MethodPost, "Authorization", expiredJWT, dexCall, http.StatusUnauthorized, ""},
+		{"forged jwt", http.MethodPost, "Authorization", forgedJWT, dexCall, http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/", strings.NewReader(tt.body))
+		if tt.header != "" {
+			req.Header.Set(tt.header, tt.value)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, tt.status, rec.Code, tt.name)
+		body, _ := ioutil.ReadAll(rec.Body)
+		if tt.status != http.StatusOK {
+			var resp jsonErrResponse
+			assert.Nil(t, json.Unmarshal(body, &resp), tt.name)
+			assert.Equal(t, errCodeUnauthorized, resp.Error.Code, tt.name)
+			continue
+		}
+		assert.Equal(t, tt.served, string(body), tt.name)
+	}
+}
@@ -3,6 +3,7 @@
 package rpc
 
 import (
+	"github.com/lianxiangcloud/lkdex/config"
 	"github.com/lianxiangcloud/lkdex/dex"
 	"github.com/lianxiangcloud/linkchain/libs/rpc"
 )
@@ -12,6 +13,7 @@ import (
 type Backend interface {
 	GetDex() *dex.Dex
 	GetDexDB() *dex.SQLDBBackend
+	GetConfig() *config.Config
 }
 
 func GetAPIs(apiBackend Backend) []rpc.API {
@@ -28,9 +30,27 @@ func GetAPIs(apiBackend Backend) []rpc.API {
 			Service:   NewPrivateWalletAPI(apiBackend),
 			Public:    false,
 		},
+		{
+			Namespace: "admin",
+			Version:   "1.0",
+			Service:   NewPrivateAdminAPI(apiBackend),
+			Public:    false,
+		},
 	}
 }
 
+// restrictedAPIs returns apis with the wlt service restricted by policy
+func restrictedAPIs(apiBackend Backend, apis []rpc.API, policy *walletPolicy) []rpc.API {
+	rets := make([]rpc.API, len(apis))
+	copy(rets, apis)
+	for i := range rets {
+		if rets[i].Namespace == "wlt" {
+			rets[i].Service = newRestrictedWalletAPI(apiBackend, policy)
+		}
+	}
+	return rets
+}
+
 type ApiBackend struct {
 	s     *Service
 	dex   *dex.Dex
@@ -59,3 +79,7 @@ func (b *ApiBackend) GetDex() *dex.Dex {
 func (b *ApiBackend) GetDexDB() *dex.SQLDBBackend {
 	return b.dexDB
 }
+
+func (b *ApiBackend) GetConfig() *config.Config {
+	return b.s.conf
+}
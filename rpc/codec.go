@@ -0,0 +1,131 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lianxiangcloud/linkchain/libs/rpc"
+)
+
+// errCodeMethodNotFound is the code of the error served for an unknown method
+const errCodeMethodNotFound = -32601
+
+// dataError is an error with data for the JSON-RPC error object, like types.Error
+type dataError interface {
+	ErrorData() interface{}
+}
+
+// serverCodec serves the data of the errors returned by the apis in the error objects,
+// the codecs of libs/rpc only serve their code and message.
+// It also records the metrics of the calls it reads and answers.
+type serverCodec struct {
+	rpc.ServerCodec
+	metrics *Metrics
+
+	mu    sync.Mutex
+	calls map[string]startedCall // calls waiting for their response, by id
+}
+
+// startedCall is a call read by serverCodec
+type startedCall struct {
+	method string
+	start  time.Time
+}
+
+func newServerCodec(rwc io.ReadWriteCloser, metrics *Metrics) rpc.ServerCodec {
+	enc := json.NewEncoder(rwc)
+	dec := json.NewDecoder(rwc)
+	dec.UseNumber()
+	return newCodec(rwc, enc.Encode, dec.Decode, metrics)
+}
+
+// newCodec creates a serverCodec like rpc.NewCodec
+func newCodec(rwc io.ReadWriteCloser, encode, decode func(v interface{}) error, metrics *Metrics) rpc.ServerCodec {
+	c := &serverCodec{metrics: metrics, calls: make(map[string]startedCall)}
+	c.ServerCodec = rpc.NewCodec(rwc, encode, func(v interface{}) error {
+		if err := decode(v); err != nil {
+			return err
+		}
+		if msg, ok := v.(*json.RawMessage); ok {
+			c.start(*msg)
+		}
+		return nil
+	})
+	return c
+}
+
+// start records the calls of a request message
+func (c *serverCodec) start(msg json.RawMessage) {
+	calls, _, err := parseCalls(msg)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, call := range calls {
+		// notifications are not answered
+		if key := callKey(call.ID); key != "" {
+			c.calls[key] = startedCall{method: call.Method, start: now}
+		}
+	}
+}
+
+// finish records the metrics of the call answered with status
+func (c *serverCodec) finish(id interface{}, status string, code int) {
+	raw, err := json.Marshal(id)
+	if err != nil {
+		return
+	}
+	key := callKey(raw)
+	c.mu.Lock()
+	call, ok := c.calls[key]
+	delete(c.calls, key)
+	c.mu.Unlock()
+	if !ok {
+		return
+	}
+	method := call.method
+	if code == errCodeMethodNotFound {
+		// keeps the method label bounded
+		method = "unknown"
+	}
+	c.metrics.Requests.With("method", method, "status", status).Add(1)
+	c.metrics.RequestDuration.With("method", method).Observe(time.Since(call.start).Seconds())
+}
+
+// callKey returns the compact json of a call id, empty for a missing or null id
+func callKey(id json.RawMessage) string {
+	if len(id) == 0 {
+		return ""
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, id); err != nil || buf.String() == "null" {
+		return ""
+	}
+	return buf.String()
+}
+
+func (c *serverCodec) CreateResponse(id interface{}, reply interface{}) interface{} {
+	c.finish(id, "ok", 0)
+	return c.ServerCodec.CreateResponse(id, reply)
+}
+
+func (c *serverCodec) CreateErrorResponse(id interface{}, err rpc.Error) interface{} {
+	c.finish(id, strconv.Itoa(err.ErrorCode()), err.ErrorCode())
+	if e, ok := err.(dataError); ok {
+		if data := e.ErrorData(); data != nil {
+			return c.ServerCodec.CreateErrorResponseWithInfo(id, err, data)
+		}
+	}
+	return c.ServerCodec.CreateErrorResponse(id, err)
+}
+
+func (c *serverCodec) CreateErrorResponseWithInfo(id interface{}, err rpc.Error, info interface{}) interface{} {
+	c.finish(id, strconv.Itoa(err.ErrorCode()), err.ErrorCode())
+	return c.ServerCodec.CreateErrorResponseWithInfo(id, err, info)
+}
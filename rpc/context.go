@@ -10,16 +10,17 @@ import (
 
 // Context RPC context
 type Context struct {
-	cfg    *config.Config
-	dex    *dex.Dex
-	dexDB  *dex.SQLDBBackend
-	logger log.Logger
+	cfg     *config.Config
+	dex     *dex.Dex
+	dexDB   *dex.SQLDBBackend
+	logger  log.Logger
+	metrics *Metrics
 
 	//	accManager *accounts.Manager
 }
 
 func NewContext() *Context {
-	return &Context{}
+	return &Context{metrics: NopMetrics()}
 }
 
 func (c *Context) SetLogger(logger log.Logger) {
@@ -32,3 +33,7 @@ func (c *Context) SetDex(dex *dex.Dex) {
 func (c *Context) SetDexDB(db *dex.SQLDBBackend) {
 	c.dexDB = db
 }
+
+func (c *Context) SetMetrics(metrics *Metrics) {
+	c.metrics = metrics
+}
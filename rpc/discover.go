@@ -0,0 +1,357 @@
+package rpc
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"math/big"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/lianxiangcloud/linkchain/libs/common"
+	"github.com/lianxiangcloud/linkchain/libs/hexutil"
+	"github.com/lianxiangcloud/linkchain/libs/rpc"
+	"github.com/lianxiangcloud/lkdex/config"
+	"github.com/lianxiangcloud/lkdex/dex"
+)
+
+const (
+	openRPCVersion = "1.2.6"
+	apiTitle       = "lkdex JSON-RPC API"
+	apiVersion     = "1.0"
+)
+
+// methodDoc names the params of a method and summarizes it,
+// the names of the params can not be read by reflection.
+type methodDoc struct {
+	params  []string
+	summary string
+}
+
+var methodDocs = map[string]methodDoc{
+	"rpc_discover": {nil, "Returns the OpenRPC document of the methods served by the endpoint"},
+	"rpc_modules":  {nil, "Returns the modules served by the endpoint with their version"},
+
+	"dex_getOrderHash":      {[]string{"order"}, "Returns the hash of an order"},
+	"dex_getSignOrderHash":  {[]string{"order"}, "Returns the hash of a signed order"},
+	"dex_getOrderByHash":    {[]string{"hash"}, "Returns the indexed order of hash"},
+	"dex_getOrderByTxPair":  {[]string{"tokenGet", "tokenGive", "count"}, "Returns the open orders giving tokenGive for tokenGet by price"},
+	"dex_getDepositAmount":  {[]string{"account", "token"}, "Returns the deposit of account in the dex contract"},
+	"dex_getDepositAmounts": {[]string{"queries"}, "Returns the deposit of each {user, token} query, evaluated in batch requests"},
+	"dex_availableVolumes":  {[]string{"orders"}, "Returns the volume of each order that can still be traded, evaluated in batch requests"},
+	"dex_getNextNonce":      {[]string{"maker"}, "Returns the order nonce the node will assign to the next order of maker"},
+	"dex_syncStatus":        {nil, "Returns the chain head, the indexed height, the lag and the reachability of the daemons"},
+
+	"wlt_signOrder":         {[]string{"order", "ttl"}, "Signs an order, omitted nonce and expires are assigned by the node"},
+	"wlt_postOrder":         {[]string{"order", "ttl"}, "Signs and posts an order"},
+	"wlt_postOrders":        {[]string{"orders", "ttl"}, "Signs and posts orders, returns the result of each order"},
+	"wlt_postSignOrder":     {[]string{"order"}, "Posts a signed order"},
+	"wlt_trade":             {[]string{"taker", "order", "amount"}, "Takes amount of a signed order"},
+	"wlt_takerOrderByHash":  {[]string{"taker", "hash", "amount"}, "Takes amount of the indexed order of hash"},
+	"wlt_cancelOrder":       {[]string{"order"}, "Cancels a signed order"},
+	"wlt_cancelOrderByHash": {[]string{"hash"}, "Cancels the indexed order of hash"},
+	"wlt_cancelOrders":      {[]string{"hashes"}, "Cancels the indexed orders of hashes, returns the result of each order"},
+	"wlt_cancelAll":         {[]string{"maker", "pair"}, "Cancels the open orders of maker, only those of pair if given"},
+	"wlt_withdrawToken":     {[]string{"account", "token", "amount"}, "Withdraws amount of token from the dex contract"},
+	"wlt_depositToken":      {[]string{"account", "token", "amount"}, "Deposits amount of token to the dex contract"},
+	"wlt_getTxStatus":       {[]string{"hash"}, "Returns the state of a tx sent by the wallet api"},
+	"wlt_listPendingTxs":    {[]string{"account"}, "Returns the txs of account sent by the wallet api without receipt"},
+	"wlt_speedUpTx":         {[]string{"hash", "gasPrice"}, "Resends a pending tx with the same nonce at a higher gasPrice"},
+	"wlt_cancelTx":          {[]string{"hash"}, "Replaces a pending tx with a zero-value transfer to its sender with the same nonce"},
+	"admin_nodeInfo":        {nil, "Returns the version and a summary of the configuration of the node"},
+	"admin_resync":          {[]string{"from"}, "Indexes the contract logs again from block from"},
+	"admin_pauseIndexing":   {nil, "Stops indexing the contract logs"},
+	"admin_resumeIndexing":  {nil, "Indexes the contract logs again from the last indexed block"},
+	"admin_reconcile":       {nil, "Checks the receipts of the pending txs and returns the number of txs found in a block"},
+	"admin_setLogLevel":     {[]string{"level"}, "Changes the log level, given like the log_level option"},
+}
+
+// OpenRPCDocument describes the methods of rpc apis, see https://spec.open-rpc.org
+type OpenRPCDocument struct {
+	OpenRPC    string            `json:"openrpc"`
+	Info       OpenRPCInfo       `json:"info"`
+	Methods    []*OpenRPCMethod  `json:"methods"`
+	Components OpenRPCComponents `json:"components"`
+}
+
+type OpenRPCInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type OpenRPCMethod struct {
+	Name           string                      `json:"name"`
+	Summary        string                      `json:"summary,omitempty"`
+	ParamStructure string                      `json:"paramStructure"`
+	Params         []*OpenRPCContentDescriptor `json:"params"`
+	Result         *OpenRPCContentDescriptor   `json:"result"`
+}
+
+type OpenRPCContentDescriptor struct {
+	Name     string      `json:"name"`
+	Required bool        `json:"required,omitempty"`
+	Schema   *JSONSchema `json:"schema"`
+}
+
+type OpenRPCComponents struct {
+	Schemas map[string]*JSONSchema `json:"schemas"`
+}
+
+// JSONSchema is the subset of JSON schema used to describe params and results
+type JSONSchema struct {
+	Ref                  string                 `json:"$ref,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Pattern              string                 `json:"pattern,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *JSONSchema            `json:"additionalProperties,omitempty"`
+}
+
+var (
+	hexNumberPattern = "^0x(0|[1-9a-fA-F][0-9a-fA-F]*)$"
+
+	knownSchemas = map[reflect.Type]*JSONSchema{
+		reflect.TypeOf(common.Address{}):  {Type: "string", Description: "hex encoded address", Pattern: "^0x[0-9a-fA-F]{40}$"},
+		reflect.TypeOf(common.Hash{}):     {Type: "string", Description: "hex encoded hash", Pattern: "^0x[0-9a-fA-F]{64}$"},
+		reflect.TypeOf(hexutil.Big{}):     {Type: "string", Description: "hex encoded integer", Pattern: hexNumberPattern},
+		reflect.TypeOf(big.Int{}):         {Type: "string", Description: "hex encoded integer", Pattern: hexNumberPattern},
+		reflect.TypeOf(hexutil.Uint64(0)): {Type: "string", Description: "hex encoded integer", Pattern: hexNumberPattern},
+		reflect.TypeOf(hexutil.Uint(0)):   {Type: "string", Description: "hex encoded integer", Pattern: hexNumberPattern},
+		reflect.TypeOf(hexutil.Bytes{}):   {Type: "string", Description: "hex encoded bytes", Pattern: "^0x([0-9a-fA-F]{2})*$"},
+	}
+
+	contextType      = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType        = reflect.TypeOf((*error)(nil)).Elem()
+	subscriptionType = reflect.TypeOf((*rpc.Subscription)(nil))
+	jsonMarshaler    = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshaler    = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// PublicDiscoverAPI serves the OpenRPC document of the apis of an endpoint
+type PublicDiscoverAPI struct {
+	doc *OpenRPCDocument
+}
+
+// Discover returns the OpenRPC document of the methods served by the endpoint
+func (s *PublicDiscoverAPI) Discover() *OpenRPCDocument {
+	return s.doc
+}
+
+// withDiscoverAPI returns apis with the rpc_discover method describing them
+func withDiscoverAPI(apis []rpc.API) []rpc.API {
+	discover := &PublicDiscoverAPI{}
+	apis = append(apis[:len(apis):len(apis)], rpc.API{
+		Namespace: rpc.MetadataApi,
+		Version:   apiVersion,
+		Service:   discover,
+		Public:    true,
+	})
+	discover.doc = NewOpenRPCDocument(apis)
+	return apis
+}
+
+// NewOpenRPCDocument describes the methods of apis and of the rpc_modules method every endpoint serves.
+func NewOpenRPCDocument(apis []rpc.API) *OpenRPCDocument {
+	g := &schemaGenerator{
+		names:   make(map[reflect.Type]string),
+		schemas: make(map[string]*JSONSchema),
+	}
+	doc := &OpenRPCDocument{
+		OpenRPC: openRPCVersion,
+		Info:    OpenRPCInfo{Title: apiTitle, Version: apiVersion},
+		Methods: make([]*OpenRPCMethod, 0),
+	}
+
+	apis = append([]rpc.API{{Namespace: rpc.MetadataApi, Service: &rpc.RPCService{}}}, apis...)
+	seen := make(map[string]bool)
+	for _, api := range apis {
+		typ := reflect.TypeOf(api.Service)
+		for i := 0; i < typ.NumMethod(); i++ {
+			m := typ.Method(i)
+			name := api.Namespace + "_" + formatName(m.Name)
+			if m.PkgPath != "" || seen[name] {
+				continue
+			}
+			if method := g.method(name, m.Type); method != nil {
+				seen[name] = true
+				doc.Methods = append(doc.Methods, method)
+			}
+		}
+	}
+	sort.Slice(doc.Methods, func(i, j int) bool { return doc.Methods[i].Name < doc.Methods[j].Name })
+	doc.Components.Schemas = g.schemas
+	return doc
+}
+
+// OpenRPC returns the OpenRPC document of all the apis of the node, as served over IPC
+func OpenRPC() *OpenRPCDocument {
+	apis := withDiscoverAPI(GetAPIs(nilBackend{}))
+	return apis[len(apis)-1].Service.(*PublicDiscoverAPI).doc
+}
+
+// nilBackend creates the api services for their description only
+type nilBackend struct{}
+
+func (nilBackend) GetDex() *dex.Dex            { return nil }
+func (nilBackend) GetDexDB() *dex.SQLDBBackend { return nil }
+func (nilBackend) GetConfig() *config.Config   { return nil }
+
+// formatName lowercases the first character like the rpc server does
+func formatName(name string) string {
+	ret := []rune(name)
+	if len(ret) > 0 {
+		ret[0] = unicode.ToLower(ret[0])
+	}
+	return string(ret)
+}
+
+type schemaGenerator struct {
+	names   map[reflect.Type]string // component names of the described structs
+	schemas map[string]*JSONSchema
+}
+
+// method describes a method of type mtype like the rpc server registers it,
+// it returns nil for the methods that are not served or are subscriptions.
+func (g *schemaGenerator) method(name string, mtype reflect.Type) *OpenRPCMethod {
+	firstArg := 1
+	if mtype.NumIn() >= 2 && mtype.In(1) == contextType {
+		firstArg = 2
+	}
+	outs := mtype.NumOut()
+	errPos := -1
+	for i := 0; i < outs; i++ {
+		if mtype.Out(i).Implements(errorType) {
+			errPos = i
+			break
+		}
+	}
+	if outs > 2 || (errPos >= 0 && errPos != outs-1) || (outs == 2 && errPos == -1) {
+		return nil
+	}
+	if outs == 2 && mtype.Out(0) == subscriptionType {
+		return nil
+	}
+
+	doc := methodDocs[name]
+	method := &OpenRPCMethod{
+		Name:           name,
+		Summary:        doc.summary,
+		ParamStructure: "by-position",
+		Params:         make([]*OpenRPCContentDescriptor, 0),
+	}
+	for i := firstArg; i < mtype.NumIn(); i++ {
+		argType := mtype.In(i)
+		param := &OpenRPCContentDescriptor{
+			Name: "param" + strconv.Itoa(i-firstArg),
+			// trailing pointer params may be omitted
+			Required: argType.Kind() != reflect.Ptr,
+			Schema:   g.schema(argType),
+		}
+		if n := i - firstArg; n < len(doc.params) {
+			param.Name = doc.params[n]
+		}
+		method.Params = append(method.Params, param)
+	}
+
+	method.Result = &OpenRPCContentDescriptor{Name: "result", Schema: &JSONSchema{Type: "null"}}
+	if outs > 0 && errPos != 0 {
+		method.Result.Schema = g.schema(mtype.Out(0))
+	}
+	return method
+}
+
+// schema describes the JSON encoding of t, structs are described once in the components
+func (g *schemaGenerator) schema(t reflect.Type) *JSONSchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if s, ok := knownSchemas[t]; ok {
+		return s
+	}
+	if reflect.PtrTo(t).Implements(jsonMarshaler) {
+		return &JSONSchema{}
+	}
+	if reflect.PtrTo(t).Implements(textMarshaler) {
+		return &JSONSchema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &JSONSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &JSONSchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &JSONSchema{Type: "number"}
+	case reflect.String:
+		return &JSONSchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &JSONSchema{Type: "string", Description: "base64 encoded bytes"}
+		}
+		return &JSONSchema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &JSONSchema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		return &JSONSchema{Ref: "#/components/schemas/" + g.component(t)}
+	}
+	return &JSONSchema{}
+}
+
+// component adds the schema of the struct t to the components and returns its name
+func (g *schemaGenerator) component(t reflect.Type) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+	name := t.Name()
+	if _, ok := g.schemas[name]; ok || name == "" {
+		name = path.Base(t.PkgPath()) + "." + t.Name()
+	}
+	g.names[t] = name
+
+	s := &JSONSchema{Type: "object", Properties: make(map[string]*JSONSchema)}
+	g.schemas[name] = s
+	g.fields(t, s)
+	return name
+}
+
+// fields adds the fields of the struct t to s like encoding/json encodes them
+func (g *schemaGenerator) fields(t reflect.Type, s *JSONSchema) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if idx := strings.Index(tag, ","); idx >= 0 {
+			name, opts = tag[:idx], tag[idx+1:]
+		}
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.fields(ft, s)
+				continue
+			}
+		}
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = g.schema(f.Type)
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Ptr {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
@@ -1,3 +1,8 @@
+// +build ignore
+
+// TestSelectAddress tests the PublicTransactionPoolAPI of the linkchain wallet rpc with the
+// mocks generated from it, neither is part of this package.
+
 package rpc
 
 import (
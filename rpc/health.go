@@ -0,0 +1,72 @@
+package rpc
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lianxiangcloud/lkdex/dex"
+)
+
+const (
+	healthPath = "/healthz"
+	readyPath  = "/readyz"
+
+	// readyCacheTTL is how long a /readyz result is served before the daemons are queried again
+	readyCacheTTL = 2 * time.Second
+)
+
+// newHealthHandler serves the probes of the HTTP endpoint before next, they are
+// not authenticated nor rate limited.
+//
+//	/healthz  200 while the rpc service is up
+//	/readyz   the sync status, 200 if the dex is ready, 503 otherwise
+func newHealthHandler(b Backend, next http.Handler) http.Handler {
+	ready := &readyProbe{b: b}
+	mux := http.NewServeMux()
+	mux.HandleFunc(healthPath, func(w http.ResponseWriter, r *http.Request) {
+		writeProbe(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	mux.HandleFunc(readyPath, func(w http.ResponseWriter, r *http.Request) {
+		status := ready.status(r)
+		code := http.StatusOK
+		if !status.Ready {
+			code = http.StatusServiceUnavailable
+		}
+		writeProbe(w, code, status)
+	})
+	mux.Handle("/", next)
+	return mux
+}
+
+// readyProbe caches the sync status for readyCacheTTL, so that the unlimited
+// probes do not turn into a daemon call each
+type readyProbe struct {
+	b Backend
+
+	mu      sync.Mutex // held while the status is queried, the probes meanwhile wait for it
+	last    *dex.SyncStatus
+	checked time.Time
+}
+
+func (p *readyProbe) status(r *http.Request) *dex.SyncStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.last != nil && time.Since(p.checked) < readyCacheTTL {
+		return p.last
+	}
+	status := p.b.GetDex().SyncStatus(r.Context())
+	// the status of a canceled probe is not the one of the daemons
+	if r.Context().Err() == nil {
+		p.last, p.checked = status, time.Now()
+	}
+	return status
+}
+
+func writeProbe(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("content-type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,39 @@
+package rpc
+
+import (
+	"net"
+
+	"github.com/lianxiangcloud/linkchain/libs/log"
+	"github.com/lianxiangcloud/linkchain/libs/rpc"
+)
+
+// startIPCEndpoint serves apis on the IPC endpoint like rpc.StartIPCEndpoint,
+// the errors are served with their data.
+func startIPCEndpoint(endpoint string, apis []rpc.API, metrics *Metrics, logger log.Logger) (net.Listener, *rpc.Server, error) {
+	handler := rpc.NewServer()
+	for _, api := range apis {
+		if err := handler.RegisterName(api.Namespace, api.Service); err != nil {
+			return nil, nil, err
+		}
+		logger.Debug("IPC registered", "namespace", api.Namespace)
+	}
+	listener, err := ipcListen(endpoint)
+	if err != nil {
+		handler.Stop()
+		return nil, nil, err
+	}
+	go serveListener(handler, listener, metrics, logger)
+	return listener, handler, nil
+}
+
+// serveListener serves the connections of l until it is closed
+func serveListener(srv *rpc.Server, l net.Listener, metrics *Metrics, logger log.Logger) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		logger.Trace("Accepted connection", "addr", conn.RemoteAddr())
+		go srv.ServeCodec(newServerCodec(conn, metrics), rpc.OptionMethodInvocation|rpc.OptionSubscriptions)
+	}
+}
@@ -0,0 +1,14 @@
+// +build windows
+
+package rpc
+
+import (
+	"net"
+
+	"gopkg.in/natefinch/npipe.v2"
+)
+
+// ipcListen will create a named pipe on the given endpoint.
+func ipcListen(endpoint string) (net.Listener, error) {
+	return npipe.Listen(endpoint)
+}
@@ -0,0 +1,192 @@
+package rpc
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lianxiangcloud/linkchain/libs/log"
+	"github.com/lianxiangcloud/lkdex/config"
+)
+
+const (
+	errCodeLimitExceeded = -32005
+
+	bucketPruneInterval = time.Minute
+)
+
+var (
+	errRateLimited     = errors.New("rate limit exceeded")
+	errTooManyRequests = errors.New("too many requests in flight")
+)
+
+// tokenBucket allows rate requests per second with bursts of burst requests
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int, now time.Time) *tokenBucket {
+	b := float64(burst)
+	if b < 1 {
+		b = math.Max(1, math.Ceil(rate))
+	}
+	return &tokenBucket{rate: rate, burst: b, tokens: b, last: now}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// take takes a token if one is left
+func (b *tokenBucket) take(now time.Time) bool {
+	b.refill(now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// full reports whether the bucket would be full at now, so it can be dropped
+func (b *tokenBucket) full(now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.burst
+}
+
+// limiter enforces the per client and per method rate limits of the HTTP and WS
+// endpoints and caps the number of requests served at the same time.
+type limiter struct {
+	logger      log.Logger
+	rate        float64            // requests per second of a client, 0 for no limit
+	burst       int                // burst of a client
+	methodRates map[string]float64 // requests per second of a client per method, by lowercase method
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket // by client and client/method
+	lastPrune time.Time
+
+	slots chan struct{} // in flight requests, nil for no limit
+}
+
+func newLimiter(cfg *config.Config, logger log.Logger) *limiter {
+	l := &limiter{
+		logger:      logger,
+		rate:        cfg.RPC.RateLimit,
+		burst:       cfg.RPC.RateBurst,
+		methodRates: make(map[string]float64),
+		buckets:     make(map[string]*tokenBucket),
+		lastPrune:   time.Now(),
+	}
+	// viper lowercases map keys, so methods are matched lowercase
+	for m, rate := range cfg.RPC.MethodRateLimits {
+		if rate > 0 {
+			l.methodRates[strings.ToLower(m)] = rate
+		}
+	}
+	if cfg.MaxConcurrency > 0 {
+		l.slots = make(chan struct{}, cfg.MaxConcurrency)
+	}
+	return l
+}
+
+// allow takes a token of client and of client per method for each call
+func (l *limiter) allow(client string, calls []rpcCall) error {
+	if l.rate <= 0 && len(l.methodRates) == 0 {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastPrune) > bucketPruneInterval {
+		for key, b := range l.buckets {
+			if b.full(now) {
+				delete(l.buckets, key)
+			}
+		}
+		l.lastPrune = now
+	}
+
+	for _, c := range calls {
+		if l.rate > 0 && !l.bucket(client, l.rate, l.burst, now).take(now) {
+			return errRateLimited
+		}
+		method := strings.ToLower(c.Method)
+		if rate, ok := l.methodRates[method]; ok && !l.bucket(client+"/"+method, rate, 0, now).take(now) {
+			return errRateLimited
+		}
+	}
+	return nil
+}
+
+func (l *limiter) bucket(key string, rate float64, burst int, now time.Time) *tokenBucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		b = newTokenBucket(rate, burst, now)
+		l.buckets[key] = b
+	}
+	return b
+}
+
+// acquire takes an in flight slot without waiting, release must be called when it returns true
+func (l *limiter) acquire() bool {
+	if l.slots == nil {
+		return true
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *limiter) release() {
+	if l.slots != nil {
+		<-l.slots
+	}
+}
+
+// httpHandler rejects HTTP requests over the rate limits or the in flight cap, and those
+// whose body can not be parsed. A request without body counts as one call without method.
+func (l *limiter) httpHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls, batch := []rpcCall{{}}, false
+		if r.Body != nil {
+			body, err := peekBody(w, r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+				return
+			}
+			if len(bytes.TrimSpace(body)) > 0 {
+				parsed, isBatch, err := parseCalls(body)
+				if err != nil {
+					writeRPCError(w, http.StatusBadRequest, nil, false, errCodeParseError, errParseRequest)
+					return
+				}
+				calls, batch = parsed, isBatch
+			}
+		}
+
+		client := clientIP(r.RemoteAddr)
+		if err := l.allow(client, calls); err != nil {
+			l.logger.Debug("RPC rate limited", "client", client, "method", calls[0].Method)
+			writeRPCError(w, http.StatusTooManyRequests, calls, batch, errCodeLimitExceeded, err)
+			return
+		}
+		if !l.acquire() {
+			l.logger.Debug("RPC in flight cap reached", "client", client, "method", calls[0].Method)
+			writeRPCError(w, http.StatusServiceUnavailable, calls, batch, errCodeLimitExceeded, errTooManyRequests)
+			return
+		}
+		defer l.release()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,250 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lianxiangcloud/linkchain/libs/log"
+	"github.com/lianxiangcloud/linkchain/libs/rpc"
+	"github.com/lianxiangcloud/lkdex/config"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/websocket"
+)
+
+func TestTokenBucket(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Unix(1000, 0)
+	b := newTokenBucket(2, 3, now)
+	for i := 0; i < 3; i++ {
+		assert.True(b.take(now), "burst %d", i)
+	}
+	assert.False(b.take(now))
+	assert.False(b.full(now))
+
+	//2 tokens per second
+	assert.False(b.take(now.Add(400*time.Millisecond)))
+	assert.True(b.take(now.Add(500 * time.Millisecond)))
+	assert.False(b.take(now.Add(500 * time.Millisecond)))
+	assert.True(b.take(now.Add(time.Second)))
+
+	//refilled up to the burst only
+	later := now.Add(time.Hour)
+	assert.True(b.full(later))
+	for i := 0; i < 3; i++ {
+		assert.True(b.take(later), "burst %d", i)
+	}
+	assert.False(b.take(later))
+
+	//the burst defaults to the rate
+	b = newTokenBucket(0.5, 0, now)
+	assert.True(b.take(now))
+	assert.False(b.take(now))
+	assert.True(b.take(now.Add(2 * time.Second)))
+}
+
+func newTestLimiter(rate float64, burst int, methodRates map[string]float64, concurrency int) *limiter {
+	cfg := config.DefaultConfig()
+	cfg.RPC.RateLimit = rate
+	cfg.RPC.RateBurst = burst
+	cfg.RPC.MethodRateLimits = methodRates
+	cfg.MaxConcurrency = concurrency
+	return newLimiter(cfg, log.NewNopLogger())
+}
+
+func TestLimiterAllow(t *testing.T) {
+	assert := assert.New(t)
+	l := newTestLimiter(0, 0, map[string]float64{"wlt_postOrder": 1}, 0)
+	post, get := []rpcCall{{Method: "wlt_postOrder"}}, []rpcCall{{Method: "dex_getOrder"}}
+
+	//the method limit is per client and matched case insensitively
+	assert.Nil(l.allow("a", post))
+	assert.Equal(errRateLimited, l.allow("a", []rpcCall{{Method: "WLT_POSTORDER"}}))
+	assert.Nil(l.allow("b", post))
+	for i := 0; i < 10; i++ {
+		assert.Nil(l.allow("a", get))
+	}
+
+	//each call of a batch takes a token of the client
+	l = newTestLimiter(1, 2, nil, 0)
+	assert.Equal(errRateLimited, l.allow("a", []rpcCall{{}, {}, {}}))
+	l = newTestLimiter(1, 2, nil, 0)
+	assert.Nil(l.allow("a", []rpcCall{{}, {}}))
+	assert.Equal(errRateLimited, l.allow("a", get))
+	assert.Nil(l.allow("b", get))
+
+	//no limit
+	l = newTestLimiter(0, 0, nil, 0)
+	for i := 0; i < 1000; i++ {
+		assert.Nil(l.allow("a", post))
+	}
+}
+
+func TestLimiterHTTPHandler(t *testing.T) {
+	assert := assert.New(t)
+	l := newTestLimiter(0, 0, map[string]float64{"dex_getOrder": 1}, 1)
+	block, served := make(chan struct{}), make(chan struct{})
+	handler := l.httpHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Block") != "" {
+			served <- struct{}{}
+			<-block
+		}
+	}))
+	serve := func(body string, blocked bool) (int, *jsonErrResponse) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		if blocked {
+			req.Header.Set("X-Block", "1")
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Body.Len() == 0 {
+			return rec.Code, nil
+		}
+		resp := &jsonErrResponse{}
+		assert.Nil(json.Unmarshal(rec.Body.Bytes(), resp))
+		return rec.Code, resp
+	}
+
+	code, resp := serve(`{"id":1,"method":"dex_getOrder"}`, false)
+	assert.Equal(http.StatusOK, code)
+	assert.Nil(resp)
+	code, resp = serve(`{"id":2,"method":"dex_getOrder"}`, false)
+	assert.Equal(http.StatusTooManyRequests, code)
+	assert.Equal(errCodeLimitExceeded, resp.Error.Code)
+	assert.Equal(json.RawMessage("2"), resp.ID)
+	code, resp = serve(`{"id":3,"method":`, false)
+	assert.Equal(http.StatusBadRequest, code)
+	assert.Equal(errCodeParseError, resp.Error.Code)
+
+	//the only slot is held by a blocked request
+	done := make(chan int)
+	go func() {
+		code, _ := serve(`{"id":4,"method":"dex_getOrderHash"}`, true)
+		done <- code
+	}()
+	<-served
+	code, resp = serve(`{"id":5,"method":"dex_getOrderHash"}`, false)
+	assert.Equal(http.StatusServiceUnavailable, code)
+	assert.Equal(errCodeLimitExceeded, resp.Error.Code)
+	assert.Equal(errTooManyRequests.Error(), resp.Error.Message)
+	close(block)
+	assert.Equal(http.StatusOK, <-done)
+	code, _ = serve(`{"id":6,"method":"dex_getOrderHash"}`, false)
+	assert.Equal(http.StatusOK, code)
+}
+
+// TestService is served over WS by TestLimitedConn, Block returns when unblock is sent to
+type TestService struct {
+	called  chan struct{}
+	unblock chan struct{}
+}
+
+func (s *TestService) Echo(v string) string {
+	return v
+}
+
+func (s *TestService) Block(ctx context.Context) string {
+	s.called <- struct{}{}
+	select {
+	case <-s.unblock:
+	case <-ctx.Done():
+	}
+	return "unblocked"
+}
+
+func TestLimitedConn(t *testing.T) {
+	assert := assert.New(t)
+	l := newTestLimiter(0, 0, nil, 1)
+	service := &TestService{called: make(chan struct{}, 1), unblock: make(chan struct{})}
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("test", service); err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Stop()
+	ts := httptest.NewServer(websocketHandler(srv, nil, l, NopMetrics()))
+	defer ts.Close()
+	dial := func() *websocket.Conn {
+		conn, err := websocket.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), "", "http://localhost")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+	conn := dial()
+	defer func() { conn.Close() }()
+
+	type response struct {
+		ID     json.RawMessage `json:"id"`
+		Result string          `json:"result"`
+		Error  *jsonError      `json:"error"`
+	}
+	call := func(msg string) *response {
+		assert.Nil(websocket.Message.Send(conn, msg))
+		resp := &response{}
+		assert.Nil(websocket.JSON.Receive(conn, resp))
+		return resp
+	}
+	slotsFreed := func() bool {
+		for i := 0; i < 100 && len(l.slots) > 0; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		return len(l.slots) == 0
+	}
+
+	//a response releases the slot
+	for i := 1; i <= 3; i++ {
+		resp := call(`{"jsonrpc":"2.0","id":` + strconv.Itoa(i) + `,"method":"test_echo","params":["hi"]}`)
+		assert.Nil(resp.Error)
+		assert.Equal("hi", resp.Result)
+	}
+	assert.True(slotsFreed())
+
+	//a message without id holds no slot, the server answers it with an error and closes the connection
+	resp := call(`{"jsonrpc":"2.0","method":"test_echo","params":["hi"]}`)
+	if assert.NotNil(resp.Error) {
+		assert.Equal(errCodeParseError, resp.Error.Code)
+	}
+	assert.True(slotsFreed())
+	conn.Close()
+	conn = dial()
+	resp = call(`{"jsonrpc":"2.0","id":"a","method":"test_echo","params":["hi"]}`)
+	assert.Nil(resp.Error)
+	assert.Equal(`"a"`, string(resp.ID))
+
+	//a request waiting for its response holds the slot
+	assert.Nil(websocket.Message.Send(conn, `{"jsonrpc":"2.0","id":10,"method":"test_block","params":[]}`))
+	<-service.called
+	resp = call(`{"jsonrpc":"2.0","id":11,"method":"test_echo","params":["hi"]}`)
+	assert.Equal("11", string(resp.ID))
+	if assert.NotNil(resp.Error) {
+		assert.Equal(errCodeLimitExceeded, resp.Error.Code)
+		assert.Equal(errTooManyRequests.Error(), resp.Error.Message)
+	}
+	resp = call(`{"jsonrpc":"2.0","id":12,"method":`)
+	if assert.NotNil(resp.Error) {
+		assert.Equal(errCodeParseError, resp.Error.Code)
+	}
+	service.unblock <- struct{}{}
+	resp = &response{}
+	assert.Nil(websocket.JSON.Receive(conn, resp))
+	assert.Equal("10", string(resp.ID))
+	assert.Equal("unblocked", resp.Result)
+	assert.True(slotsFreed())
+
+	//the slot of a request left unanswered by a closed connection is released when its call returns
+	other := dial()
+	assert.Nil(websocket.Message.Send(other, `{"jsonrpc":"2.0","id":20,"method":"test_block","params":[]}`))
+	<-service.called
+	other.Close()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(1, len(l.slots))
+	service.unblock <- struct{}{}
+	assert.True(slotsFreed())
+	resp = call(`{"jsonrpc":"2.0","id":21,"method":"test_echo","params":["hi"]}`)
+	assert.Nil(resp.Error)
+}
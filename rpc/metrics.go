@@ -0,0 +1,46 @@
+package rpc
+
+import (
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/discard"
+
+	prometheus "github.com/go-kit/kit/metrics/prometheus"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+)
+
+// MetricsSubsystem is the subsystem of the rpc metrics
+const MetricsSubsystem = "rpc"
+
+// Metrics contains metrics exposed by this package.
+type Metrics struct {
+	// Number of JSON-RPC calls served, by method and status ("ok" or the error code).
+	Requests metrics.Counter
+	// Time to serve a JSON-RPC call in seconds, by method.
+	RequestDuration metrics.Histogram
+}
+
+// PrometheusMetrics returns Metrics build using Prometheus client library.
+func PrometheusMetrics(namespace string) *Metrics {
+	return &Metrics{
+		Requests: prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: MetricsSubsystem,
+			Name:      "requests_total",
+			Help:      "Number of JSON-RPC calls served.",
+		}, []string{"method", "status"}),
+		RequestDuration: prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: MetricsSubsystem,
+			Name:      "request_duration_seconds",
+			Help:      "Time to serve a JSON-RPC call in seconds.",
+		}, []string{"method"}),
+	}
+}
+
+// NopMetrics returns no-op Metrics.
+func NopMetrics() *Metrics {
+	return &Metrics{
+		Requests:        discard.NewCounter(),
+		RequestDuration: discard.NewHistogram(),
+	}
+}
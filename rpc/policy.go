@@ -0,0 +1,80 @@
+package rpc
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lianxiangcloud/linkchain/libs/common"
+	"github.com/lianxiangcloud/lkdex/config"
+	"github.com/lianxiangcloud/lkdex/types"
+)
+
+// walletPolicy is a parsed config.WalletPolicy, enforced by PrivateWalletAPI
+type walletPolicy struct {
+	subject   string
+	addresses map[common.Address]bool // nil allows all
+	methods   map[string]bool         // nil allows all
+}
+
+func newWalletPolicy(cfg *config.WalletPolicy) (*walletPolicy, error) {
+	if cfg.Subject == "" {
+		return nil, fmt.Errorf("wallet policy: empty subject")
+	}
+	p := &walletPolicy{subject: cfg.Subject}
+	if len(cfg.Addresses) > 0 {
+		p.addresses = make(map[common.Address]bool)
+		for _, a := range cfg.Addresses {
+			if !common.IsHexAddress(a) {
+				return nil, fmt.Errorf("wallet policy %s: invalid address %s", cfg.Subject, a)
+			}
+			p.addresses[common.HexToAddress(a)] = true
+		}
+	}
+	if len(cfg.Methods) > 0 {
+		p.methods = make(map[string]bool)
+		for _, m := range cfg.Methods {
+			p.methods[strings.TrimPrefix(m, "wlt_")] = true
+		}
+	}
+	return p, nil
+}
+
+// newWalletPolicies parses the policies of cfg keyed by subject
+func newWalletPolicies(cfg []config.WalletPolicy) (map[string]*walletPolicy, error) {
+	policies := make(map[string]*walletPolicy)
+	for i := range cfg {
+		p, err := newWalletPolicy(&cfg[i])
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := policies[p.subject]; ok {
+			return nil, fmt.Errorf("wallet policy %s: duplicated subject", p.subject)
+		}
+		policies[p.subject] = p
+	}
+	return policies, nil
+}
+
+// allow checks that method may be called on the accounts addrs
+func (p *walletPolicy) allow(method string, addrs ...common.Address) error {
+	if p.methods != nil && !p.methods[method] {
+		return types.ErrMethodDenied
+	}
+	if p.addresses == nil {
+		return nil
+	}
+	for _, a := range addrs {
+		if !p.addresses[a] {
+			return types.ErrAccountDenied
+		}
+	}
+	return nil
+}
+
+// maskedSubject returns the subject for logs, an api key subject must not be logged in full
+func (p *walletPolicy) maskedSubject() string {
+	if len(p.subject) <= 4 {
+		return "****"
+	}
+	return p.subject[:4] + "****"
+}
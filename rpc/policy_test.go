@@ -0,0 +1,70 @@
+package rpc
+
+import (
+	"testing"
+
+	"github.com/lianxiangcloud/linkchain/libs/common"
+	"github.com/lianxiangcloud/lkdex/config"
+	"github.com/lianxiangcloud/lkdex/dex"
+	"github.com/lianxiangcloud/lkdex/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWalletPolicy(t *testing.T) {
+	assert := assert.New(t)
+	allowed := common.HexToAddress("0xa73810e519e1075010678d706533486d8ecc8000")
+	other := common.HexToAddress("0xa73810e519e1075010678d706533486d8ecc8001")
+	policies, err := newWalletPolicies([]config.WalletPolicy{
+		{Subject: "alice", Addresses: []string{allowed.Hex()}, Methods: []string{"wlt_postOrder", "cancelOrder"}},
+		{Subject: "bob", Methods: []string{"wlt_deposit"}},
+		{Subject: "carol", Addresses: []string{allowed.Hex()}},
+	})
+	assert.Nil(err)
+
+	alice, bob, carol := policies["alice"], policies["bob"], policies["carol"]
+	assert.Nil(alice.allow("postOrder", allowed))
+	assert.Nil(alice.allow("cancelOrder", allowed))
+	assert.Equal(types.ErrMethodDenied, alice.allow("withdraw", allowed))
+	assert.Equal(types.ErrAccountDenied, alice.allow("postOrder", other))
+	assert.Equal(types.ErrAccountDenied, alice.allow("postOrder", allowed, other))
+	assert.Nil(bob.allow("deposit", other))
+	assert.Equal(types.ErrMethodDenied, bob.allow("withdraw", allowed))
+	assert.Nil(carol.allow("withdraw", allowed))
+	assert.Equal(types.ErrAccountDenied, carol.allow("withdraw", other))
+	assert.Equal("alic****", alice.maskedSubject())
+	assert.Equal("****", bob.maskedSubject())
+
+	for _, cfg := range [][]config.WalletPolicy{
+		{{Subject: ""}},
+		{{Subject: "alice", Addresses: []string{"0x01"}}},
+		{{Subject: "alice"}, {Subject: "alice"}},
+	} {
+		_, err := newWalletPolicies(cfg)
+		assert.NotNil(err)
+	}
+}
+
+// testBackend is a Backend without dex, for the apis not called in a test
+type testBackend struct{}
+
+func (testBackend) GetDex() *dex.Dex            { return nil }
+func (testBackend) GetDexDB() *dex.SQLDBBackend { return nil }
+func (testBackend) GetConfig() *config.Config   { return config.DefaultConfig() }
+
+func TestRestrictedAPIs(t *testing.T) {
+	assert := assert.New(t)
+	apis := GetAPIs(testBackend{})
+	policy := &walletPolicy{subject: "alice"}
+	restricted := restrictedAPIs(testBackend{}, apis, policy)
+	assert.Equal(len(apis), len(restricted))
+	for i, api := range restricted {
+		assert.Equal(apis[i].Namespace, api.Namespace)
+		if api.Namespace != "wlt" {
+			assert.Equal(apis[i].Service, api.Service)
+			continue
+		}
+		assert.Equal(policy, api.Service.(*PrivateWalletAPI).policy)
+		//the unrestricted apis are left alone
+		assert.Nil(apis[i].Service.(*PrivateWalletAPI).policy)
+	}
+}
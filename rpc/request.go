@@ -0,0 +1,113 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const (
+	// maxPeekBodyLength bounds the request body read to find the called methods
+	maxPeekBodyLength = 5 * 1024 * 1024
+
+	errCodeParseError = -32700
+)
+
+// errParseRequest is served for a request that can not be parsed as a whole: the rpc
+// server decodes the first JSON value only, so it would serve calls the checks did not see.
+var errParseRequest = errors.New("parse error: invalid JSON-RPC request")
+
+// rpcCall is the part of a JSON-RPC request needed to check it before it is served
+type rpcCall struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+}
+
+// module returns the namespace of the called method
+func (c *rpcCall) module() string {
+	if i := strings.Index(c.Method, "_"); i >= 0 {
+		return c.Method[:i]
+	}
+	return c.Method
+}
+
+// parseCalls parses a single or non-empty batch request
+func parseCalls(body []byte) ([]rpcCall, bool, error) {
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var calls []rpcCall
+		if err := json.Unmarshal(body, &calls); err != nil {
+			return nil, true, err
+		}
+		if len(calls) == 0 {
+			return nil, true, errParseRequest
+		}
+		return calls, true, nil
+	}
+	var call rpcCall
+	if err := json.Unmarshal(body, &call); err != nil {
+		return nil, false, err
+	}
+	return []rpcCall{call}, false, nil
+}
+
+// peekBody reads the body of r and puts it back for the next handler
+func peekBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxPeekBodyLength))
+	if err != nil {
+		return nil, err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// clientIP returns the ip of a remote address
+func clientIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+type jsonError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type jsonErrResponse struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Error   jsonError       `json:"error"`
+}
+
+// errorResponses builds the error responses of calls, an array for a batch
+func errorResponses(calls []rpcCall, batch bool, code int, err error) interface{} {
+	resps := make([]*jsonErrResponse, 0, len(calls))
+	for _, c := range calls {
+		id := c.ID
+		if len(id) == 0 {
+			id = json.RawMessage("null")
+		}
+		resps = append(resps, &jsonErrResponse{Version: "2.0", ID: id, Error: jsonError{Code: code, Message: err.Error()}})
+	}
+	if batch || len(resps) == 0 {
+		return resps
+	}
+	return resps[0]
+}
+
+// writeRPCError writes the error responses of calls with HTTP status,
+// a single response with null id if calls is empty
+func writeRPCError(w http.ResponseWriter, status int, calls []rpcCall, batch bool, code int, err error) {
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	if len(calls) == 0 {
+		calls, batch = []rpcCall{{}}, false
+	}
+	json.NewEncoder(w).Encode(errorResponses(calls, batch, code, err))
+}
@@ -0,0 +1,510 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lianxiangcloud/linkchain/libs/common"
+	"github.com/lianxiangcloud/linkchain/libs/hexutil"
+	"github.com/lianxiangcloud/linkchain/libs/log"
+	"github.com/lianxiangcloud/lkdex/dex"
+	"github.com/lianxiangcloud/lkdex/types"
+)
+
+const (
+	restPrefix = "/v1/"
+
+	restMaxAge       = 2 // seconds clients may cache a response
+	restDefaultLimit = 50
+	restMaxLimit     = 500
+	restPriceDigits  = 18
+)
+
+var (
+	errRESTNotFound      = errors.New("not found")
+	errRESTOrderNotFound = errors.New("order is not exist")
+	errRESTBadAddress    = errors.New("invalid address")
+	errRESTBadHash       = errors.New("invalid hash")
+	errRESTBadLimit      = errors.New("invalid limit")
+	errRESTTooManyTokens = errors.New("too many tokens")
+)
+
+// restAPI serves read only market data as plain HTTP GET resources under /v1/,
+// next to the JSON-RPC handler of the HTTP endpoint.
+type restAPI struct {
+	dex    *dex.Dex
+	dexDB  *dex.SQLDBBackend
+	logger log.Logger
+
+	maxTokens int // of a balances query, 0 for no limit
+
+	allowAllOrigins bool
+	origins         map[string]bool
+}
+
+func newRESTAPI(b Backend, cors []string, logger log.Logger) *restAPI {
+	api := &restAPI{
+		dex:     b.GetDex(),
+		dexDB:   b.GetDexDB(),
+		logger:    logger,
+		maxTokens: maxBatchQueries(b),
+		origins:   make(map[string]bool),
+	}
+	for _, origin := range cors {
+		if origin == "*" {
+			api.allowAllOrigins = true
+		}
+		api.origins[strings.ToLower(origin)] = true
+	}
+	return api
+}
+
+// ServeHTTP routes
+//
+//	/v1/pairs
+//	/v1/orderbook/{base}/{quote}?depth=
+//	/v1/orders/{hash}
+//	/v1/trades?order=&taker=&base=&quote=&limit=&offset=
+//	/v1/balances/{address}?tokens=
+func (api *restAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.setCORS(w, r)
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodOptions:
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		writeRESTError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, restPrefix), "/"), "/")
+	var (
+		ret interface{}
+		err error
+	)
+	switch {
+	case parts[0] == "pairs" && len(parts) == 1:
+		ret, err = api.pairs()
+	case parts[0] == "orderbook" && len(parts) == 3:
+		ret, err = api.orderbook(parts[1], parts[2], r.URL.Query().Get("depth"))
+	case parts[0] == "orders" && len(parts) == 2:
+		ret, err = api.order(parts[1])
+	case parts[0] == "trades" && len(parts) == 1:
+		ret, err = api.trades(r.URL.Query())
+	case parts[0] == "balances" && len(parts) == 2:
+		ret, err = api.balances(r.Context(), parts[1], r.URL.Query().Get("tokens"))
+	default:
+		err = errRESTNotFound
+	}
+
+	switch err {
+	case nil:
+	case errRESTNotFound, errRESTOrderNotFound:
+		writeRESTError(w, http.StatusNotFound, err)
+		return
+	case errRESTBadAddress, errRESTBadHash, errRESTBadLimit, errRESTTooManyTokens:
+		writeRESTError(w, http.StatusBadRequest, err)
+		return
+	default:
+		api.logger.Error("REST request fail", "path", r.URL.Path, "err", err)
+		writeRESTError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("content-type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(restMaxAge))
+	json.NewEncoder(w).Encode(ret)
+}
+
+func (api *restAPI) setCORS(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return
+	}
+	w.Header().Add("Vary", "Origin")
+	if api.allowAllOrigins {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	} else if api.origins[strings.ToLower(origin)] {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+	} else {
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+	w.Header().Set("Access-Control-Max-Age", "600")
+}
+
+func writeRESTError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// RESTOrderbookEntry is an open order of the orderbook of a base/quote pair
+type RESTOrderbookEntry struct {
+	OrderHash common.Hash    `json:"orderHash"`
+	Maker     common.Address `json:"maker"`
+	Price     string         `json:"price"`  // quote amount per base amount
+	Amount    string         `json:"amount"` // remaining base amount
+	Expires   uint64         `json:"expires"`
+}
+
+// RESTOrderbook lists asks by ascending and bids by descending price
+type RESTOrderbook struct {
+	Base  common.Address        `json:"base"`
+	Quote common.Address        `json:"quote"`
+	Asks  []*RESTOrderbookEntry `json:"asks"`
+	Bids  []*RESTOrderbookEntry `json:"bids"`
+}
+
+// RESTOrder is an indexed order with its state
+type RESTOrder struct {
+	Hash         common.Hash    `json:"hash"`
+	TokenGet     common.Address `json:"tokenGet"`
+	AmountGet    string         `json:"amountGet"`
+	TokenGive    common.Address `json:"tokenGive"`
+	AmountGive   string         `json:"amountGive"`
+	Expires      uint64         `json:"expires"`
+	Nonce        uint64         `json:"nonce"`
+	Maker        common.Address `json:"maker"`
+	V            *hexutil.Big   `json:"v"`
+	R            *hexutil.Big   `json:"r"`
+	S            *hexutil.Big   `json:"s"`
+	State        string         `json:"state"` // sending|open|filled|expired|canceled
+	FilledAmount string         `json:"filledAmount"`
+}
+
+// RESTTrade is a trade of an order, amounts are in tokenGet and tokenGive of the order
+type RESTTrade struct {
+	OrderHash    common.Hash    `json:"orderHash"`
+	TxHash       common.Hash    `json:"txHash"`
+	BlockNumber  uint64         `json:"blockNumber"`
+	Maker        common.Address `json:"maker"`
+	Taker        common.Address `json:"taker"`
+	TokenGet     common.Address `json:"tokenGet"`
+	TokenGive    common.Address `json:"tokenGive"`
+	AmountGet    string         `json:"amountGet"`    // tokenGet paid by the taker
+	AmountGive   string         `json:"amountGive"`   // tokenGive paid by the maker
+	FilledAmount string         `json:"filledAmount"` // filled tokenGet of the order after the trade
+}
+
+// RESTBalance is the deposit of an account in the dex contract
+type RESTBalance struct {
+	Token  common.Address `json:"token"`
+	Amount string         `json:"amount"`
+}
+
+func (api *restAPI) pairs() ([]*types.TokenPair, error) {
+	pairs, err := api.dexDB.QueryTokenPairs()
+	if err != nil {
+		return nil, err
+	}
+	if pairs == nil {
+		pairs = []*types.TokenPair{}
+	}
+	return pairs, nil
+}
+
+func (api *restAPI) orderbook(baseHex, quoteHex, depthStr string) (*RESTOrderbook, error) {
+	base, err := parseRESTAddress(baseHex)
+	if err != nil {
+		return nil, err
+	}
+	quote, err := parseRESTAddress(quoteHex)
+	if err != nil {
+		return nil, err
+	}
+	depth, err := parseRESTLimit(depthStr)
+	if err != nil {
+		return nil, err
+	}
+
+	now := uint64(time.Now().Unix())
+	book := &RESTOrderbook{Base: base, Quote: quote}
+
+	// asks give base for quote, stored price base/quote ascending is quote/base descending
+	asks, err := api.dexDB.QueryOpenOrdersByTxPair(quote, base, now)
+	if err != nil {
+		return nil, err
+	}
+	book.Asks = make([]*RESTOrderbookEntry, 0, depth)
+	for i := len(asks) - 1; i >= 0 && len(book.Asks) < depth; i-- {
+		o := asks[i]
+		amountGet, amountGive, filled := orderAmounts(o)
+		if amountGet.Sign() == 0 || amountGive.Sign() == 0 {
+			continue
+		}
+		remain := new(big.Int).Sub(amountGet, filled)
+		book.Asks = append(book.Asks, &RESTOrderbookEntry{
+			OrderHash: common.HexToHash(o.HashID),
+			Maker:     common.HexToAddress(o.Maker),
+			Price:     formatRatio(amountGet, amountGive),
+			Amount:    new(big.Int).Div(new(big.Int).Mul(remain, amountGive), amountGet).String(),
+			Expires:   uint64(o.Expires.Int64),
+		})
+	}
+
+	// bids give quote for base, stored price quote/base ascending
+	bids, err := api.dexDB.QueryOpenOrdersByTxPair(base, quote, now)
+	if err != nil {
+		return nil, err
+	}
+	book.Bids = make([]*RESTOrderbookEntry, 0, depth)
+	for i := len(bids) - 1; i >= 0 && len(book.Bids) < depth; i-- {
+		o := bids[i]
+		amountGet, amountGive, filled := orderAmounts(o)
+		if amountGet.Sign() == 0 || amountGive.Sign() == 0 {
+			continue
+		}
+		book.Bids = append(book.Bids, &RESTOrderbookEntry{
+			OrderHash: common.HexToHash(o.HashID),
+			Maker:     common.HexToAddress(o.Maker),
+			Price:     formatRatio(amountGive, amountGet),
+			Amount:    new(big.Int).Sub(amountGet, filled).String(),
+			Expires:   uint64(o.Expires.Int64),
+		})
+	}
+	return book, nil
+}
+
+func (api *restAPI) order(hashHex string) (*RESTOrder, error) {
+	hash, err := parseRESTHash(hashHex)
+	if err != nil {
+		return nil, err
+	}
+	model, err := api.dexDB.ReadOrderModel(hash)
+	if err != nil {
+		return nil, err
+	}
+	if model == nil {
+		return nil, errRESTOrderNotFound
+	}
+	order, err := model.ToSignOrder()
+	if err != nil {
+		return nil, err
+	}
+	amountGet, _, filled := orderAmounts(model)
+
+	state := "open"
+	switch {
+	case model.State.Int64 == dex.Sending:
+		state = "sending"
+	case model.State.Int64 == dex.Finish:
+		state = "canceled"
+	case filled.Cmp(amountGet) >= 0:
+		state = "filled"
+	case uint64(model.Expires.Int64) <= uint64(time.Now().Unix()):
+		state = "expired"
+	}
+	return &RESTOrder{
+		Hash:         hash,
+		TokenGet:     order.TokenGet,
+		AmountGet:    order.AmountGet.ToInt().String(),
+		TokenGive:    order.TokenGive,
+		AmountGive:   order.AmountGive.ToInt().String(),
+		Expires:      uint64(order.Expires),
+		Nonce:        uint64(order.Nonce),
+		Maker:        order.Maker,
+		V:            order.V,
+		R:            order.R,
+		S:            order.S,
+		State:        state,
+		FilledAmount: filled.String(),
+	}, nil
+}
+
+func (api *restAPI) trades(q map[string][]string) ([]*RESTTrade, error) {
+	get := func(key string) string {
+		if v := q[key]; len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+
+	filter := &dex.TradeFilter{}
+	if s := get("order"); s != "" {
+		hash, err := parseRESTHash(s)
+		if err != nil {
+			return nil, err
+		}
+		filter.OrderHash = &hash
+	}
+	if s := get("taker"); s != "" {
+		taker, err := parseRESTAddress(s)
+		if err != nil {
+			return nil, err
+		}
+		filter.Taker = &taker
+	}
+	if base, quote := get("base"), get("quote"); base != "" || quote != "" {
+		baseAddr, err := parseRESTAddress(base)
+		if err != nil {
+			return nil, err
+		}
+		quoteAddr, err := parseRESTAddress(quote)
+		if err != nil {
+			return nil, err
+		}
+		filter.Pair = &types.TokenPair{TokenGet: baseAddr, TokenGive: quoteAddr}
+	}
+	limit, err := parseRESTLimit(get("limit"))
+	if err != nil {
+		return nil, err
+	}
+	var offset uint64
+	if s := get("offset"); s != "" {
+		if offset, err = strconv.ParseUint(s, 10, 64); err != nil {
+			return nil, errRESTBadLimit
+		}
+	}
+
+	records, err := api.dexDB.QueryTrades(filter, offset, uint64(limit))
+	if err != nil {
+		return nil, err
+	}
+	rets := make([]*RESTTrade, 0, len(records))
+	for _, t := range records {
+		amountGet, _ := new(big.Int).SetString(t.AmountGet, 0)
+		amountGive, _ := new(big.Int).SetString(t.AmountGive, 0)
+		deal, _ := new(big.Int).SetString(t.DealAmount, 0)
+		filled, _ := new(big.Int).SetString(t.FilledAmount, 0)
+		if amountGet == nil || amountGive == nil || deal == nil || filled == nil || amountGet.Sign() == 0 {
+			api.logger.Debug("REST skip trade", "order", t.HashID, "tx", t.TxHash)
+			continue
+		}
+		rets = append(rets, &RESTTrade{
+			OrderHash:    common.HexToHash(t.HashID),
+			TxHash:       common.HexToHash(t.TxHash),
+			BlockNumber:  uint64(t.BlockNum.Int64),
+			Maker:        common.HexToAddress(t.Maker),
+			Taker:        common.HexToAddress(t.Taker),
+			TokenGet:     common.HexToAddress(t.TokenGet),
+			TokenGive:    common.HexToAddress(t.TokenGive),
+			AmountGet:    deal.String(),
+			AmountGive:   new(big.Int).Div(new(big.Int).Mul(deal, amountGive), amountGet).String(),
+			FilledAmount: filled.String(),
+		})
+	}
+	return rets, nil
+}
+
+// balances returns the deposits of tokens, or the non zero deposits of the
+// native token and the tokens of all pairs if tokens is empty.
+func (api *restAPI) balances(ctx context.Context, addrHex, tokensStr string) ([]*RESTBalance, error) {
+	addr, err := parseRESTAddress(addrHex)
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens []common.Address
+	skipZero := tokensStr == ""
+	if skipZero {
+		pairs, err := api.dexDB.QueryTokenPairs()
+		if err != nil {
+			return nil, err
+		}
+		seen := map[common.Address]bool{common.EmptyAddress: true}
+		tokens = append(tokens, common.EmptyAddress)
+		for _, p := range pairs {
+			for _, token := range []common.Address{p.TokenGet, p.TokenGive} {
+				if !seen[token] {
+					seen[token] = true
+					tokens = append(tokens, token)
+				}
+			}
+		}
+	} else {
+		tokensStrs := strings.Split(tokensStr, ",")
+		if api.maxTokens > 0 && len(tokensStrs) > api.maxTokens {
+			return nil, errRESTTooManyTokens
+		}
+		for _, s := range tokensStrs {
+			token, err := parseRESTAddress(s)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token)
+		}
+	}
+
+	queries := make([]dex.DepositQuery, len(tokens))
+	for i, token := range tokens {
+		queries[i] = dex.DepositQuery{User: addr, Token: token}
+	}
+	amounts, err := api.dex.DexGetDepositAmounts(ctx, queries)
+	if err != nil {
+		return nil, err
+	}
+	rets := make([]*RESTBalance, 0, len(tokens))
+	for i, amount := range amounts {
+		if err := amount.Err(); err != nil {
+			return nil, err
+		}
+		if skipZero && amount.Amount.ToInt().Sign() == 0 {
+			continue
+		}
+		rets = append(rets, &RESTBalance{Token: tokens[i], Amount: amount.Amount.ToInt().String()})
+	}
+	return rets, nil
+}
+
+// orderAmounts parses amountGet, amountGive and the filled amount of an order record
+func orderAmounts(o *dex.OrderModel) (*big.Int, *big.Int, *big.Int) {
+	amountGet, ok := new(big.Int).SetString(o.AmountGet, 0)
+	if !ok {
+		amountGet = new(big.Int)
+	}
+	amountGive, ok := new(big.Int).SetString(o.AmountGive, 0)
+	if !ok {
+		amountGive = new(big.Int)
+	}
+	filled, ok := new(big.Int).SetString(o.FilledAmount, 0)
+	if !ok {
+		filled = new(big.Int)
+	}
+	return amountGet, amountGive, filled
+}
+
+// formatRatio formats num/den as a decimal without trailing zeros
+func formatRatio(num, den *big.Int) string {
+	if den.Sign() == 0 {
+		return "0"
+	}
+	s := new(big.Rat).SetFrac(num, den).FloatString(restPriceDigits)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+func parseRESTAddress(s string) (common.Address, error) {
+	if !common.IsHexAddress(s) {
+		return common.EmptyAddress, errRESTBadAddress
+	}
+	return common.HexToAddress(s), nil
+}
+
+func parseRESTHash(s string) (common.Hash, error) {
+	b, err := hexutil.Decode(s)
+	if err != nil || len(b) != common.HashLength {
+		return common.EmptyHash, errRESTBadHash
+	}
+	return common.BytesToHash(b), nil
+}
+
+func parseRESTLimit(s string) (int, error) {
+	if s == "" {
+		return restDefaultLimit, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return 0, errRESTBadLimit
+	}
+	if n > restMaxLimit {
+		n = restMaxLimit
+	}
+	return n, nil
+}
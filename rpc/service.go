@@ -3,6 +3,7 @@ package rpc
 import (
 	"fmt"
 	"net"
+	"net/http"
 	"runtime"
 	"strings"
 
@@ -28,8 +29,17 @@ type Service struct {
 	httpWhitelist []string     // HTTP RPC modules to allow through this endpoint
 	httpListener  net.Listener // HTTP RPC listener socket to server API requests
 	httpHandler   *rpc.Server  // HTTP RPC request handler to process the API requests
+	httpPublic    *rpc.Server  // HTTP RPC request handler of unauthenticated requests
 	wsListener    net.Listener // Websocket RPC listener socket to server API requests
 	wsHandler     *rpc.Server  // Websocket RPC request handler to process the API requests
+	wsPublic      *rpc.Server  // Websocket RPC request handler of unauthenticated connections
+
+	httpRestricted map[string]*rpc.Server // HTTP RPC request handlers of the wallet policies
+	wsRestricted   map[string]*rpc.Server // Websocket RPC request handlers of the wallet policies
+
+	auth     *authenticator           // checks the credentials of HTTP and WS requests
+	limiter  *limiter                 // rate limits and in flight cap of HTTP and WS requests
+	policies map[string]*walletPolicy // wallet policies by subject
 
 	apis []rpc.API
 }
@@ -41,6 +51,13 @@ func NewService(cfg *config.Config, ctx *Context) (*Service, error) {
 	backend := NewApiBackend(srv, ctx.dex, ctx.dexDB)
 	srv.backend = backend
 	srv.apis = GetAPIs(srv.backend)
+	srv.auth = newAuthenticator(cfg.RPC, ctx.logger)
+	srv.limiter = newLimiter(cfg, ctx.logger)
+	policies, err := newWalletPolicies(cfg.RPC.WalletPolicies)
+	if err != nil {
+		return nil, err
+	}
+	srv.policies = policies
 
 	srv.BaseService = *cmn.NewBaseService(ctx.logger, "RPC", srv)
 	srv.logger.Debug("create RPC service")
@@ -102,7 +119,7 @@ func (s *Service) startIPC() error {
 	if runtime.GOOS != "windows" {
 		IPCFile = s.conf.IPCFile()
 	}
-	listener, handler, err := rpc.StartIPCEndpoint(IPCFile, s.apis)
+	listener, handler, err := startIPCEndpoint(IPCFile, withDiscoverAPI(s.apis), s.ctx.metrics, s.logger)
 	if err != nil {
 		return err
 	}
@@ -134,17 +151,57 @@ func (s *Service) startHTTP() error {
 		return nil
 	}
 
-	listener, handler, err := rpc.StartHTTPEndpoint(s.conf.RPC.HTTPEndpoint, s.apis, s.conf.RPC.HTTPModules, s.conf.RPC.HTTPCores, s.conf.RPC.VHosts)
+	exclude := s.excludedModules()
+	handler, err := registerAPIs(s.apis, s.conf.RPC.HTTPModules, false, exclude, s.logger)
+	if err != nil {
+		s.logger.Error("startHTTP", "err", err)
+		return err
+	}
+	// unauthenticated requests get a server without the protected modules
+	publicHandler, err := registerAPIs(s.apis, s.conf.RPC.HTTPModules, false, s.publicExcludedModules(exclude), s.logger)
+	if err != nil {
+		handler.Stop()
+		s.logger.Error("startHTTP", "err", err)
+		return err
+	}
+	restricted, err := s.registerPolicyAPIs(s.conf.RPC.HTTPModules, false, exclude)
 	if err != nil {
+		handler.Stop()
+		publicHandler.Stop()
 		s.logger.Error("startHTTP", "err", err)
 		return err
 	}
+	listener, err := net.Listen("tcp", s.conf.RPC.HTTPEndpoint)
+	if err != nil {
+		handler.Stop()
+		publicHandler.Stop()
+		stopServers(restricted)
+		s.logger.Error("startHTTP", "err", err)
+		return err
+	}
+	restrictedHandlers := make(map[string]http.Handler)
+	for subject, srv := range restricted {
+		restrictedHandlers[subject] = newHTTPHandler(s.conf.RPC.HTTPCores, s.conf.RPC.VHosts, srv, s.ctx.metrics)
+	}
+	rpcHandler := s.auth.httpHandler(newHTTPHandler(s.conf.RPC.HTTPCores, s.conf.RPC.VHosts, handler, s.ctx.metrics),
+		newHTTPHandler(s.conf.RPC.HTTPCores, s.conf.RPC.VHosts, publicHandler, s.ctx.metrics), restrictedHandlers)
+	if s.conf.RPC.REST {
+		mux := http.NewServeMux()
+		mux.Handle(restPrefix, newRESTAPI(s.backend, s.conf.RPC.HTTPCores, s.logger))
+		mux.Handle("/", rpcHandler)
+		rpcHandler = mux
+	}
+	svr := &http.Server{Handler: newHealthHandler(s.backend, s.limiter.httpHandler(rpcHandler))}
+	svr.SetKeepAlivesEnabled(true)
+	go svr.Serve(listener)
 	s.logger.Info("HTTP endpoint opened", "url", fmt.Sprintf("http://%s", s.conf.RPC.HTTPEndpoint),
-		"cors", strings.Join(s.conf.RPC.HTTPCores, ","), "vhosts", strings.Join(s.conf.RPC.VHosts, ","), "modules", strings.Join(s.conf.RPC.HTTPModules, ","))
+		"cors", strings.Join(s.conf.RPC.HTTPCores, ","), "vhosts", strings.Join(s.conf.RPC.VHosts, ","), "modules", strings.Join(s.conf.RPC.HTTPModules, ","), "rest", s.conf.RPC.REST)
 
 	// All listeners booted successfully
 	s.httpListener = listener
 	s.httpHandler = handler
+	s.httpPublic = publicHandler
+	s.httpRestricted = restricted
 	return nil
 }
 
@@ -160,6 +217,12 @@ func (s *Service) stopHTTP() {
 		s.httpHandler.Stop()
 		s.httpHandler = nil
 	}
+	if s.httpPublic != nil {
+		s.httpPublic.Stop()
+		s.httpPublic = nil
+	}
+	stopServers(s.httpRestricted)
+	s.httpRestricted = nil
 }
 
 // startWS initializes and starts the websocket RPC endpoint.
@@ -169,16 +232,48 @@ func (s *Service) startWS() error {
 		return nil
 	}
 
-	listener, handler, err := rpc.StartWSEndpoint(s.conf.RPC.WSEndpoint, s.apis, s.conf.RPC.WSModules, s.conf.RPC.WSOrigins, s.conf.RPC.WSExposeAll)
+	exclude := s.excludedModules()
+	handler, err := registerAPIs(s.apis, s.conf.RPC.WSModules, s.conf.RPC.WSExposeAll, exclude, s.logger)
+	if err != nil {
+		s.logger.Error("startWS", "err", err)
+		return err
+	}
+	// unauthenticated connections get a server without the protected modules
+	publicHandler, err := registerAPIs(s.apis, s.conf.RPC.WSModules, s.conf.RPC.WSExposeAll, s.publicExcludedModules(exclude), s.logger)
 	if err != nil {
+		handler.Stop()
 		s.logger.Error("startWS", "err", err)
 		return err
 	}
+	restricted, err := s.registerPolicyAPIs(s.conf.RPC.WSModules, s.conf.RPC.WSExposeAll, exclude)
+	if err != nil {
+		handler.Stop()
+		publicHandler.Stop()
+		s.logger.Error("startWS", "err", err)
+		return err
+	}
+	listener, err := net.Listen("tcp", s.conf.RPC.WSEndpoint)
+	if err != nil {
+		handler.Stop()
+		publicHandler.Stop()
+		stopServers(restricted)
+		s.logger.Error("startWS", "err", err)
+		return err
+	}
+	restrictedHandlers := make(map[string]http.Handler)
+	for subject, srv := range restricted {
+		restrictedHandlers[subject] = websocketHandler(srv, s.conf.RPC.WSOrigins, s.limiter, s.ctx.metrics)
+	}
+	wsHandler := s.auth.wsHandler(websocketHandler(handler, s.conf.RPC.WSOrigins, s.limiter, s.ctx.metrics),
+		websocketHandler(publicHandler, s.conf.RPC.WSOrigins, s.limiter, s.ctx.metrics), restrictedHandlers)
+	go (&http.Server{Handler: wsHandler}).Serve(listener)
 	s.logger.Info("WebSocket endpoint opened", "url", fmt.Sprintf("ws://%s", listener.Addr()))
 
 	// All listeners booted successfully
 	s.wsListener = listener
 	s.wsHandler = handler
+	s.wsPublic = publicHandler
+	s.wsRestricted = restricted
 	return nil
 }
 
@@ -194,4 +289,59 @@ func (s *Service) stopWS() {
 		s.wsHandler.Stop()
 		s.wsHandler = nil
 	}
+	if s.wsPublic != nil {
+		s.wsPublic.Stop()
+		s.wsPublic = nil
+	}
+	stopServers(s.wsRestricted)
+	s.wsRestricted = nil
+}
+
+// registerPolicyAPIs registers a server per wallet policy, its wlt api is restricted by the policy
+func (s *Service) registerPolicyAPIs(modules []string, exposeAll bool, exclude map[string]bool) (map[string]*rpc.Server, error) {
+	servers := make(map[string]*rpc.Server)
+	for subject, policy := range s.policies {
+		apis := restrictedAPIs(s.backend, s.apis, policy)
+		srv, err := registerAPIs(apis, modules, exposeAll, exclude, s.logger)
+		if err != nil {
+			stopServers(servers)
+			return nil, err
+		}
+		servers[subject] = srv
+	}
+	return servers, nil
+}
+
+func stopServers(servers map[string]*rpc.Server) {
+	for _, srv := range servers {
+		srv.Stop()
+	}
+}
+
+// excludedModules returns the modules not served over HTTP and WS: the IPC only modules,
+// and the protected modules if no credential is configured to access them.
+func (s *Service) excludedModules() map[string]bool {
+	exclude := make(map[string]bool)
+	for _, m := range s.conf.RPC.IPCOnlyModules {
+		exclude[m] = true
+	}
+	if !s.auth.enabled() {
+		for _, m := range s.conf.RPC.AuthModules {
+			exclude[m] = true
+		}
+	}
+	return exclude
+}
+
+// publicExcludedModules returns the modules not served to unauthenticated requests:
+// exclude and the protected modules
+func (s *Service) publicExcludedModules(exclude map[string]bool) map[string]bool {
+	public := make(map[string]bool)
+	for m := range exclude {
+		public[m] = true
+	}
+	for _, m := range s.conf.RPC.AuthModules {
+		public[m] = true
+	}
+	return public
 }
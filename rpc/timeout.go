@@ -0,0 +1,26 @@
+package rpc
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// callContext bounds ctx by the timeout of method, rpc.method_timeouts or else rpc.call_timeout.
+// The daemon calls of a handler are canceled when it expires or when the client goes away.
+func callContext(ctx context.Context, b Backend, method string) (context.Context, context.CancelFunc) {
+	var timeout int
+	if cfg := b.GetConfig(); cfg != nil {
+		timeout = cfg.RPC.CallTimeout
+		for m, t := range cfg.RPC.MethodTimeouts {
+			if strings.EqualFold(m, method) {
+				timeout = t
+				break
+			}
+		}
+	}
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+}
@@ -0,0 +1,170 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/lianxiangcloud/linkchain/libs/log"
+	"github.com/lianxiangcloud/linkchain/libs/rpc"
+	"golang.org/x/net/websocket"
+)
+
+// wsMaxPayloadBytes is the message size limit of rpc.Server.WebsocketHandler
+const wsMaxPayloadBytes = 200 * 1024 * 1024
+
+// websocketHandler serves srv over websocket like rpc.Server.WebsocketHandler,
+// the messages of each connection are checked by l before they are served.
+func websocketHandler(srv *rpc.Server, allowedOrigins []string, l *limiter, metrics *Metrics) http.Handler {
+	return websocket.Server{
+		Handshake: wsHandshakeValidator(allowedOrigins),
+		Handler: func(conn *websocket.Conn) {
+			conn.MaxPayloadBytes = wsMaxPayloadBytes
+
+			lc := &limitedConn{conn: conn, limiter: l, client: clientIP(conn.Request().RemoteAddr)}
+			defer lc.releaseAll()
+			srv.ServeCodec(newCodec(conn, lc.send, lc.receive, metrics), rpc.OptionMethodInvocation|rpc.OptionSubscriptions)
+		},
+	}
+}
+
+// limitedConn applies the limiter to the messages of a websocket connection.
+// A served message with an id holds an in flight slot until the response of that id
+// is sent, a message without id holds none: the server answers it with a parse error
+// and closes the connection.
+type limitedConn struct {
+	conn    *websocket.Conn
+	limiter *limiter
+	client  string
+
+	mu      sync.Mutex
+	pending map[string]int // slots held by messages waiting for their response, by id
+}
+
+// receive reads the next message allowed by the limiter into v, the others
+// and those that can not be parsed are answered with an error right away.
+func (c *limitedConn) receive(v interface{}) error {
+	for {
+		var msg []byte
+		if err := websocket.Message.Receive(c.conn, &msg); err != nil {
+			return err
+		}
+		calls, batch, err := parseCalls(msg)
+		if err != nil {
+			if err := websocket.JSON.Send(c.conn, errorResponses([]rpcCall{{}}, false, errCodeParseError, errParseRequest)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		err = c.limiter.allow(c.client, calls)
+		if err == nil && !c.limiter.acquire() {
+			err = errTooManyRequests
+		}
+		if err != nil {
+			c.limiter.logger.Debug("WS request limited", "client", c.client, "method", calls[0].Method, "err", err)
+			if err := websocket.JSON.Send(c.conn, errorResponses(calls, batch, errCodeLimitExceeded, err)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if key := responseKey(calls); key != "" {
+			c.mu.Lock()
+			if c.pending == nil {
+				c.pending = make(map[string]int)
+			}
+			c.pending[key]++
+			c.mu.Unlock()
+		} else {
+			c.limiter.release()
+		}
+
+		dec := json.NewDecoder(bytes.NewReader(msg))
+		dec.UseNumber()
+		return dec.Decode(v)
+	}
+}
+
+// send writes v, a response releases the slot of the request with its id
+func (c *limitedConn) send(v interface{}) error {
+	msg, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	// notifications have no id, a batch response holds the ids of its calls
+	var resps []rpcCall
+	if calls, _, err := parseCalls(msg); err == nil {
+		resps = calls
+	}
+	c.mu.Lock()
+	for _, r := range resps {
+		if key := callKey(r.ID); c.pending[key] > 0 {
+			if c.pending[key]--; c.pending[key] == 0 {
+				delete(c.pending, key)
+			}
+			c.limiter.release()
+			break
+		}
+	}
+	c.mu.Unlock()
+	return websocket.Message.Send(c.conn, string(msg))
+}
+
+// releaseAll releases the slots of the requests left unanswered when the connection closes
+func (c *limitedConn) releaseAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, n := range c.pending {
+		for ; n > 0; n-- {
+			c.limiter.release()
+		}
+		delete(c.pending, key)
+	}
+}
+
+// responseKey returns the key of the first id of calls, the response of the message
+// carries it. It is empty if no call has an id: the message is not answered.
+func responseKey(calls []rpcCall) string {
+	for _, call := range calls {
+		if key := callKey(call.ID); key != "" {
+			return key
+		}
+	}
+	return ""
+}
+
+// wsHandshakeValidator returns a handler that verifies the origin during the
+// websocket upgrade, like the one of rpc.Server.WebsocketHandler.
+func wsHandshakeValidator(allowedOrigins []string) func(*websocket.Config, *http.Request) error {
+	origins := make(map[string]bool)
+	allowAllOrigins := false
+	for _, origin := range allowedOrigins {
+		if origin == "*" {
+			allowAllOrigins = true
+		}
+		if origin != "" {
+			origins[strings.ToLower(origin)] = true
+		}
+	}
+	// allow localhost if no allowedOrigins are specified.
+	if len(origins) == 0 {
+		origins["http://localhost"] = true
+		if hostname, err := os.Hostname(); err == nil {
+			origins["http://"+strings.ToLower(hostname)] = true
+		}
+	}
+
+	return func(cfg *websocket.Config, req *http.Request) error {
+		origin := strings.ToLower(req.Header.Get("Origin"))
+		if allowAllOrigins || origins[origin] {
+			return nil
+		}
+		log.Warn("Origin not allowed on WS-RPC interface", "origin", origin)
+		return fmt.Errorf("origin %s not allowed", origin)
+	}
+}
@@ -1,11 +1,116 @@
 package types
 
-import (
-	"errors"
+// Error codes of the dex errors, they are the codes of the JSON-RPC error objects
+// and must not change once released.
+const (
+	CodeInvalidArgs = -700001
+
+	CodeOrderSignature      = -700101
+	CodeOrderSignValue      = -700102
+	CodeOrderExpired        = -700103
+	CodeOrderCanceled       = -700104
+	CodeOrderFinished       = -700105
+	CodeInsufficientDeposit = -700106
+	CodeOrderNotFound       = -700107
+	CodeTxNotFound          = -700108
+	CodeTxNotPending        = -700109
+
+	CodeMethodDenied  = -701001
+	CodeAccountDenied = -701002
+
+	CodeNoConnectionToDaemon       = -702001
+	CodeNoConnectionToWalletDaemon = -702002
+	CodeDaemonResponse             = -702003
+	CodeDaemonResponseBody         = -702004
+	CodeDaemonResponseData         = -702005
+
+	CodeExecutionReverted = -703001
+
+	CodeWalletLocked   = -704001
+	CodeWalletResponse = -704002
+	CodeUnknownAccount = -704003
+
+	CodeDBOrderError = -705001
 )
 
 var (
-	ErrNoConnectionToDaemon       = errors.New("no_connection_to_daemon")
-	ErrNoConnectionToWalletDaemon = errors.New("no_connection_to_wallet_daemon")
-	ErrDBOrderError      = errors.New("Read Order db error")
+	ErrNoConnectionToDaemon       = NewError(CodeNoConnectionToDaemon, "no_connection_to_daemon")
+	ErrNoConnectionToWalletDaemon = NewError(CodeNoConnectionToWalletDaemon, "no_connection_to_wallet_daemon")
+	ErrDaemonResponse             = NewError(CodeDaemonResponse, "daemon response error")
+	ErrDaemonResponseBody         = NewError(CodeDaemonResponseBody, "daemon response body error")
+	ErrDaemonResponseData         = NewError(CodeDaemonResponseData, "daemon response data error")
+	ErrDBOrderError               = NewError(CodeDBOrderError, "Read Order db error")
+
+	ErrOrderSignature      = NewError(CodeOrderSignature, "order sign error: signer is not the maker")
+	ErrOrderSignValue      = NewError(CodeOrderSignValue, "order sign error: invalid v, r, s")
+	ErrOrderExpired        = NewError(CodeOrderExpired, "order error: order expired")
+	ErrOrderCanceled       = NewError(CodeOrderCanceled, "order error: order is canceled")
+	ErrOrderFinished       = NewError(CodeOrderFinished, "order error: order is already finished")
+	ErrInsufficientDeposit = NewError(CodeInsufficientDeposit, "maker deposit is insufficient")
+	ErrOrderNotFound       = NewError(CodeOrderNotFound, "order is not exist")
+	ErrTxNotFound          = NewError(CodeTxNotFound, "tx is not exist")
+	ErrTxNotPending        = NewError(CodeTxNotPending, "tx is not pending")
+
+	ErrMethodDenied  = NewError(CodeMethodDenied, "permission denied: method is not allowed")
+	ErrAccountDenied = NewError(CodeAccountDenied, "permission denied: account is not allowed")
+
+	ErrExecutionReverted = NewError(CodeExecutionReverted, "execution reverted")
+
+	ErrWalletLocked   = NewError(CodeWalletLocked, "wallet is locked")
+	ErrWalletResponse = NewError(CodeWalletResponse, "wallet daemon response error")
+	ErrUnknownAccount = NewError(CodeUnknownAccount, "signer has no key of the account")
 )
+
+// Error is a dex error with a stable code, its data explains the failure.
+// The rpc server serves it as a JSON-RPC error object with the same code, message and data.
+type Error struct {
+	code int
+	msg  string
+	data *ErrorData
+}
+
+// ErrorData is the data of an Error
+type ErrorData struct {
+	Method          string `json:"method,omitempty"`          // method called on the daemon
+	UpstreamCode    int    `json:"upstreamCode,omitempty"`    // error code returned by the daemon
+	UpstreamMessage string `json:"upstreamMessage,omitempty"` // error message returned by the daemon
+	Reason          string `json:"reason,omitempty"`          // revert reason of the contract
+}
+
+func NewError(code int, msg string) *Error {
+	return &Error{code: code, msg: msg}
+}
+
+// ArgsError returns an invalid args error with msg
+func ArgsError(msg string) *Error {
+	return NewError(CodeInvalidArgs, msg)
+}
+
+func (e *Error) Error() string {
+	return e.msg
+}
+
+func (e *Error) ErrorCode() int {
+	return e.code
+}
+
+// ErrorData returns the data of e, nil if it has none
+func (e *Error) ErrorData() interface{} {
+	if e.data == nil {
+		return nil
+	}
+	return e.data
+}
+
+// WithData returns a copy of e with data
+func (e *Error) WithData(data *ErrorData) *Error {
+	return &Error{code: e.code, msg: e.msg, data: data}
+}
+
+// ErrorCode returns the code of err if it is an Error, 0 otherwise
+func ErrorCode(err error) int {
+	if e, ok := err.(*Error); ok {
+		return e.code
+	}
+	return 0
+}
@@ -0,0 +1,24 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorData(t *testing.T) {
+	assert := assert.New(t)
+	assert.Nil(ErrOrderExpired.ErrorData())
+	assert.Equal(CodeOrderExpired, ErrorCode(ErrOrderExpired))
+	assert.Equal(0, ErrorCode(errors.New("order is nil")))
+
+	err := ErrExecutionReverted.WithData(&ErrorData{Method: "ltk_estimateGas", UpstreamCode: -603009, Reason: "Insufficient balance"})
+	assert.Equal(ErrExecutionReverted.Error(), err.Error())
+	assert.Equal(CodeExecutionReverted, err.ErrorCode())
+	assert.Nil(ErrExecutionReverted.ErrorData())
+
+	data, _ := json.Marshal(err.ErrorData())
+	assert.Equal(`{"method":"ltk_estimateGas","upstreamCode":-603009,"reason":"Insufficient balance"}`, string(data))
+}
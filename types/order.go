@@ -2,6 +2,7 @@ package types
 
 import (
 	"fmt"
+	"math/big"
 
 	"github.com/lianxiangcloud/linkchain/libs/common"
 	"github.com/lianxiangcloud/linkchain/libs/crypto"
@@ -41,3 +42,56 @@ type SignOrder struct {
 	S     *hexutil.Big `json:"s"`
 	R     *hexutil.Big `json:"r"`
 }
+
+// RecoverMaker returns the address that signed the order hash with V, R, S.
+// V is either 27/28 or carries the sign param like a transaction signature.
+func (s *SignOrder) RecoverMaker() (common.Address, error) {
+	if s.V == nil || s.R == nil || s.S == nil {
+		return common.EmptyAddress, ErrOrderSignValue
+	}
+	v, r, sv := s.V.ToInt(), s.R.ToInt(), s.S.ToInt()
+
+	var recID byte
+	switch {
+	case v.Cmp(big.NewInt(27)) == 0 || v.Cmp(big.NewInt(28)) == 0:
+		recID = byte(v.Uint64() - 27)
+	case v.Cmp(big.NewInt(35)) >= 0:
+		// v = signParam*2 + 35 + recID, see types.DeriveSignParam in linkchain
+		recID = byte(new(big.Int).Sub(v, big.NewInt(35)).Bit(0))
+	default:
+		return common.EmptyAddress, ErrOrderSignValue
+	}
+	if !crypto.ValidateSignatureValues(recID, r, sv, false) {
+		return common.EmptyAddress, ErrOrderSignValue
+	}
+
+	sig := make([]byte, 65)
+	copy(sig[32-len(r.Bytes()):32], r.Bytes())
+	copy(sig[64-len(sv.Bytes()):64], sv.Bytes())
+	sig[64] = recID
+
+	hash := s.OrderToHash()
+	pub, err := crypto.SigToPub(hash.Bytes(), sig)
+	if err != nil {
+		return common.EmptyAddress, ErrOrderSignValue
+	}
+	return crypto.PubkeyToAddress(*pub), nil
+}
+
+// VerifySign checks that the order is signed by its maker.
+func (s *SignOrder) VerifySign() error {
+	signer, err := s.RecoverMaker()
+	if err != nil {
+		return err
+	}
+	if signer != s.Maker {
+		return ErrOrderSignature
+	}
+	return nil
+}
+
+// TokenPair is the trading pair of orders giving TokenGive for TokenGet
+type TokenPair struct {
+	TokenGet  common.Address `json:"tokenGet"`
+	TokenGive common.Address `json:"tokenGive"`
+}
@@ -1 +1,62 @@
 package types
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/lianxiangcloud/linkchain/libs/common"
+	"github.com/lianxiangcloud/linkchain/libs/crypto"
+	"github.com/lianxiangcloud/linkchain/libs/hexutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func signTestOrder(t *testing.T) *SignOrder {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := Order{
+		TokenGet:   common.HexToAddress("0x0000000000000000000000000000000000000011"),
+		AmountGet:  (*hexutil.Big)(big.NewInt(100)),
+		TokenGive:  common.HexToAddress("0x0000000000000000000000000000000000000022"),
+		AmountGive: (*hexutil.Big)(big.NewInt(200)),
+		Expires:    hexutil.Uint64(1000),
+		Nonce:      hexutil.Uint64(1),
+		Maker:      crypto.PubkeyToAddress(key.PublicKey),
+	}
+	hash := order.OrderToHash()
+	sig, err := crypto.Sign(hash.Bytes(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &SignOrder{
+		Order: order,
+		R:     (*hexutil.Big)(new(big.Int).SetBytes(sig[:32])),
+		S:     (*hexutil.Big)(new(big.Int).SetBytes(sig[32:64])),
+		V:     (*hexutil.Big)(new(big.Int).SetBytes([]byte{sig[64] + 27})),
+	}
+}
+
+func TestRecoverMaker(t *testing.T) {
+	assert := assert.New(t)
+	order := signTestOrder(t)
+
+	signer, err := order.RecoverMaker()
+	assert.Nil(err)
+	assert.Equal(order.Maker, signer)
+	assert.Nil(order.VerifySign())
+
+	// same recovery id carried with a sign param
+	v := order.V.ToInt().Uint64() - 27 + 35 + 2*29154
+	order.V = (*hexutil.Big)(new(big.Int).SetUint64(v))
+	assert.Nil(order.VerifySign())
+
+	order.V = (*hexutil.Big)(big.NewInt(1))
+	assert.Equal(ErrOrderSignValue, order.VerifySign())
+}
+
+func TestVerifySignWrongMaker(t *testing.T) {
+	order := signTestOrder(t)
+	order.Maker = common.HexToAddress("0xa73810e519e1075010678d706533486d8ecc8000")
+	assert.Equal(t, ErrOrderSignature, order.VerifySign())
+}